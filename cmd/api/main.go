@@ -2,62 +2,193 @@ package main
 
 import (
 	"bake_backend/internal/api"
+	"bake_backend/internal/auth"
+	"bake_backend/internal/authz"
 	"bake_backend/internal/config"
-	"bake_backend/internal/repository"
-	"database/sql"
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
 )
 
 func main() {
-	cfg, err := config.LoadConfig()
+	storageFlag := flag.String("storage", "", "storage backend, postgres, sqlite or memory (overrides STORAGE)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: api [flags] [migrate <command> | seed --profile=prod|demo]\n\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		if err := runMigrate(*storageFlag, flag.Args()[1:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	case "seed":
+		if err := runSeed(*storageFlag, flag.Args()[1:]); err != nil {
+			log.Fatalf("Seeding failed: %v", err)
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig(config.Options{Storage: *storageFlag})
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@dpg-d1c7auje5dus73f9n0bg-a.oregon-postgres.render.com:5432/%s?sslmode=require",
-		cfg.DBUser, cfg.DBPassword, cfg.DBName)
-	db, err := sql.Open("postgres", connStr)
+	repo, closeStorage, err := openStorage(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to open %s storage: %v", cfg.Storage, err)
+	}
+	if cfg.Storage == config.StorageMemory {
+		log.Printf("Using in-memory storage, all data is lost on exit")
+		if cfg.AdminUsername == "" || cfg.AdminPassword == "" {
+			log.Printf("ADMIN_USERNAME and ADMIN_PASSWORD are not set, nobody will be able to log in")
+		}
 	}
-	defer db.Close()
 
-	repo := repository.NewPostgresRepository(db)
-	handler := api.NewHandler(repo)
+	authService := auth.NewService(repo, auth.NewTokenManager(cfg.JWTSecret, cfg.AccessTokenTTL), cfg.RefreshTokenTTL)
+	if created, err := authService.EnsureAdmin(context.Background(), cfg.AdminUsername, cfg.AdminPassword); err != nil {
+		log.Fatalf("Failed to create admin user: %v", err)
+	} else if created {
+		log.Printf("Created initial user %q", cfg.AdminUsername)
+	}
+	fields, err := authz.LoadFieldPolicy(cfg.FieldPolicyFile)
+	if err != nil {
+		log.Fatalf("Failed to load field policy: %v", err)
+	}
+	handler := api.NewHandler(repo, authService, fields, cfg.ValidationMode, cfg.BusinessLocation)
 
+	ready := &api.Readiness{}
 	r := mux.NewRouter()
 
+	r.HandleFunc("/api/auth/login", handler.Login).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/refresh", handler.Refresh).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/logout", handler.Logout).Methods("POST", "OPTIONS")
+
 	// Updated routes - removed report dates endpoints
 	r.HandleFunc("/api/reports/available-dates", handler.GetAvailableDates).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/reports/marketing-sources", handler.GetMarketingSources).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-sources", handler.CreateMarketingSource).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-sources/order", handler.ReorderMarketingSources).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-sources/{id:[0-9]+}", handler.RenameMarketingSource).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-sources/{id:[0-9]+}", handler.DeleteMarketingSource).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-sources/{id:[0-9]+}/archive", handler.ArchiveMarketingSource).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-sources/{id:[0-9]+}/restore", handler.RestoreMarketingSource).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/reports/sales-teams", handler.GetSalesTeams).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-teams", handler.CreateSalesTeam).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-teams/{id:[0-9]+}", handler.UpdateSalesTeam).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-teams/{id:[0-9]+}", handler.DeleteSalesTeam).Methods("DELETE", "OPTIONS")
 	r.HandleFunc("/api/reports/marketing-data", handler.GetMarketingData).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/reports/sales-data", handler.GetSalesData).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-funnel", handler.GetMarketingFunnel).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-data/export", handler.ExportMarketingData).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-data/export", handler.ExportSalesData).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/reports/marketing-data", handler.SaveMarketingData).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/reports/sales-data", handler.SaveSalesData).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-data/import", handler.ImportMarketingData).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-data/import", handler.ImportSalesData).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/daily-batch", handler.SaveDailyBatch).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-data/{id:[0-9]+}", handler.GetMarketingDataByID).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-data/{id:[0-9]+}", handler.GetSalesDataByID).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/reports/marketing-data/{id}", handler.UpdateMarketingData).Methods("PUT", "OPTIONS")
 	r.HandleFunc("/api/reports/sales-data/{id}", handler.UpdateSalesData).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-data/status", handler.ChangeMarketingStatus).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-data/status", handler.ChangeSalesStatus).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-data/deleted", handler.GetDeletedMarketingData).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-data/deleted", handler.GetDeletedSalesData).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-data/{id:[0-9]+}", handler.DeleteMarketingData).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-data/{id:[0-9]+}", handler.DeleteSalesData).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/reports/marketing-data/{id:[0-9]+}/restore", handler.RestoreMarketingData).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reports/sales-data/{id:[0-9]+}/restore", handler.RestoreSalesData).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/audit", handler.GetAuditLog).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/periods", handler.GetPeriodLocks).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/periods/close", handler.ClosePeriod).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/periods/{id:[0-9]+}/reopen", handler.ReopenPeriod).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/users", handler.GetUsers).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/users", handler.CreateUser).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/users/{id:[0-9]+}", handler.UpdateUser).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/healthz", api.Live).Methods("GET")
+	r.Handle("/readyz", ready).Methods("GET")
+	r.NotFoundHandler = http.HandlerFunc(handler.NotFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(handler.MethodNotAllowed)
+
+	authRouter := withAuth(authService.Tokens(), r)
+	loggedRouter := withLogging(authRouter)
+	corsRouter := withCORS(api.WithRequestID(loggedRouter))
+
+	server := &http.Server{
+		Addr:              cfg.HTTPAddr,
+		Handler:           corsRouter,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
 
-	loggedRouter := withLogging(r)
-	corsRouter := withCORS(loggedRouter)
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-	log.Printf("Server starting on :8080")
-	if err := http.ListenAndServe(":8080", corsRouter); err != nil {
+	listener, err := net.Listen("tcp", cfg.HTTPAddr)
+	if err != nil {
+		closeStorage()
+		log.Fatalf("Failed to listen on %s: %v", cfg.HTTPAddr, err)
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+	ready.Set(true)
+	log.Printf("Server listening on %s", listener.Addr())
+
+	select {
+	case err := <-serverErr:
+		closeStorage()
 		log.Fatalf("Server failed: %v", err)
+	case <-stop.Done():
+	}
+
+	// Stop advertising readiness first and keep serving until the load
+	// balancer has noticed, then let in-flight requests finish
+	ready.Set(false)
+	if cfg.ShutdownDrainDelay > 0 {
+		log.Printf("Shutting down, draining for %s", cfg.ShutdownDrainDelay)
+		time.Sleep(cfg.ShutdownDrainDelay)
+	}
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", cfg.ShutdownTimeout)
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown did not complete: %v", err)
 	}
+
+	if err := closeStorage(); err != nil {
+		log.Printf("Failed to close storage: %v", err)
+	}
+	log.Printf("Server stopped")
 }
 
 // Middleware to allow CORS from any origin
 func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*") // Allow all origins
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag, Warning")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -68,9 +199,45 @@ func withCORS(next http.Handler) http.Handler {
 	})
 }
 
+// publicPaths are reachable without an access token
+var publicPaths = map[string]bool{
+	"/api/auth/login":   true,
+	"/api/auth/refresh": true,
+	"/api/auth/logout":  true,
+	"/healthz":          true,
+	"/readyz":           true,
+}
+
+// withAuth requires a valid "Authorization: Bearer <jwt>" on every non-public
+// route and stores the caller in the request context.
+func withAuth(tokens *auth.TokenManager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			api.WriteError(w, r, http.StatusUnauthorized, api.CodeUnauthorized, "missing bearer token", nil)
+			return
+		}
+
+		principal, err := tokens.Parse(strings.TrimSpace(token))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			api.WriteError(w, r, http.StatusUnauthorized, api.CodeUnauthorized, err.Error(), nil)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
 func withLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
+		log.Printf("%s %s %s", api.RequestIDFromContext(r.Context()), r.Method, r.URL.Path)
 		next.ServeHTTP(w, r)
 	})
 }
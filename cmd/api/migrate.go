@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bake_backend/internal/config"
+	"bake_backend/migrations"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	"github.com/pressly/goose/v3/lock"
+)
+
+const migrateUsage = `usage: api [--storage=postgres|sqlite] migrate [flags] <command>
+
+commands:
+  up             apply all pending migrations
+  down           roll back the last applied migration
+  status         list migrations and whether they are applied
+  create <name>  add an empty SQL migration to -dir
+  baseline <version>
+                 record migrations up to version as applied without running
+                 them, for a database whose schema was changed by hand
+
+Migrations that drop tables, columns or rows are refused while the database
+holds report rows, unless -allow-destructive or MIGRATE_ALLOW_DESTRUCTIVE is set.
+A section that moves the data elsewhere before dropping it can say so with a
+"-- +safe <why>" line, the guard then lets it run.
+
+Deploying to a database migrated by hand, without a goose_db_version table:
+find the last migration whose changes it already has, back it up, run
+"migrate baseline <that version>", check "migrate status", then "migrate up"
+or start with MIGRATE_ON_START as usual.
+
+flags:
+`
+
+// runMigrate implements "api migrate". storage is the --storage flag, the
+// database settings come from the environment as for the server.
+func runMigrate(storage string, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := flags.String("dir", "migrations", "directory create writes to, migrations/sqlite for the sqlite backend")
+	allowDestructive := flags.Bool("allow-destructive", false, "run destructive migrations even though report rows exist")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), migrateUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	switch flags.Arg(0) {
+	case "create":
+		// New files only land in the source tree, no database is involved
+		if flags.Arg(1) == "" {
+			flags.Usage()
+			return errors.New("create needs a migration name")
+		}
+		return createMigration(*dir, flags.Arg(1))
+	case "up", "down", "status":
+	case "baseline":
+		if flags.Arg(1) == "" {
+			flags.Usage()
+			return errors.New("baseline needs the version the database already has")
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", flags.Arg(0))
+	}
+
+	cfg, err := config.LoadConfig(config.Options{Storage: storage, Command: "migrate"})
+	if err != nil {
+		return err
+	}
+	var db *sql.DB
+	switch cfg.Storage {
+	case config.StoragePostgres:
+		db, err = openDB(cfg)
+	case config.StorageSQLite:
+		db, err = openSQLiteDB(cfg)
+	default:
+		return fmt.Errorf("%s storage has no schema to migrate", cfg.Storage)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := newMigrator(cfg.Storage, db, *allowDestructive || cfg.MigrateAllowDestructive)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch flags.Arg(0) {
+	case "up":
+		return m.up(ctx)
+	case "down":
+		return m.down(ctx)
+	case "baseline":
+		version, err := strconv.ParseInt(flags.Arg(1), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid baseline version %q", flags.Arg(1))
+		}
+		return m.baseline(ctx, version)
+	default:
+		return printMigrationStatus(ctx, m.Provider)
+	}
+}
+
+const migrationTemplate = `-- +goose Up
+
+-- +goose Down
+`
+
+// createMigration adds an empty migration numbered after the last one in
+// dir, keeping the three-digit prefix of the existing files.
+func createMigration(dir, name string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var last int64
+	for _, e := range entries {
+		if version, err := goose.NumericComponent(e.Name()); err == nil && version > last {
+			last = version
+		}
+	}
+
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	path := filepath.Join(dir, fmt.Sprintf("%03d_%s.sql", last+1, name))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(migrationTemplate); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Created %s", path)
+	return nil
+}
+
+// migrator runs the embedded migrations of a backend and guards report data
+// against the destructive ones.
+type migrator struct {
+	*goose.Provider
+	storage string
+	dialect goose.Dialect
+	db      *sql.DB
+	fsys    fs.FS
+	// allowDestructive turns the guard off
+	allowDestructive bool
+}
+
+// newMigrator returns the migrator for the embedded migrations of the
+// backend. On Postgres it holds an advisory lock while migrating, so that
+// instances starting at the same time apply each migration once.
+func newMigrator(storage string, db *sql.DB, allowDestructive bool) (*migrator, error) {
+	m := &migrator{storage: storage, db: db, allowDestructive: allowDestructive}
+	var err error
+	switch storage {
+	case config.StoragePostgres:
+		var locker lock.SessionLocker
+		if locker, err = lock.NewPostgresSessionLocker(); err != nil {
+			return nil, err
+		}
+		m.dialect, m.fsys = goose.DialectPostgres, migrations.Postgres
+		m.Provider, err = goose.NewProvider(m.dialect, db, m.fsys, goose.WithSessionLocker(locker))
+	case config.StorageSQLite:
+		if m.fsys, err = fs.Sub(migrations.SQLite, "sqlite"); err != nil {
+			return nil, err
+		}
+		m.dialect = goose.DialectSQLite3
+		m.Provider, err = goose.NewProvider(m.dialect, db, m.fsys)
+	default:
+		return nil, fmt.Errorf("%s storage has no migrations", storage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// up applies pending migrations and logs each one.
+func (m *migrator) up(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []*goose.Source
+	for _, s := range statuses {
+		if s.State == goose.StatePending {
+			pending = append(pending, s.Source)
+		}
+	}
+	if err := m.guard(ctx, "Up", pending, len(pending) < len(statuses)); err != nil {
+		return err
+	}
+
+	results, err := m.Up(ctx)
+	for _, result := range results {
+		log.Printf("%s", result)
+	}
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		log.Printf("Schema is up to date")
+	}
+	return nil
+}
+
+// down rolls back the last applied migration.
+func (m *migrator) down(ctx context.Context) error {
+	version, err := m.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range m.ListSources() {
+		if s.Version == version {
+			if err := m.guard(ctx, "Down", []*goose.Source{s}, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	result, err := m.Down(ctx)
+	if errors.Is(err, goose.ErrNoNextVersion) {
+		log.Printf("No migrations to roll back")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("%s", result)
+	return nil
+}
+
+// baseline adopts a database migrated by hand: it records the migrations up
+// to version as applied without running them. Databases with migration
+// history are refused, as are ones without the schema of the first migration.
+func (m *migrator) baseline(ctx context.Context, version int64) error {
+	var known bool
+	for _, s := range m.ListSources() {
+		known = known || s.Version == version
+	}
+	if !known {
+		return fmt.Errorf("there is no migration with version %d", version)
+	}
+
+	// Creates goose_db_version if it is missing
+	current, err := m.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current != 0 {
+		return fmt.Errorf("the database is already at version %d, baseline only adopts databases without migration history", current)
+	}
+	ok, err := m.tableExists(ctx, "marketing_data")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New(`the database has no schema, run "migrate up" instead`)
+	}
+
+	store, err := database.NewStore(m.dialect, goose.DefaultTablename)
+	if err != nil {
+		return err
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range m.ListSources() {
+		if s.Version > version {
+			break
+		}
+		if err := store.Insert(ctx, tx, database.InsertRequest{Version: s.Version}); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Recorded migrations up to %d as applied, none of them was run", version)
+	return nil
+}
+
+// destructiveSQL matches statements that lose data when run against a
+// populated table.
+var destructiveSQL = regexp.MustCompile(`(?i)\b(DROP\s+(TABLE|COLUMN)|TRUNCATE|DELETE\s+FROM)\b`)
+
+// shippedSafe declares safe the sections of migrations released before
+// "-- +safe" existed, by file and section. Released files stay as they were.
+var shippedSafe = map[string]string{
+	"009_report_status.sql Up": "is_saved is carried over into status before it is dropped",
+}
+
+// dbState is what the guard knows about the database.
+type dbState struct {
+	// history is set when some migration is recorded as applied
+	history bool
+	// hasSchema is set when marketing_data exists
+	hasSchema bool
+	// reportRows counts marketing and sales rows, deleted ones included
+	reportRows int
+}
+
+// guard refuses to run the Up or Down section of sources if any of them is
+// destructive, and not declared safe, while the database holds report rows.
+// history tells whether the database has recorded any migration.
+func (m *migrator) guard(ctx context.Context, section string, sources []*goose.Source, history bool) error {
+	destructive, err := destructiveSources(m.fsys, section, sources)
+	if err != nil {
+		return err
+	}
+	state := dbState{history: history}
+	if state.hasSchema, err = m.tableExists(ctx, "marketing_data"); err != nil {
+		return err
+	}
+	// Counting is only worth it when something would drop the rows
+	if len(destructive) > 0 {
+		if state.reportRows, err = m.reportRows(ctx); err != nil {
+			return err
+		}
+	}
+	if err := checkMigration(section, len(sources), destructive, state, m.allowDestructive); err != nil {
+		return err
+	}
+	if len(destructive) > 0 && state.reportRows > 0 {
+		log.Printf("Running the %s section of %s, which drops data, with %d report rows present",
+			section, strings.Join(destructive, ", "), state.reportRows)
+	}
+	return nil
+}
+
+// checkMigration decides whether the section of pending migrations may run
+// against a database in state, destructive lists the ones that drop data.
+func checkMigration(section string, pending int, destructive []string, state dbState, allowDestructive bool) error {
+	if section == "Up" && pending > 0 && !state.history && state.hasSchema {
+		// Running 001 against tables created by hand fails half way through
+		return errors.New(`the database has a schema but no migration history, adopt it with "migrate baseline <version>" first`)
+	}
+	if len(destructive) == 0 || state.reportRows == 0 || allowDestructive {
+		return nil
+	}
+	return fmt.Errorf("refusing to run the %s section of %s: it drops data and the database holds %d report rows; "+
+		"back it up and pass -allow-destructive or set MIGRATE_ALLOW_DESTRUCTIVE=true",
+		section, strings.Join(destructive, ", "), state.reportRows)
+}
+
+// destructiveSources returns the paths of the sources whose Up or Down
+// section drops data and is not declared safe.
+func destructiveSources(fsys fs.FS, section string, sources []*goose.Source) ([]string, error) {
+	var destructive []string
+	for _, s := range sources {
+		body, err := fs.ReadFile(fsys, s.Path)
+		if err != nil {
+			return nil, err
+		}
+		statements, safe := migrationSection(string(body), section)
+		_, shipped := shippedSafe[s.Path+" "+section]
+		if !safe && !shipped && destructiveSQL.MatchString(statements) {
+			destructive = append(destructive, s.Path)
+		}
+	}
+	return destructive, nil
+}
+
+// migrationSection returns the statements of the Up or Down section of a
+// goose SQL file, without comments, and whether the section is annotated
+// with "-- +safe": it keeps what it drops, e.g. by copying a column first.
+func migrationSection(body, section string) (statements string, safe bool) {
+	var b strings.Builder
+	var in bool
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "-- +goose Up") || strings.HasPrefix(trimmed, "-- +goose Down") {
+			in = strings.HasPrefix(trimmed, "-- +goose "+section)
+			continue
+		}
+		switch {
+		case !in:
+		case trimmed == "-- +safe" || strings.HasPrefix(trimmed, "-- +safe "):
+			safe = true
+		case !strings.HasPrefix(trimmed, "--"):
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String(), safe
+}
+
+// reportRows counts the marketing and sales rows, deleted ones included. A
+// database without the tables yet has none.
+func (m *migrator) reportRows(ctx context.Context) (int, error) {
+	var total int
+	for _, table := range []string{"marketing_data", "sales_data"} {
+		ok, err := m.tableExists(ctx, table)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		var n int
+		if err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n); err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (m *migrator) tableExists(ctx context.Context, table string) (bool, error) {
+	exists := "SELECT to_regclass($1) IS NOT NULL"
+	if m.storage == config.StorageSQLite {
+		exists = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1)"
+	}
+	var ok bool
+	err := m.db.QueryRowContext(ctx, exists, table).Scan(&ok)
+	return ok, err
+}
+
+func printMigrationStatus(ctx context.Context, provider *goose.Provider) error {
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tFILE")
+	for _, s := range statuses {
+		appliedAt := "-"
+		if s.State == goose.StateApplied {
+			appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Source.Version, s.State, appliedAt, s.Source.Path)
+	}
+	return w.Flush()
+}
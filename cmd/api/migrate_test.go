@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bake_backend/migrations"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+)
+
+// embeddedSources lists the migrations of a backend as the provider sees them.
+func embeddedSources(t *testing.T, fsys fs.FS) []*goose.Source {
+	t.Helper()
+	paths, err := fs.Glob(fsys, "*.sql")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no migrations: %v", err)
+	}
+	var sources []*goose.Source
+	for _, path := range paths {
+		version, err := goose.NumericComponent(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, &goose.Source{Type: goose.TypeSQL, Path: path, Version: version})
+	}
+	return sources
+}
+
+func TestDestructiveSources(t *testing.T) {
+	sqlite, err := fs.Sub(migrations.SQLite, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		fsys    fs.FS
+		section string
+		want    []string
+	}{
+		// 009 drops is_saved only after copying it into status
+		{"postgres up", migrations.Postgres, "Up", nil},
+		{"postgres down", migrations.Postgres, "Down", []string{
+			"001_create_schema.sql",
+			"002_marketing_sources_management.sql",
+			"003_sales_teams_activity.sql",
+			"004_soft_delete_report_data.sql",
+			"005_create_audit_log.sql",
+			"006_create_users.sql",
+			"007_user_roles.sql",
+			"008_period_locks.sql",
+			"009_report_status.sql",
+			"010_row_versions.sql",
+		}},
+		{"sqlite up", sqlite, "Up", nil},
+		{"sqlite down", sqlite, "Down", []string{"001_create_schema.sql"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := destructiveSources(tt.fsys, tt.section, embeddedSources(t, tt.fsys))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShippedSafeNamesEmbeddedSections(t *testing.T) {
+	for key := range shippedSafe {
+		path, section, _ := strings.Cut(key, " ")
+		body, err := fs.ReadFile(migrations.Postgres, path)
+		if err != nil || !strings.Contains(string(body), "-- +goose "+section) {
+			t.Errorf("%q names no embedded migration section: %v", key, err)
+		}
+	}
+}
+
+func TestDestructiveSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"DROP TABLE marketing_data;", true},
+		{"alter table sales_data drop column is_saved;", true},
+		{"ALTER TABLE sales_data DROP\n    COLUMN is_saved;", true},
+		{"TRUNCATE audit_log;", true},
+		{"DELETE FROM sales_data WHERE team_id = 3;", true},
+		{"DROP INDEX sales_data_status_idx;", false},
+		{"ALTER TABLE users DROP CONSTRAINT users_role_check;", false},
+		{"ALTER TABLE sales_data ADD COLUMN deleted_at TIMESTAMP;", false},
+		{"UPDATE sales_data SET is_deleted = TRUE;", false},
+		{"CREATE TABLE dropped_columns (id INT);", false},
+	}
+	for _, tt := range tests {
+		if got := destructiveSQL.MatchString(tt.sql); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestMigrationSection(t *testing.T) {
+	const body = `-- +goose Up
+-- +safe the rows are copied into archive first
+INSERT INTO archive SELECT * FROM old;
+DROP TABLE old;
+
+-- +goose Down
+-- +safeguard is not an annotation
+-- DROP TABLE archive;
+CREATE TABLE old (id INT);
+`
+	up, safe := migrationSection(body, "Up")
+	if !safe || !strings.Contains(up, "DROP TABLE old;") || strings.Contains(up, "CREATE TABLE") {
+		t.Errorf("Up: safe %v, statements:\n%s", safe, up)
+	}
+	down, safe := migrationSection(body, "Down")
+	if safe || strings.Contains(down, "DROP") || !strings.Contains(down, "CREATE TABLE old") {
+		t.Errorf("Down: safe %v, statements:\n%s", safe, down)
+	}
+
+	if _, safe := migrationSection("-- +goose Up\n  -- +safe\nDROP TABLE old;\n", "Up"); !safe {
+		t.Errorf("bare indented annotation is ignored")
+	}
+}
+
+func TestCheckMigration(t *testing.T) {
+	destructive := []string{"009_report_status.sql"}
+	tests := []struct {
+		name        string
+		section     string
+		pending     int
+		destructive []string
+		state       dbState
+		allow       bool
+		wantErr     string
+	}{
+		{"empty database", "Up", 10, nil, dbState{}, false, ""},
+		{"schema made by hand", "Up", 10, nil, dbState{hasSchema: true}, false, "migrate baseline"},
+		{"schema made by hand, destruction allowed", "Up", 10, nil, dbState{hasSchema: true}, true, "migrate baseline"},
+		{"up to date schema made by hand", "Up", 0, nil, dbState{hasSchema: true}, false, ""},
+		{"pending on a migrated database", "Up", 2, nil, dbState{history: true, hasSchema: true, reportRows: 5}, false, ""},
+		{"destructive without rows", "Down", 1, destructive, dbState{history: true, hasSchema: true}, false, ""},
+		{"destructive with rows", "Down", 1, destructive, dbState{history: true, hasSchema: true, reportRows: 5}, false,
+			"refusing to run the Down section of 009_report_status.sql: it drops data and the database holds 5 report rows"},
+		{"destructive with rows, allowed", "Down", 1, destructive, dbState{history: true, hasSchema: true, reportRows: 5}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMigration(tt.section, tt.pending, tt.destructive, tt.state, tt.allow)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bake_backend/internal/config"
+	"bake_backend/internal/seed"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+)
+
+const seedUsage = `usage: api [--storage=postgres|sqlite] seed [flags]
+
+Adds the marketing sources and sales teams (prod), and with demo also %d days
+of sample reports. Existing rows are kept, seeding again adds only what is
+missing.
+
+flags:
+`
+
+// runSeed implements "api seed". The memory backend is seeded on start
+// instead, with SEED_PROFILE.
+func runSeed(storage string, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	profile := flags.String("profile", seed.ProfileProd, "what to add, prod or demo")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), seedUsage, seed.DemoDays)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 || !seed.IsValidProfile(*profile) {
+		flags.Usage()
+		return fmt.Errorf("invalid seed arguments")
+	}
+
+	cfg, err := config.LoadConfig(config.Options{Storage: storage, Command: "seed"})
+	if err != nil {
+		return err
+	}
+	if cfg.Storage == config.StorageMemory {
+		return fmt.Errorf("memory storage is seeded on start, set SEED_PROFILE instead")
+	}
+	repo, closeStorage, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	result, err := seed.Run(context.Background(), repo, *profile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Seeded %s profile: %s", *profile, result)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bake_backend/internal/api"
+	"bake_backend/internal/auth"
+	"bake_backend/internal/config"
+	"bake_backend/internal/repository"
+	"bake_backend/internal/seed"
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// storage is what the handlers and the auth service need from a backend.
+type storage interface {
+	api.Repository
+	auth.Store
+}
+
+// openStorage connects the backend selected by cfg.Storage. The returned
+// func releases it on shutdown.
+func openStorage(cfg *config.Config) (storage, func() error, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		// A new instance has nothing in it, so it is always seeded
+		repo := repository.NewMemoryRepository()
+		if _, err := seed.Run(context.Background(), repo, cfg.SeedProfile); err != nil {
+			return nil, nil, fmt.Errorf("seed: %w", err)
+		}
+		return repo, func() error { return nil }, nil
+	case config.StorageSQLite:
+		db, err := openSQLite(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return repository.NewSQLiteRepository(db, repositoryTimeouts(cfg)), db.Close, nil
+	case config.StoragePostgres:
+		db, err := openDB(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.MigrateOnStart {
+			if err := migrateOnStart(cfg, db); err != nil {
+				db.Close()
+				return nil, nil, err
+			}
+		}
+		return repository.NewPostgresRepository(db, repositoryTimeouts(cfg)), db.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+}
+
+func repositoryTimeouts(cfg *config.Config) repository.Timeouts {
+	return repository.Timeouts{Query: cfg.DBQueryTimeout, Bulk: cfg.DBBulkTimeout}
+}
+
+// openDB opens the connection pool and checks that the database is reachable.
+func openDB(cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// openSQLite opens the database file and brings its schema up to date, so a
+// new file is ready to use.
+func openSQLite(cfg *config.Config) (*sql.DB, error) {
+	db, err := openSQLiteDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateOnStart(cfg, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func openSQLiteDB(cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", repository.SQLiteDSN(cfg.SQLitePath))
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer; one connection avoids lock contention
+	// between pooled connections of the same process
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// migrateOnStart applies the pending migrations of the backend.
+func migrateOnStart(cfg *config.Config, db *sql.DB) error {
+	m, err := newMigrator(cfg.Storage, db, cfg.MigrateAllowDestructive)
+	if err != nil {
+		return err
+	}
+	if err := m.up(context.Background()); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
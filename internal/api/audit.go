@@ -0,0 +1,40 @@
+package api
+
+import (
+	"bake_backend/internal/domain"
+	"net/http"
+	"strconv"
+)
+
+// GetAuditLog lists recorded changes, filtered by ?entity=&id=&from=&to=&limit=.
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.AuditFilter{Entity: q.Get("entity")}
+	var ok bool
+	if filter.From, filter.To, ok = dateRange(w, r); !ok {
+		return
+	}
+
+	if id := q.Get("id"); id != "" {
+		var err error
+		if filter.EntityID, err = strconv.Atoi(id); err != nil {
+			badRequest(w, r, "Invalid id")
+			return
+		}
+	}
+	if limit := q.Get("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			badRequest(w, r, "Invalid limit")
+			return
+		}
+	}
+
+	entries, err := h.scoped(r).GetAuditLog(r.Context(), filter)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	"bake_backend/internal/validation"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SaveDailyBatch saves all marketing and sales rows of a day atomically.
+// Rows are upserted on (date, source_id) / (date, team_id); IDs in the request are ignored.
+// A row overwriting a stored one must carry that row's version.
+func (h *Handler) SaveDailyBatch(w http.ResponseWriter, r *http.Request) {
+	var batch domain.DailyBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	rowErrors, warnings, err := checkBatch(r.Context(), &batch, h.validator(r))
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	if len(rowErrors) == 0 {
+		rowErrors, err = h.scoped(r).SaveDailyBatch(r.Context(), &batch, auditMeta(r))
+		if err != nil {
+			writeRepoError(w, r, err)
+			return
+		}
+	}
+
+	result := domain.DailyBatchResult{Marketing: batch.Marketing, Sales: batch.Sales, Errors: rowErrors, Warnings: warnings}
+	if result.Marketing == nil {
+		result.Marketing = []domain.MarketingData{}
+	}
+	if result.Sales == nil {
+		result.Sales = []domain.SalesData{}
+	}
+
+	status := batchStatus(rowErrors)
+
+	// Marketing and sales rows share field names, so each half gets its own rules
+	marketing, err := h.fields.Apply(principalRole(r), authz.EntityMarketing, result.Marketing)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	sales, err := h.fields.Apply(principalRole(r), authz.EntitySales, result.Sales)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"marketing": marketing,
+		"sales":     sales,
+		"errors":    result.Errors,
+		"warnings":  result.Warnings,
+	})
+}
+
+// batchStatus answers rows rejected by the version check like single-row
+// saves would.
+func batchStatus(rowErrors []domain.BatchRowError) int {
+	if len(rowErrors) == 0 {
+		return http.StatusOK
+	}
+	for _, e := range rowErrors {
+		if e.Code == domain.BatchCodeVersionMismatch {
+			return http.StatusPreconditionFailed
+		}
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// checkBatch fills in the batch date, validates every row and rejects
+// duplicate keys. Validation warnings are returned separately and don't stop
+// the batch.
+func checkBatch(ctx context.Context, batch *domain.DailyBatch, v *validation.Validator) (rowErrors, warnings []domain.BatchRowError, err error) {
+	report := func(list *[]domain.BatchRowError, kind string, index int, problems []domain.FieldError) {
+		*list = append(*list, domain.BatchRowError{Kind: kind, Index: index, Error: validation.Summary(problems), Fields: problems})
+	}
+	reject := func(kind string, index int, format string, args ...interface{}) {
+		rowErrors = append(rowErrors, domain.BatchRowError{Kind: kind, Index: index, Error: fmt.Sprintf(format, args...)})
+	}
+
+	seen := map[string]int{}
+	for i := range batch.Marketing {
+		d := &batch.Marketing[i]
+		d.ID = 0
+		if d.Date == "" {
+			d.Date = batch.Date
+		}
+		res, err := v.Marketing(ctx, d)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(res.Warnings) > 0 {
+			report(&warnings, domain.BatchKindMarketing, i, res.Warnings)
+		}
+		if len(res.Errors) > 0 {
+			report(&rowErrors, domain.BatchKindMarketing, i, res.Errors)
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d", d.Date, d.SourceID)
+		if prev, ok := seen[key]; ok {
+			reject(domain.BatchKindMarketing, i, "duplicate of marketing row %d", prev)
+		} else {
+			seen[key] = i
+		}
+	}
+
+	seen = map[string]int{}
+	for i := range batch.Sales {
+		d := &batch.Sales[i]
+		d.ID = 0
+		if d.Date == "" {
+			d.Date = batch.Date
+		}
+		res, err := v.Sales(ctx, d)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(res.Warnings) > 0 {
+			report(&warnings, domain.BatchKindSales, i, res.Warnings)
+		}
+		if len(res.Errors) > 0 {
+			report(&rowErrors, domain.BatchKindSales, i, res.Errors)
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d", d.Date, d.TeamID)
+		if prev, ok := seen[key]; ok {
+			reject(domain.BatchKindSales, i, "duplicate of sales row %d", prev)
+		} else {
+			seen[key] = i
+		}
+	}
+
+	return rowErrors, warnings, nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bake_backend/internal/authz"
+	"net/http"
+)
+
+func (h *Handler) DeleteMarketingData(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).DeleteMarketingData(r.Context(), id, auditMeta(r)); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RestoreMarketingData(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).RestoreMarketingData(r.Context(), id, auditMeta(r)); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeletedMarketingData lists soft-deleted rows; accepts the same filters as GetMarketingData.
+func (h *Handler) GetDeletedMarketingData(w http.ResponseWriter, r *http.Request) {
+	filter, ok := reportFilter(w, r, "source_ids")
+	if !ok {
+		return
+	}
+
+	data, err := h.scoped(r).GetDeletedMarketingData(r.Context(), filter)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	h.writeData(w, r, http.StatusOK, authz.EntityMarketing, data)
+}
+
+func (h *Handler) DeleteSalesData(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).DeleteSalesData(r.Context(), id, auditMeta(r)); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RestoreSalesData(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).RestoreSalesData(r.Context(), id, auditMeta(r)); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetDeletedSalesData(w http.ResponseWriter, r *http.Request) {
+	filter, ok := reportFilter(w, r, "team_ids")
+	if !ok {
+		return
+	}
+
+	data, err := h.scoped(r).GetDeletedSalesData(r.Context(), filter)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	h.writeData(w, r, http.StatusOK, authz.EntitySales, data)
+}
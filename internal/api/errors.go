@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bake_backend/internal/repository"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Error codes of the JSON error envelope. They are part of the API: clients
+// branch on code, message is meant for humans and may change.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeInvalidStatus        = "invalid_status"
+	CodeVersionMismatch      = "version_mismatch"
+	CodePreconditionRequired = "precondition_required"
+	CodeValidation           = "validation_failed"
+	CodeLocked               = "locked"
+	CodeTooLarge             = "too_large"
+	CodeUnavailable          = "unavailable"
+	CodeTimeout              = "timeout"
+	CodeInternal             = "internal_error"
+)
+
+// errorResponse is the body of every error answered by the API.
+type errorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// WriteError answers with the JSON error envelope.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	writeJSON(w, status, errorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: RequestIDFromContext(r.Context()),
+	})
+}
+
+func (h *Handler) NotFound(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusNotFound, CodeNotFound, "no such endpoint", nil)
+}
+
+func (h *Handler) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusMethodNotAllowed, CodeBadRequest, "method not allowed", nil)
+}
+
+func badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	WriteError(w, r, http.StatusBadRequest, CodeBadRequest, message, nil)
+}
+
+// writeRepoError maps the typed repository errors to HTTP statuses. Anything
+// else is logged with the request ID and answered with a generic 500, so SQL
+// and driver messages never reach the client.
+func writeRepoError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		conflict *repository.ConflictError
+		locked   *repository.LockedError
+		status   *repository.StatusError
+		invalid  *repository.ValidationError
+	)
+	switch {
+	case errors.As(err, &invalid):
+		WriteError(w, r, http.StatusUnprocessableEntity, CodeValidation, "validation failed", invalid)
+	case errors.As(err, &conflict):
+		WriteError(w, r, http.StatusConflict, CodeConflict, conflict.Message, map[string]interface{}{
+			"constraint": conflict.Constraint,
+			"detail":     conflict.Detail,
+		})
+	case errors.As(err, &locked):
+		WriteError(w, r, http.StatusLocked, CodeLocked, locked.Error(), locked)
+	case errors.As(err, &status):
+		WriteError(w, r, http.StatusConflict, CodeInvalidStatus, status.Error(), status)
+	case errors.Is(err, repository.ErrVersionRequired):
+		WriteError(w, r, http.StatusPreconditionRequired, CodePreconditionRequired, err.Error()+", send it in the body or in If-Match", nil)
+	case errors.Is(err, repository.ErrTimeout):
+		log.Printf("%s %s %s: %v", RequestIDFromContext(r.Context()), r.Method, r.URL.Path, err)
+		WriteError(w, r, http.StatusGatewayTimeout, CodeTimeout, "the database did not answer in time", nil)
+	case errors.Is(err, repository.ErrForbidden):
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "forbidden", nil)
+	case errors.Is(err, repository.ErrNotFound):
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "not found", nil)
+	default:
+		log.Printf("%s %s %s: %v", RequestIDFromContext(r.Context()), r.Method, r.URL.Path, err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "internal server error", nil)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bake_backend/internal/authz"
+	"bake_backend/internal/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Report rows carry a version that is bumped on every write. It is sent as a
+// strong ETag and PUT requests must echo it in If-Match. POST takes it in the
+// body or in If-Match; without one it overwrites the row on the natural key,
+// with one the row must not have changed since.
+
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion reads the version from If-Match. A missing header is
+// answered with 428.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if strings.TrimSpace(r.Header.Get("If-Match")) == "" {
+		WriteError(w, r, http.StatusPreconditionRequired, CodePreconditionRequired, "If-Match header is required", nil)
+		return 0, false
+	}
+	return requestVersion(w, r, 0)
+}
+
+// requestVersion returns the version from If-Match, or bodyVersion when the
+// header is absent. Both may be given if they agree.
+func requestVersion(w http.ResponseWriter, r *http.Request, bodyVersion int) (int, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		return bodyVersion, true
+	}
+
+	version, err := strconv.Atoi(strings.Trim(value, `"`))
+	if err != nil || version <= 0 || !strings.HasPrefix(value, `"`) {
+		badRequest(w, r, "Invalid If-Match header, expected the ETag of the row")
+		return 0, false
+	}
+	if bodyVersion != 0 && bodyVersion != version {
+		badRequest(w, r, "If-Match does not match the version in the body")
+		return 0, false
+	}
+	return version, true
+}
+
+// writeUpdateError answers a stale If-Match with 412 and the stored row, so
+// the client can merge; other errors go to writeRepoError.
+func (h *Handler) writeUpdateError(w http.ResponseWriter, r *http.Request, entity string, err error) {
+	var stale *repository.VersionError
+	if !errors.As(err, &stale) {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	current, applyErr := h.fields.Apply(principalRole(r), entity, stale.Current)
+	if applyErr != nil {
+		writeRepoError(w, r, applyErr)
+		return
+	}
+	WriteError(w, r, http.StatusPreconditionFailed, CodeVersionMismatch, stale.Error(), map[string]interface{}{
+		"current": current,
+	})
+}
+
+func (h *Handler) GetMarketingDataByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := h.scoped(r).GetMarketingDataByID(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(data.Version))
+	h.writeData(w, r, http.StatusOK, authz.EntityMarketing, data)
+}
+
+func (h *Handler) GetSalesDataByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := h.scoped(r).GetSalesDataByID(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(data.Version))
+	h.writeData(w, r, http.StatusOK, authz.EntitySales, data)
+}
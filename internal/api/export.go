@@ -0,0 +1,456 @@
+package api
+
+import (
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	exportFormatCSV  = "csv"
+	exportFormatXLSX = "xlsx"
+	totalsLabel      = "Итого"
+	maskedValue      = "***"
+)
+
+// exportColumn.field is the JSON name of the metric, used to apply the field policy.
+type exportColumn struct {
+	header string
+	field  string
+	money  bool
+}
+
+// exportTable is a format-agnostic report: every row starts with the date and
+// the source/team name followed by the numeric metrics (int or float64).
+// Rows are not kept, they are written as they are read.
+type exportTable struct {
+	name    string
+	columns []exportColumn
+	// keep lists the columns left by restrict, by their index in a row;
+	// masked ones have their values replaced.
+	keep   []int
+	masked map[int]bool
+}
+
+func (h *Handler) ExportMarketingData(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	filter, ok := reportFilter(w, r, "source_ids")
+	if !ok {
+		return
+	}
+
+	sources, err := h.scoped(r).GetMarketingSources(r.Context(), true)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	names := make(map[int]string, len(sources))
+	for _, s := range sources {
+		names[s.ID] = s.Name
+	}
+
+	table := exportTable{
+		name: "marketing-data",
+		columns: []exportColumn{
+			{header: "Дата"},
+			{header: "Источник"},
+			{header: "Расход", field: "expense", money: true},
+			{header: "Лиды", field: "leads"},
+			{header: "Пробные назначены", field: "trials_scheduled"},
+			{header: "Пробные проведены", field: "trials_conducted"},
+			{header: "Оплаты", field: "payments"},
+			{header: "Сумма оплат", field: "total_amount", money: true},
+		},
+	}
+	table.restrict(h.fieldRules(r, authz.EntityMarketing))
+
+	export := newExportStream(w, format, exportFilename(table.name, filter.From, filter.To, format), &table)
+	defer export.close()
+
+	var total domain.MarketingData
+	err = h.scoped(r).EachMarketingData(r.Context(), filter, func(d domain.MarketingData) error {
+		total.Expense += d.Expense
+		total.Leads += d.Leads
+		total.TrialsScheduled += d.TrialsScheduled
+		total.TrialsConducted += d.TrialsConducted
+		total.Payments += d.Payments
+		total.TotalAmount += d.TotalAmount
+		return export.row([]interface{}{
+			formatExportDate(d.Date), nameOrID(names, d.SourceID),
+			d.Expense, d.Leads, d.TrialsScheduled, d.TrialsConducted, d.Payments, d.TotalAmount,
+		})
+	})
+	if err == nil {
+		err = export.finish([]interface{}{
+			totalsLabel, "",
+			total.Expense, total.Leads, total.TrialsScheduled, total.TrialsConducted, total.Payments, total.TotalAmount,
+		})
+	}
+	if err != nil {
+		export.fail(r, err)
+	}
+}
+
+func (h *Handler) ExportSalesData(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+
+	filter, ok := reportFilter(w, r, "team_ids")
+	if !ok {
+		return
+	}
+
+	teams, err := h.scoped(r).GetSalesTeams(r.Context(), "", "")
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	names := make(map[int]string, len(teams))
+	for _, t := range teams {
+		names[t.ID] = t.Name
+	}
+
+	table := exportTable{
+		name: "sales-data",
+		columns: []exportColumn{
+			{header: "Дата"},
+			{header: "Команда"},
+			{header: "Лиды", field: "leads"},
+			{header: "Пробные назначены", field: "trials_scheduled"},
+			{header: "Пробные проведены", field: "trials_conducted"},
+			{header: "Оплаты", field: "payments"},
+			{header: "Сумма оплат", field: "total_amount", money: true},
+			{header: "Возврат Kaspi", field: "kaspi_refund", money: true},
+		},
+	}
+	table.restrict(h.fieldRules(r, authz.EntitySales))
+
+	export := newExportStream(w, format, exportFilename(table.name, filter.From, filter.To, format), &table)
+	defer export.close()
+
+	var total domain.SalesData
+	err = h.scoped(r).EachSalesData(r.Context(), filter, func(d domain.SalesData) error {
+		total.Leads += d.Leads
+		total.TrialsScheduled += d.TrialsScheduled
+		total.TrialsConducted += d.TrialsConducted
+		total.Payments += d.Payments
+		total.TotalAmount += d.TotalAmount
+		total.KaspiRefund += d.KaspiRefund
+		return export.row([]interface{}{
+			formatExportDate(d.Date), nameOrID(names, d.TeamID),
+			d.Leads, d.TrialsScheduled, d.TrialsConducted, d.Payments, d.TotalAmount, d.KaspiRefund,
+		})
+	})
+	if err == nil {
+		err = export.finish([]interface{}{
+			totalsLabel, "",
+			total.Leads, total.TrialsScheduled, total.TrialsConducted, total.Payments, total.TotalAmount, total.KaspiRefund,
+		})
+	}
+	if err != nil {
+		export.fail(r, err)
+	}
+}
+
+// restrict drops hidden columns and masks the values of masked ones.
+func (t *exportTable) restrict(rules map[string]string) {
+	t.keep = make([]int, 0, len(t.columns))
+	t.masked = make(map[int]bool)
+	var columns []exportColumn
+	for i, c := range t.columns {
+		switch rules[c.field] {
+		case authz.FieldHide:
+			continue
+		case authz.FieldMask:
+			c.money = false
+			t.masked[i] = true
+		}
+		t.keep = append(t.keep, i)
+		columns = append(columns, c)
+	}
+	t.columns = columns
+}
+
+// project returns the cells of row left by restrict.
+func (t *exportTable) project(row []interface{}) []interface{} {
+	out := make([]interface{}, len(t.keep))
+	for j, i := range t.keep {
+		out[j] = row[i]
+		if t.masked[i] {
+			out[j] = maskedValue
+		}
+	}
+	return out
+}
+
+func exportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatXLSX {
+		badRequest(w, r, "Invalid format, expected csv or xlsx")
+		return "", false
+	}
+	return format, true
+}
+
+func exportFilename(name, from, to, format string) string {
+	parts := []string{name}
+	if from != "" {
+		parts = append(parts, from)
+	}
+	if to != "" {
+		parts = append(parts, to)
+	}
+	return strings.Join(parts, "_") + "." + format
+}
+
+func formatExportDate(date string) string {
+	t, err := dateutil.ParseDate(date)
+	if err != nil {
+		return date
+	}
+	return dateutil.FormatDate(t)
+}
+
+// nameOrID falls back to the numeric ID so rows referencing unknown
+// sources/teams are still exported.
+func nameOrID(names map[int]string, id int) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return strconv.Itoa(id)
+}
+
+// exportSink writes the rows of one file format.
+type exportSink interface {
+	writeRow(row []interface{}, bold bool) error
+	// flush completes the file.
+	flush() error
+	close() error
+}
+
+// exportStream writes a table row by row as the repository reads it. A
+// failure before anything reached the client is still answered with a JSON
+// error; after that the client gets a truncated file.
+type exportStream struct {
+	w        *countingWriter
+	format   string
+	filename string
+	table    *exportTable
+	sink     exportSink
+}
+
+func newExportStream(w http.ResponseWriter, format, filename string, table *exportTable) *exportStream {
+	return &exportStream{w: &countingWriter{ResponseWriter: w}, format: format, filename: filename, table: table}
+}
+
+func (s *exportStream) row(row []interface{}) error {
+	return s.write(row, false)
+}
+
+// finish writes the totals row and completes the file.
+func (s *exportStream) finish(totals []interface{}) error {
+	if err := s.write(totals, true); err != nil {
+		return err
+	}
+	return s.sink.flush()
+}
+
+func (s *exportStream) write(row []interface{}, bold bool) error {
+	if s.sink == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	return s.sink.writeRow(s.table.project(row), bold)
+}
+
+func (s *exportStream) start() error {
+	header := s.w.Header()
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.filename))
+
+	var err error
+	if s.format == exportFormatXLSX {
+		header.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		s.sink, err = newXLSXSink(s.w, s.table.columns)
+	} else {
+		header.Set("Content-Type", "text/csv; charset=utf-8")
+		s.sink, err = newCSVSink(s.w, s.table.columns)
+	}
+	return err
+}
+
+func (s *exportStream) fail(r *http.Request, err error) {
+	if s.w.written == 0 {
+		s.w.Header().Del("Content-Disposition")
+		writeRepoError(s.w.ResponseWriter, r, err)
+		return
+	}
+	log.Printf("export %s failed: %v", s.filename, err)
+}
+
+func (s *exportStream) close() {
+	if s.sink != nil {
+		s.sink.close()
+	}
+}
+
+// countingWriter records how much of the response has been sent.
+type countingWriter struct {
+	http.ResponseWriter
+	written int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += n
+	return n, err
+}
+
+// csvSink writes the table the way Excel with a Russian locale expects it:
+// UTF-8 BOM, semicolon separator and a decimal comma.
+type csvSink struct {
+	cw *csv.Writer
+}
+
+func newCSVSink(w io.Writer, columns []exportColumn) (*csvSink, error) {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return nil, err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	headers := make([]string, len(columns))
+	for i, c := range columns {
+		headers[i] = c.header
+	}
+	if err := cw.Write(headers); err != nil {
+		return nil, err
+	}
+	return &csvSink{cw: cw}, nil
+}
+
+func (s *csvSink) writeRow(row []interface{}, bold bool) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		record[i] = formatCSVValue(v)
+	}
+	return s.cw.Write(record)
+}
+
+func (s *csvSink) flush() error {
+	s.cw.Flush()
+	return s.cw.Error()
+}
+
+func (s *csvSink) close() error {
+	return nil
+}
+
+func formatCSVValue(v interface{}) string {
+	switch val := v.(type) {
+	case float64:
+		return strings.Replace(strconv.FormatFloat(val, 'f', 2, 64), ".", ",", 1)
+	case int:
+		return strconv.Itoa(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// xlsxSink writes rows with excelize's stream writer, which moves them to a
+// temporary file once they outgrow its buffer. The workbook can only be
+// sent once complete, by flush.
+type xlsxSink struct {
+	w       io.Writer
+	f       *excelize.File
+	sw      *excelize.StreamWriter
+	columns []exportColumn
+	rowNum  int
+
+	moneyStyle, boldStyle, boldMoneyStyle int
+}
+
+func newXLSXSink(w io.Writer, columns []exportColumn) (_ *xlsxSink, err error) {
+	s := &xlsxSink{w: w, f: excelize.NewFile(), columns: columns, rowNum: 1}
+	defer func() {
+		if err != nil {
+			s.f.Close()
+		}
+	}()
+
+	if s.sw, err = s.f.NewStreamWriter(s.f.GetSheetName(0)); err != nil {
+		return nil, err
+	}
+
+	moneyFormat := "#,##0.00"
+	if s.moneyStyle, err = s.f.NewStyle(&excelize.Style{CustomNumFmt: &moneyFormat}); err != nil {
+		return nil, err
+	}
+	if s.boldStyle, err = s.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}}); err != nil {
+		return nil, err
+	}
+	if s.boldMoneyStyle, err = s.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}, CustomNumFmt: &moneyFormat}); err != nil {
+		return nil, err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, c := range columns {
+		header[i] = excelize.Cell{StyleID: s.boldStyle, Value: c.header}
+	}
+	if err := s.sw.SetRow("A1", header); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *xlsxSink) writeRow(row []interface{}, bold bool) error {
+	s.rowNum++
+	cells := make([]interface{}, len(row))
+	for i, v := range row {
+		style := 0
+		switch {
+		case s.columns[i].money && bold:
+			style = s.boldMoneyStyle
+		case s.columns[i].money:
+			style = s.moneyStyle
+		case bold:
+			style = s.boldStyle
+		}
+		cells[i] = excelize.Cell{StyleID: style, Value: v}
+	}
+	cell, err := excelize.CoordinatesToCellName(1, s.rowNum)
+	if err != nil {
+		return err
+	}
+	return s.sw.SetRow(cell, cells)
+}
+
+func (s *xlsxSink) flush() error {
+	if err := s.sw.Flush(); err != nil {
+		return err
+	}
+	return s.f.Write(s.w)
+}
+
+func (s *xlsxSink) close() error {
+	return s.f.Close()
+}
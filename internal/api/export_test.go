@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bake_backend/internal/domain"
+	"bake_backend/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// failingExport is a store whose marketing export breaks after failAfter rows.
+type failingExport struct {
+	*repository.MemoryRepository
+	failAfter int
+}
+
+func (r *failingExport) EachMarketingData(ctx context.Context, filter domain.ReportFilter, fn func(domain.MarketingData) error) error {
+	n := 0
+	return r.MemoryRepository.EachMarketingData(ctx, filter, func(d domain.MarketingData) error {
+		if n == r.failAfter {
+			return errors.New("connection reset")
+		}
+		n++
+		return fn(d)
+	})
+}
+
+func TestExportStreamsRows(t *testing.T) {
+	repo := &failingExport{MemoryRepository: repository.NewMemoryRepository(), failAfter: -1}
+	s := newTestServer(t, repo)
+	for day := 10; day < 13; day++ {
+		s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow(fmt.Sprintf("2026-01-%d", day), 1, 10))
+	}
+
+	for _, format := range []string{exportFormatCSV, exportFormatXLSX} {
+		t.Run(format+" failing before the first row", func(t *testing.T) {
+			repo.failAfter = 0
+			rec := s.expect(http.StatusInternalServerError, admin, "GET", "/api/reports/marketing-data/export?format="+format, nil)
+			if code := errorCode(t, rec); code != CodeInternal {
+				t.Errorf("code %q, want %q", code, CodeInternal)
+			}
+			if rec.Header().Get("Content-Disposition") != "" {
+				t.Errorf("error answered as an attachment")
+			}
+		})
+	}
+
+	t.Run("csv failing midway", func(t *testing.T) {
+		// What was sent cannot be taken back, the file ends without totals
+		repo.failAfter = 2
+		rec := s.expect(http.StatusOK, admin, "GET", "/api/reports/marketing-data/export", nil)
+		if strings.Contains(rec.Body.String(), totalsLabel) {
+			t.Errorf("truncated export has totals:\n%s", rec.Body.String())
+		}
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		repo.failAfter = -1
+		rec := s.expect(http.StatusOK, admin, "GET", "/api/reports/marketing-data/export", nil)
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if len(lines) != 5 || !strings.HasPrefix(lines[4], totalsLabel+";;30,00;30;") {
+			t.Errorf("export:\n%s", rec.Body.String())
+		}
+	})
+}
@@ -1,42 +1,126 @@
 package api
 
 import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/authz"
 	"bake_backend/internal/domain"
+	"bake_backend/internal/validation"
+	dateutil "bake_backend/pkg"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type Repository interface {
-	GetMarketingSources() ([]domain.MarketingSource, error)
-	GetSalesTeams() ([]domain.SalesTeam, error)
-	GetMarketingData(from, to string, sourceIDs []string) ([]domain.MarketingData, error)
-	GetSalesData(from, to string, teamIDs []string) ([]domain.SalesData, error)
-	SaveMarketingData(data *domain.MarketingData) error
-	SaveSalesData(data *domain.SalesData) error
-	UpdateMarketingData(data *domain.MarketingData) error
-	UpdateSalesData(data *domain.SalesData) error
-	GetAvailableDates() ([]string, error)
-	GetAvailableMarketingDates() ([]string, error)
-	GetAvailableSalesDates() ([]string, error)
+	GetMarketingSources(ctx context.Context, includeArchived bool) ([]domain.MarketingSource, error)
+	CreateMarketingSource(ctx context.Context, source *domain.MarketingSource) error
+	RenameMarketingSource(ctx context.Context, id int, name string) error
+	ArchiveMarketingSource(ctx context.Context, id int) error
+	RestoreMarketingSource(ctx context.Context, id int) error
+	ReorderMarketingSources(ctx context.Context, ids []int) error
+	DeleteMarketingSource(ctx context.Context, id int) error
+	GetSalesTeams(ctx context.Context, from, to string) ([]domain.SalesTeam, error)
+	CreateSalesTeam(ctx context.Context, team *domain.SalesTeam) error
+	UpdateSalesTeam(ctx context.Context, team *domain.SalesTeam) error
+	DeleteSalesTeam(ctx context.Context, id int) error
+	GetMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error)
+	GetSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error)
+	EachMarketingData(ctx context.Context, filter domain.ReportFilter, fn func(domain.MarketingData) error) error
+	EachSalesData(ctx context.Context, filter domain.ReportFilter, fn func(domain.SalesData) error) error
+	GetMarketingDataByID(ctx context.Context, id int) (*domain.MarketingData, error)
+	GetSalesDataByID(ctx context.Context, id int) (*domain.SalesData, error)
+	GetMarketingFunnel(ctx context.Context, filter domain.ReportFilter) (*domain.MarketingFunnel, error)
+	GetMarketingSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) ([]domain.MarketingSummary, error)
+	GetSalesSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) ([]domain.SalesSummary, error)
+	SaveMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (bool, error)
+	SaveSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (bool, error)
+	UpdateMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) error
+	UpdateSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) error
+	DeleteMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error
+	DeleteSalesData(ctx context.Context, id int, meta domain.AuditMeta) error
+	RestoreMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error
+	RestoreSalesData(ctx context.Context, id int, meta domain.AuditMeta) error
+	ChangeMarketingStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) ([]domain.MarketingData, error)
+	ChangeSalesStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) ([]domain.SalesData, error)
+	GetDeletedMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error)
+	GetDeletedSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error)
+	ImportMarketingData(ctx context.Context, rows []domain.MarketingData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error)
+	ImportSalesData(ctx context.Context, rows []domain.SalesData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error)
+	SaveDailyBatch(ctx context.Context, batch *domain.DailyBatch, meta domain.AuditMeta) ([]domain.BatchRowError, error)
+	GetAuditLog(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, error)
+	GetPeriodLocks(ctx context.Context, includeReopened bool) ([]domain.PeriodLock, error)
+	ClosePeriod(ctx context.Context, lock *domain.PeriodLock, meta domain.AuditMeta) error
+	ReopenPeriod(ctx context.Context, id int, reason string, meta domain.AuditMeta) (*domain.PeriodLock, error)
+	GetAvailableDates(ctx context.Context) ([]string, error)
+	GetAvailableMarketingDates(ctx context.Context) ([]string, error)
+	GetAvailableSalesDates(ctx context.Context) ([]string, error)
 }
 
 type Handler struct {
-	repo Repository
+	repo           Repository
+	auth           *auth.Service
+	fields         authz.FieldPolicy
+	validationMode string
+	location       *time.Location
 }
 
-func NewHandler(repo Repository) *Handler {
-	return &Handler{repo: repo}
+// NewHandler returns the report handlers. loc is the business time zone
+// dates are validated in.
+func NewHandler(repo Repository, authService *auth.Service, fields authz.FieldPolicy, validationMode string, loc *time.Location) *Handler {
+	return &Handler{repo: repo, auth: authService, fields: fields, validationMode: validationMode, location: loc}
+}
+
+// scoped returns the repository as seen by the caller of r, with role and
+// team restrictions applied.
+func (h *Handler) scoped(r *http.Request) Repository {
+	return authz.New(h.repo, auth.PrincipalFromContext(r.Context()))
+}
+
+// validator returns a validator for the rows of one request.
+func (h *Handler) validator(r *http.Request) *validation.Validator {
+	return validation.New(h.validationMode, h.location, h.scoped(r))
+}
+
+// writeWarnings adds a Warning header per validation warning of a saved row.
+func writeWarnings(w http.ResponseWriter, warnings []domain.FieldError) {
+	for _, p := range warnings {
+		w.Header().Add("Warning", fmt.Sprintf("299 - %s", strconv.Quote(p.Field+": "+p.Message)))
+	}
+}
+
+// fieldRules returns the caller's field restrictions for an entity.
+func (h *Handler) fieldRules(r *http.Request, entity string) map[string]string {
+	return h.fields.Rules(principalRole(r), entity)
+}
+
+// writeData writes report data with the caller's field policy applied.
+func (h *Handler) writeData(w http.ResponseWriter, r *http.Request, status int, entity string, v interface{}) {
+	out, err := h.fields.Apply(principalRole(r), entity, v)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	writeJSON(w, status, out)
+}
+
+func principalRole(r *http.Request) string {
+	if p := auth.PrincipalFromContext(r.Context()); p != nil {
+		return p.Role
+	}
+	return ""
 }
 
 // Новый метод для получения доступных дат
 func (h *Handler) GetAvailableDates(w http.ResponseWriter, r *http.Request) {
-	dates, err := h.repo.GetAvailableDates()
+	dates, err := h.scoped(r).GetAvailableDates(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeRepoError(w, r, err)
 		return
 	}
 
@@ -45,9 +129,11 @@ func (h *Handler) GetAvailableDates(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetMarketingSources(w http.ResponseWriter, r *http.Request) {
-	sources, err := h.repo.GetMarketingSources()
+	includeArchived, _ := strconv.ParseBool(r.URL.Query().Get("include_archived"))
+
+	sources, err := h.scoped(r).GetMarketingSources(r.Context(), includeArchived)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeRepoError(w, r, err)
 		return
 	}
 
@@ -56,9 +142,21 @@ func (h *Handler) GetMarketingSources(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetSalesTeams(w http.ResponseWriter, r *http.Request) {
-	teams, err := h.repo.GetSalesTeams()
+	// ?date= or ?from=&to= limits the list to teams active in that window
+	from, to, ok := dateRange(w, r)
+	if !ok {
+		return
+	}
+	if date := r.URL.Query().Get("date"); date != "" {
+		if from, ok = queryDate(w, r, "date", date); !ok {
+			return
+		}
+		to = from
+	}
+
+	teams, err := h.scoped(r).GetSalesTeams(r.Context(), from, to)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeRepoError(w, r, err)
 		return
 	}
 
@@ -67,121 +165,298 @@ func (h *Handler) GetSalesTeams(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetMarketingData(w http.ResponseWriter, r *http.Request) {
-	from := r.URL.Query().Get("from")
-	to := r.URL.Query().Get("to")
-	sourceIDsParam := r.URL.Query().Get("source_ids")
+	filter, ok := reportFilter(w, r, "source_ids")
+	if !ok {
+		return
+	}
+
+	// group_by switches the endpoint to zero-filled per-bucket summaries
+	if groupBy := r.URL.Query().Get("group_by"); groupBy != "" {
+		if !domain.IsValidGroupBy(groupBy) {
+			badRequest(w, r, "Invalid group_by, expected day, week, month or quarter")
+			return
+		}
+
+		summaries, err := h.scoped(r).GetMarketingSummary(r.Context(), filter, groupBy)
+		if err != nil {
+			writeRepoError(w, r, err)
+			return
+		}
 
-	var sourceIDs []string
-	if sourceIDsParam != "" {
-		sourceIDs = strings.Split(sourceIDsParam, ",")
+		h.writeData(w, r, http.StatusOK, authz.EntityMarketing, summaries)
+		return
 	}
 
-	data, err := h.repo.GetMarketingData(from, to, sourceIDs)
+	data, err := h.scoped(r).GetMarketingData(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeRepoError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	h.writeData(w, r, http.StatusOK, authz.EntityMarketing, data)
+}
+
+// GetMarketingFunnel returns per-source and overall funnel KPIs (CPL, conversions, ROMI).
+func (h *Handler) GetMarketingFunnel(w http.ResponseWriter, r *http.Request) {
+	filter, ok := reportFilter(w, r, "source_ids")
+	if !ok {
+		return
+	}
+
+	funnel, err := h.scoped(r).GetMarketingFunnel(r.Context(), filter)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	h.writeData(w, r, http.StatusOK, authz.EntityMarketing, funnel)
 }
 
 func (h *Handler) GetSalesData(w http.ResponseWriter, r *http.Request) {
-	from := r.URL.Query().Get("from")
-	to := r.URL.Query().Get("to")
-	teamIDsParam := r.URL.Query().Get("team_ids")
+	filter, ok := reportFilter(w, r, "team_ids")
+	if !ok {
+		return
+	}
 
-	var teamIDs []string
-	if teamIDsParam != "" {
-		teamIDs = strings.Split(teamIDsParam, ",")
+	if groupBy := r.URL.Query().Get("group_by"); groupBy != "" {
+		if !domain.IsValidGroupBy(groupBy) {
+			badRequest(w, r, "Invalid group_by, expected day, week, month or quarter")
+			return
+		}
+
+		summaries, err := h.scoped(r).GetSalesSummary(r.Context(), filter, groupBy)
+		if err != nil {
+			writeRepoError(w, r, err)
+			return
+		}
+
+		h.writeData(w, r, http.StatusOK, authz.EntitySales, summaries)
+		return
 	}
 
-	data, err := h.repo.GetSalesData(from, to, teamIDs)
+	data, err := h.scoped(r).GetSalesData(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeRepoError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	h.writeData(w, r, http.StatusOK, authz.EntitySales, data)
 }
 
 func (h *Handler) SaveMarketingData(w http.ResponseWriter, r *http.Request) {
 	var data domain.MarketingData
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		badRequest(w, r, err.Error())
+		return
+	}
+	version, ok := requestVersion(w, r, data.Version)
+	if !ok {
 		return
 	}
+	data.Version = version
 
-	if err := h.repo.SaveMarketingData(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	checked, err := h.validator(r).Marketing(r.Context(), &data)
+	if err == nil {
+		err = checked.Err()
+	}
+	if err != nil {
+		writeRepoError(w, r, err)
 		return
 	}
+	writeWarnings(w, checked.Warnings)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	created, err := h.scoped(r).SaveMarketingData(r.Context(), &data, auditMeta(r))
+	if err != nil {
+		h.writeUpdateError(w, r, authz.EntityMarketing, err)
+		return
+	}
+	w.Header().Set("ETag", etag(data.Version))
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.writeData(w, r, status, authz.EntityMarketing, data)
 }
 
 func (h *Handler) SaveSalesData(w http.ResponseWriter, r *http.Request) {
 	var data domain.SalesData
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		badRequest(w, r, err.Error())
+		return
+	}
+	version, ok := requestVersion(w, r, data.Version)
+	if !ok {
 		return
 	}
+	data.Version = version
 
-	if err := h.repo.SaveSalesData(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	checked, err := h.validator(r).Sales(r.Context(), &data)
+	if err == nil {
+		err = checked.Err()
+	}
+	if err != nil {
+		writeRepoError(w, r, err)
 		return
 	}
+	writeWarnings(w, checked.Warnings)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	created, err := h.scoped(r).SaveSalesData(r.Context(), &data, auditMeta(r))
+	if err != nil {
+		h.writeUpdateError(w, r, authz.EntitySales, err)
+		return
+	}
+	w.Header().Set("ETag", etag(data.Version))
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.writeData(w, r, status, authz.EntitySales, data)
 }
 
 func (h *Handler) UpdateMarketingData(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid ID")
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
 		return
 	}
 
 	var data domain.MarketingData
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	checked, err := h.validator(r).Marketing(r.Context(), &data)
+	if err == nil {
+		err = checked.Err()
+	}
+	if err != nil {
+		writeRepoError(w, r, err)
 		return
 	}
+	writeWarnings(w, checked.Warnings)
 
 	data.ID = id
-	if err := h.repo.UpdateMarketingData(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	data.Version = version
+	if err := h.scoped(r).UpdateMarketingData(r.Context(), &data, auditMeta(r)); err != nil {
+		h.writeUpdateError(w, r, authz.EntityMarketing, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	w.Header().Set("ETag", etag(data.Version))
+	h.writeData(w, r, http.StatusOK, authz.EntityMarketing, data)
 }
 
 func (h *Handler) UpdateSalesData(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid ID")
+		return
+	}
+
+	version, ok := ifMatchVersion(w, r)
+	if !ok {
 		return
 	}
 
 	var data domain.SalesData
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		badRequest(w, r, err.Error())
 		return
 	}
 
+	checked, err := h.validator(r).Sales(r.Context(), &data)
+	if err == nil {
+		err = checked.Err()
+	}
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	writeWarnings(w, checked.Warnings)
+
 	data.ID = id
-	if err := h.repo.UpdateSalesData(&data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	data.Version = version
+	if err := h.scoped(r).UpdateSalesData(r.Context(), &data, auditMeta(r)); err != nil {
+		h.writeUpdateError(w, r, authz.EntitySales, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(data.Version))
+	h.writeData(w, r, http.StatusOK, authz.EntitySales, data)
+}
+
+// pathID parses the {id} route variable, answering 400 when it is not a number.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		badRequest(w, r, "Invalid ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// reportFilter reads from, to, status and the comma-separated ID list named
+// idsParam, answering 400 on an unknown status.
+func reportFilter(w http.ResponseWriter, r *http.Request, idsParam string) (domain.ReportFilter, bool) {
+	q := r.URL.Query()
+	filter := domain.ReportFilter{Status: q.Get("status")}
+	var ok bool
+	if filter.From, filter.To, ok = dateRange(w, r); !ok {
+		return filter, false
+	}
+	if ids := q.Get(idsParam); ids != "" {
+		filter.IDs = strings.Split(ids, ",")
+	}
+
+	if filter.Status != "" && !domain.IsValidStatus(filter.Status) {
+		badRequest(w, r, "Invalid status, expected draft, submitted, approved or rejected")
+		return filter, false
+	}
+	return filter, true
+}
+
+// dateRange reads the optional ?from= and ?to= bounds as YYYY-MM-DD. A
+// malformed date or from after to is answered with 400 here, before the
+// backends disagree on how to report it.
+func dateRange(w http.ResponseWriter, r *http.Request) (from, to string, ok bool) {
+	q := r.URL.Query()
+	if from, ok = queryDate(w, r, "from", q.Get("from")); !ok {
+		return "", "", false
+	}
+	if to, ok = queryDate(w, r, "to", q.Get("to")); !ok {
+		return "", "", false
+	}
+	if from != "" && to != "" && from > to {
+		badRequest(w, r, "Invalid date range, from is after to")
+		return "", "", false
+	}
+	return from, to, true
+}
+
+func queryDate(w http.ResponseWriter, r *http.Request, name, value string) (string, bool) {
+	if value == "" {
+		return "", true
+	}
+	t, err := dateutil.ParseDate(value)
+	if err != nil {
+		badRequest(w, r, "Invalid "+name+": "+err.Error()+", expected YYYY-MM-DD")
+		return "", false
+	}
+	return t.Format(dateutil.ISOLayout), true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
@@ -0,0 +1,701 @@
+package api
+
+import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	"bake_backend/internal/repository"
+	"bake_backend/internal/seed"
+	"bake_backend/internal/validation"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	teamOne = 1
+
+	admin     = &auth.Principal{UserID: 1, Username: "admin", Role: domain.RoleAdmin}
+	marketer  = &auth.Principal{UserID: 2, Username: "marketer", Role: domain.RoleMarketer}
+	salesLead = &auth.Principal{UserID: 3, Username: "lead", Role: domain.RoleSalesLead, TeamID: &teamOne}
+	salesHead = &auth.Principal{UserID: 4, Username: "head", Role: domain.RoleSalesHead}
+)
+
+// testServer drives the handlers the way cmd/api wires them, with the
+// caller put in the context instead of a token.
+type testServer struct {
+	t      *testing.T
+	router *mux.Router
+}
+
+// newTestServer serves repo, seeded with the prod profile: sources 1-9 and
+// teams 1-6.
+func newTestServer(t *testing.T, repo Repository) *testServer {
+	t.Helper()
+	return newPolicyTestServer(t, repo, authz.DefaultFieldPolicy())
+}
+
+// newPolicyTestServer is newTestServer with the field policy fields.
+func newPolicyTestServer(t *testing.T, repo Repository, fields authz.FieldPolicy) *testServer {
+	t.Helper()
+	if _, err := seed.Run(context.Background(), repo, seed.ProfileProd); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	h := NewHandler(repo, nil, fields, validation.ModeStrict, time.UTC)
+	r := mux.NewRouter()
+	r.HandleFunc("/api/reports/marketing-sources", h.CreateMarketingSource).Methods("POST")
+	r.HandleFunc("/api/reports/marketing-data", h.GetMarketingData).Methods("GET")
+	r.HandleFunc("/api/reports/sales-data", h.GetSalesData).Methods("GET")
+	r.HandleFunc("/api/reports/marketing-funnel", h.GetMarketingFunnel).Methods("GET")
+	r.HandleFunc("/api/reports/marketing-data/export", h.ExportMarketingData).Methods("GET")
+	r.HandleFunc("/api/reports/sales-data/export", h.ExportSalesData).Methods("GET")
+	r.HandleFunc("/api/reports/marketing-data", h.SaveMarketingData).Methods("POST")
+	r.HandleFunc("/api/reports/sales-data", h.SaveSalesData).Methods("POST")
+	r.HandleFunc("/api/reports/marketing-data/import", h.ImportMarketingData).Methods("POST")
+	r.HandleFunc("/api/reports/sales-data/import", h.ImportSalesData).Methods("POST")
+	r.HandleFunc("/api/reports/daily-batch", h.SaveDailyBatch).Methods("POST")
+	r.HandleFunc("/api/reports/marketing-data/{id:[0-9]+}", h.GetMarketingDataByID).Methods("GET")
+	r.HandleFunc("/api/reports/sales-data/{id:[0-9]+}", h.GetSalesDataByID).Methods("GET")
+	r.HandleFunc("/api/reports/marketing-data/{id}", h.UpdateMarketingData).Methods("PUT")
+	r.HandleFunc("/api/reports/sales-data/{id}", h.UpdateSalesData).Methods("PUT")
+	r.HandleFunc("/api/reports/marketing-data/status", h.ChangeMarketingStatus).Methods("POST")
+	r.HandleFunc("/api/reports/sales-data/status", h.ChangeSalesStatus).Methods("POST")
+	r.HandleFunc("/api/reports/marketing-data/deleted", h.GetDeletedMarketingData).Methods("GET")
+	r.HandleFunc("/api/reports/sales-data/deleted", h.GetDeletedSalesData).Methods("GET")
+	r.HandleFunc("/api/reports/marketing-data/{id:[0-9]+}", h.DeleteMarketingData).Methods("DELETE")
+	r.HandleFunc("/api/reports/sales-data/{id:[0-9]+}", h.DeleteSalesData).Methods("DELETE")
+	r.HandleFunc("/api/reports/marketing-data/{id:[0-9]+}/restore", h.RestoreMarketingData).Methods("POST")
+	r.HandleFunc("/api/reports/sales-data/{id:[0-9]+}/restore", h.RestoreSalesData).Methods("POST")
+	r.HandleFunc("/api/periods/close", h.ClosePeriod).Methods("POST")
+	return &testServer{t: t, router: r}
+}
+
+// do sends a request as p. body is sent as is when it is a string or
+// []byte and as JSON otherwise; headers are name, value pairs.
+func (s *testServer) do(p *auth.Principal, method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encode body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect sends a request and fails the test unless it is answered with status.
+func (s *testServer) expect(status int, p *auth.Principal, method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	rec := s.do(p, method, path, body, headers...)
+	if rec.Code != status {
+		s.t.Fatalf("%s %s: got %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var e errorResponse
+	decode(t, rec, &e)
+	return e.Code
+}
+
+func marketingRow(date string, sourceID int, expense float64) map[string]interface{} {
+	return map[string]interface{}{"date": date, "source_id": sourceID, "expense": expense, "leads": 10, "trials_scheduled": 5}
+}
+
+func salesRow(date string, teamID, leads int) map[string]interface{} {
+	return map[string]interface{}{"date": date, "team_id": teamID, "leads": leads, "total_amount": 1000}
+}
+
+func TestSaveMarketingDataCreatesThenUpdates(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+
+	rec := s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100.555))
+	var created domain.MarketingData
+	decode(t, rec, &created)
+	if created.ID == 0 || created.Version != 1 || created.Status != domain.StatusDraft {
+		t.Fatalf("created row: %+v", created)
+	}
+	if created.Expense != 100.56 {
+		t.Errorf("expense was stored as %v, want 100.56", created.Expense)
+	}
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Errorf("timestamps missing: %+v", created)
+	}
+	if got := rec.Header().Get("ETag"); got != `"1"` {
+		t.Errorf("ETag %s, want \"1\"", got)
+	}
+
+	row := marketingRow("2026-01-15", 1, 200)
+	row["version"] = 1
+	rec = s.expect(http.StatusOK, marketer, "POST", "/api/reports/marketing-data", row)
+	var updated domain.MarketingData
+	decode(t, rec, &updated)
+	if updated.ID != created.ID || updated.Version != 2 || updated.Expense != 200 {
+		t.Fatalf("updated row: %+v", updated)
+	}
+}
+
+func TestSaveMarketingDataValidation(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+
+	tests := []struct {
+		name  string
+		row   map[string]interface{}
+		field string
+	}{
+		{"missing source", marketingRow("2026-01-15", 0, 1), "source_id"},
+		{"unknown source", marketingRow("2026-01-15", 99, 1), "source_id"},
+		{"negative expense", marketingRow("2026-01-15", 1, -5), "expense"},
+		{"bad date", marketingRow("2026-13-40", 1, 1), "date"},
+		{"future date", marketingRow(time.Now().AddDate(0, 0, 2).Format("2006-01-02"), 1, 1), "date"},
+		{"funnel inversion", map[string]interface{}{"date": "2026-01-15", "source_id": 1, "leads": 1, "trials_scheduled": 5}, "trials_scheduled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(marketer, "POST", "/api/reports/marketing-data", tt.row)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got %d, want 422: %s", rec.Code, rec.Body.String())
+			}
+			var e struct {
+				Code    string `json:"code"`
+				Details struct {
+					Fields []domain.FieldError `json:"fields"`
+				} `json:"details"`
+			}
+			decode(t, rec, &e)
+			if e.Code != CodeValidation {
+				t.Errorf("code %q, want %q", e.Code, CodeValidation)
+			}
+			var found bool
+			for _, f := range e.Details.Fields {
+				found = found || f.Field == tt.field
+			}
+			if !found {
+				t.Errorf("no error for %s in %s", tt.field, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestVersionChecks(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+	rec := s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100))
+	var row domain.MarketingData
+	decode(t, rec, &row)
+	path := fmt.Sprintf("/api/reports/marketing-data/%d", row.ID)
+
+	// Saves on the natural key without a version stay idempotent
+	rec = s.expect(http.StatusOK, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 150))
+	decode(t, rec, &row)
+	if row.Version != 2 || row.Expense != 150 {
+		t.Errorf("upsert without a version: %+v", row)
+	}
+	batch := map[string]interface{}{"date": "2026-01-15", "marketing": []interface{}{marketingRow("2026-01-15", 1, 150)}}
+	s.expect(http.StatusOK, marketer, "POST", "/api/reports/daily-batch", batch)
+
+	// Updates by ID need the version: POST naming the row, PUT without
+	// If-Match, and If-Match * which used to skip the check
+	withID := marketingRow("2026-01-15", 1, 150)
+	withID["id"] = row.ID
+	rec = s.expect(http.StatusPreconditionRequired, marketer, "POST", "/api/reports/marketing-data", withID)
+	if code := errorCode(t, rec); code != CodePreconditionRequired {
+		t.Errorf("code %q, want %q", code, CodePreconditionRequired)
+	}
+	s.expect(http.StatusPreconditionRequired, marketer, "PUT", path, marketingRow("2026-01-15", 1, 150))
+	s.expect(http.StatusBadRequest, marketer, "PUT", path, marketingRow("2026-01-15", 1, 150), "If-Match", "*")
+
+	// A stale version gets 412 and the stored row to merge with
+	s.expect(http.StatusOK, marketer, "PUT", path, marketingRow("2026-01-15", 1, 150), "If-Match", `"3"`)
+	rec = s.expect(http.StatusPreconditionFailed, marketer, "PUT", path, marketingRow("2026-01-15", 1, 175), "If-Match", `"3"`)
+	var stale struct {
+		Code    string `json:"code"`
+		Details struct {
+			Current domain.MarketingData `json:"current"`
+		} `json:"details"`
+	}
+	decode(t, rec, &stale)
+	if stale.Code != CodeVersionMismatch || stale.Details.Current.Version != 4 || stale.Details.Current.Expense != 150 {
+		t.Errorf("412 answer: %s", rec.Body.String())
+	}
+	withID["version"] = 1
+	s.expect(http.StatusPreconditionFailed, marketer, "POST", "/api/reports/marketing-data", withID)
+	delete(withID, "id")
+	s.expect(http.StatusPreconditionFailed, marketer, "POST", "/api/reports/marketing-data", withID)
+	staleRow := marketingRow("2026-01-15", 1, 150)
+	staleRow["version"] = 1
+	batch["marketing"] = []interface{}{staleRow}
+	rec = s.expect(http.StatusPreconditionFailed, marketer, "POST", "/api/reports/daily-batch", batch)
+	var result domain.DailyBatchResult
+	decode(t, rec, &result)
+	if len(result.Errors) != 1 || result.Errors[0].Code != domain.BatchCodeVersionMismatch {
+		t.Errorf("batch errors: %+v", result.Errors)
+	}
+
+	// Body and If-Match must agree
+	withID["id"] = row.ID
+	withID["version"] = 4
+	s.expect(http.StatusBadRequest, marketer, "POST", "/api/reports/marketing-data", withID, "If-Match", `"5"`)
+	s.expect(http.StatusOK, marketer, "POST", "/api/reports/marketing-data", withID, "If-Match", `"4"`)
+}
+
+func TestConflicts(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+
+	rec := s.expect(http.StatusConflict, admin, "POST", "/api/reports/marketing-sources", map[string]string{"name": "Instagram"})
+	if code := errorCode(t, rec); code != CodeConflict {
+		t.Errorf("duplicate source: code %q, want %q", code, CodeConflict)
+	}
+
+	s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100))
+	s.expect(http.StatusOK, marketer, "POST", "/api/reports/marketing-data/status", map[string]string{"date": "2026-01-15", "action": "submit"})
+	rec = s.expect(http.StatusConflict, marketer, "PUT", "/api/reports/marketing-data/1", marketingRow("2026-01-15", 1, 150), "If-Match", `"2"`)
+	if code := errorCode(t, rec); code != CodeInvalidStatus {
+		t.Errorf("editing a submitted row: code %q, want %q", code, CodeInvalidStatus)
+	}
+	// Submitting again is not a transition from submitted
+	s.expect(http.StatusConflict, marketer, "POST", "/api/reports/marketing-data/status", map[string]string{"date": "2026-01-15", "action": "submit"})
+}
+
+func TestDateRangeIsChecked(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+	s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100))
+
+	for _, path := range []string{
+		"/api/reports/marketing-data?from=2026-13-01",
+		"/api/reports/marketing-data?to=yesterday",
+		"/api/reports/marketing-data?from=2026-02-01&to=2026-01-01",
+		"/api/reports/marketing-funnel?from=2026-01-32",
+		"/api/reports/sales-data?group_by=month&to=2026-02-30",
+		"/api/reports/marketing-data/export?from=2026-1-1",
+		"/api/reports/marketing-data/deleted?to=31.02.2026",
+	} {
+		rec := s.do(admin, "GET", path, nil)
+		if rec.Code != http.StatusBadRequest || errorCode(t, rec) != CodeBadRequest {
+			t.Errorf("%s: got %d %s, want 400", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Dates in the other accepted layouts are normalized
+	rec := s.expect(http.StatusOK, admin, "GET", "/api/reports/marketing-data?from=15.01.2026&to=15.01.2026", nil)
+	var rows []domain.MarketingData
+	decode(t, rec, &rows)
+	if len(rows) != 1 {
+		t.Errorf("got %d rows, want 1", len(rows))
+	}
+}
+
+func TestClosedPeriodIsLocked(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+	s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-02-10", 1, 100))
+
+	s.expect(http.StatusForbidden, marketer, "POST", "/api/periods/close", map[string]string{"month": "2026-02"})
+	s.expect(http.StatusCreated, admin, "POST", "/api/periods/close", map[string]string{"month": "2026-02"})
+
+	rec := s.expect(http.StatusLocked, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-02-11", 1, 100))
+	if code := errorCode(t, rec); code != CodeLocked {
+		t.Errorf("code %q, want %q", code, CodeLocked)
+	}
+	s.expect(http.StatusLocked, marketer, "PUT", "/api/reports/marketing-data/1", marketingRow("2026-02-10", 1, 150), "If-Match", `"1"`)
+	s.expect(http.StatusLocked, marketer, "DELETE", "/api/reports/marketing-data/1", nil)
+	s.expect(http.StatusLocked, admin, "POST", "/api/reports/sales-data", salesRow("2026-02-28", 1, 10))
+	// Moving a row out of the closed month is a change to it as well
+	s.expect(http.StatusLocked, marketer, "PUT", "/api/reports/marketing-data/1", marketingRow("2026-03-01", 1, 100), "If-Match", `"1"`)
+
+	s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-03-01", 1, 100))
+}
+
+func TestSalesLeadSeesAndWritesOwnTeamOnly(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+	s.expect(http.StatusCreated, admin, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 2, 20))
+
+	s.expect(http.StatusForbidden, salesLead, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 2, 30))
+	s.expect(http.StatusCreated, salesLead, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 1, 10))
+	s.expect(http.StatusForbidden, salesLead, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100))
+
+	rec := s.expect(http.StatusOK, salesLead, "GET", "/api/reports/sales-data?from=2026-01-01&to=2026-01-31", nil)
+	var rows []domain.SalesData
+	decode(t, rec, &rows)
+	if len(rows) != 1 || rows[0].TeamID != 1 {
+		t.Errorf("sales lead of team 1 sees %+v", rows)
+	}
+	rec = s.expect(http.StatusOK, salesLead, "GET", "/api/reports/sales-data?from=2026-01-01&to=2026-01-31&team_ids=2", nil)
+	decode(t, rec, &rows)
+	if len(rows) != 0 {
+		t.Errorf("sales lead of team 1 sees team 2: %+v", rows)
+	}
+
+	// The other team's row looks missing rather than forbidden
+	s.expect(http.StatusNotFound, salesLead, "GET", "/api/reports/sales-data/1", nil)
+	s.expect(http.StatusForbidden, salesLead, "PUT", "/api/reports/sales-data/1", salesRow("2026-01-15", 2, 30), "If-Match", `"1"`)
+	s.expect(http.StatusForbidden, salesLead, "DELETE", "/api/reports/sales-data/1", nil)
+	s.expect(http.StatusForbidden, salesLead, "POST", "/api/reports/sales-data/status",
+		map[string]interface{}{"date": "2026-01-15", "action": "submit", "team_ids": []int{2}})
+}
+
+func TestSalesLeadDoesNotSeeMarketingExpense(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+	s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100))
+	row := marketingRow("2026-01-16", 2, 250)
+	row["payments"], row["trials_conducted"], row["total_amount"] = 1, 2, 5000
+	s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", row)
+
+	// expense and every KPI it can be recovered from
+	hidden := []string{"expense", "cpl", "cost_per_trial", "cost_per_payment", "romi"}
+	for _, path := range []string{
+		"/api/reports/marketing-data?from=2026-01-15&to=2026-01-16",
+		"/api/reports/marketing-data/1",
+		"/api/reports/marketing-data?from=2026-01-15&to=2026-01-16&group_by=day",
+		"/api/reports/marketing-data?from=2026-01-01&to=2026-01-31&group_by=month",
+		"/api/reports/marketing-funnel?from=2026-01-15&to=2026-01-16",
+	} {
+		var got interface{}
+		decode(t, s.expect(http.StatusOK, salesLead, "GET", path, nil), &got)
+		for _, key := range hidden {
+			if hasKey(got, key) {
+				t.Errorf("%s shows %s to a sales lead", path, key)
+			}
+		}
+		if !hasKey(got, "leads") {
+			t.Errorf("%s hides more than expense", path)
+		}
+
+		decode(t, s.expect(http.StatusOK, admin, "GET", path, nil), &got)
+		if !hasKey(got, "expense") {
+			t.Errorf("%s hides expense from an admin", path)
+		}
+	}
+
+	for _, format := range []string{exportFormatCSV, exportFormatXLSX} {
+		path := "/api/reports/marketing-data/export?from=2026-01-15&to=2026-01-16&format=" + format
+		header, cells := exportCells(t, format, s.expect(http.StatusOK, salesLead, "GET", path, nil).Body.Bytes())
+		if slices.Contains(header, "Расход") || len(header) != 7 {
+			t.Errorf("%s export shows expense to a sales lead: %v", format, header)
+		}
+		if slices.ContainsFunc(cells, func(c string) bool { return strings.HasPrefix(c, "250") || strings.HasPrefix(c, "350") }) {
+			t.Errorf("%s export has expense values: %v", format, cells)
+		}
+
+		header, _ = exportCells(t, format, s.expect(http.StatusOK, admin, "GET", path, nil).Body.Bytes())
+		if !slices.Contains(header, "Расход") {
+			t.Errorf("%s export hides expense from an admin: %v", format, header)
+		}
+	}
+}
+
+func TestMaskedFields(t *testing.T) {
+	policy := authz.FieldPolicy{
+		domain.RoleViewer: {authz.EntitySales: {"total_amount": authz.FieldMask, "kaspi_refund": authz.FieldHide}},
+	}
+	viewer := &auth.Principal{UserID: 5, Username: "viewer", Role: domain.RoleViewer}
+	s := newPolicyTestServer(t, repository.NewMemoryRepository(), policy)
+	s.expect(http.StatusCreated, admin, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 1, 10))
+
+	for _, path := range []string{
+		"/api/reports/sales-data?from=2026-01-15&to=2026-01-15",
+		"/api/reports/sales-data/1",
+		"/api/reports/sales-data?from=2026-01-15&to=2026-01-15&group_by=week",
+	} {
+		rec := s.expect(http.StatusOK, viewer, "GET", path, nil)
+		body := rec.Body.String()
+		if !strings.Contains(body, `"total_amount":null`) || strings.Contains(body, "kaspi_refund") {
+			t.Errorf("%s: %s", path, body)
+		}
+	}
+
+	for _, format := range []string{exportFormatCSV, exportFormatXLSX} {
+		header, cells := exportCells(t, format, s.expect(http.StatusOK, viewer, "GET", "/api/reports/sales-data/export?format="+format, nil).Body.Bytes())
+		if !slices.Contains(header, "Сумма оплат") || slices.Contains(header, "Возврат Kaspi") {
+			t.Errorf("%s export header: %v", format, header)
+		}
+		// The row and the totals
+		if n := count(cells, maskedValue); n != 2 {
+			t.Errorf("%s export has %d masked cells, want 2: %v", format, n, cells)
+		}
+	}
+}
+
+// hasKey reports whether key appears in any object of a decoded JSON value.
+func hasKey(v interface{}, key string) bool {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, child := range x {
+			if k == key || hasKey(child, key) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range x {
+			if hasKey(child, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exportCells returns the header and the other cells of an export.
+func exportCells(t *testing.T, format string, body []byte) (header, cells []string) {
+	t.Helper()
+	var rows [][]string
+	if format == exportFormatXLSX {
+		f, err := excelize.OpenReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("open xlsx: %v", err)
+		}
+		defer f.Close()
+		if rows, err = f.GetRows(f.GetSheetName(0)); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xEF\xBB\xBF"))))
+		r.Comma = ';'
+		var err error
+		if rows, err = r.ReadAll(); err != nil {
+			t.Fatalf("read csv: %v", err)
+		}
+	}
+	if len(rows) == 0 {
+		t.Fatal("empty export")
+	}
+	for _, row := range rows[1:] {
+		cells = append(cells, row...)
+	}
+	return rows[0], cells
+}
+
+func count(values []string, value string) int {
+	n := 0
+	for _, v := range values {
+		if v == value {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSalesStatusWorkflow(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+	s.expect(http.StatusCreated, salesLead, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 1, 10))
+	s.expect(http.StatusCreated, admin, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 2, 20))
+
+	status := func(id int) string {
+		t.Helper()
+		var row domain.SalesData
+		decode(t, s.expect(http.StatusOK, admin, "GET", fmt.Sprintf("/api/reports/sales-data/%d", id), nil), &row)
+		return row.Status
+	}
+	change := func(action, comment string) map[string]string {
+		return map[string]string{"date": "2026-01-15", "action": action, "comment": comment}
+	}
+
+	// A sales lead submits the rows of their own team only
+	rec := s.expect(http.StatusOK, salesLead, "POST", "/api/reports/sales-data/status", change("submit", ""))
+	var changed []domain.SalesData
+	decode(t, rec, &changed)
+	if len(changed) != 1 || changed[0].TeamID != 1 || changed[0].Status != domain.StatusSubmitted {
+		t.Fatalf("submitted: %+v", changed)
+	}
+	if got := status(2); got != domain.StatusDraft {
+		t.Errorf("team 2 row is %s after team 1 submitted", got)
+	}
+
+	s.expect(http.StatusForbidden, salesLead, "POST", "/api/reports/sales-data/status", change("approve", ""))
+	s.expect(http.StatusBadRequest, salesHead, "POST", "/api/reports/sales-data/status", change("reject", ""))
+
+	s.expect(http.StatusOK, salesHead, "POST", "/api/reports/sales-data/status",
+		map[string]interface{}{"date": "2026-01-15", "action": "reject", "comment": "leads do not match the CRM", "team_ids": []int{1}})
+	if got := status(1); got != domain.StatusRejected {
+		t.Fatalf("after reject: %s", got)
+	}
+
+	// Editing a rejected row makes it a draft again
+	s.expect(http.StatusOK, salesLead, "PUT", "/api/reports/sales-data/1", salesRow("2026-01-15", 1, 12), "If-Match", `"3"`)
+	if got := status(1); got != domain.StatusDraft {
+		t.Fatalf("after editing a rejected row: %s", got)
+	}
+
+	s.expect(http.StatusOK, salesLead, "POST", "/api/reports/sales-data/status", change("submit", ""))
+	s.expect(http.StatusOK, salesHead, "POST", "/api/reports/sales-data/status",
+		map[string]interface{}{"date": "2026-01-15", "action": "approve", "team_ids": []int{1}})
+	if got := status(1); got != domain.StatusApproved {
+		t.Fatalf("after approve: %s", got)
+	}
+	s.expect(http.StatusConflict, salesLead, "PUT", "/api/reports/sales-data/1", salesRow("2026-01-15", 1, 14), "If-Match", `"6"`)
+	s.expect(http.StatusConflict, salesLead, "DELETE", "/api/reports/sales-data/1", nil)
+
+	s.expect(http.StatusOK, salesHead, "POST", "/api/reports/sales-data/status",
+		map[string]interface{}{"date": "2026-01-15", "action": "reopen", "team_ids": []int{1}})
+	if got := status(1); got != domain.StatusDraft {
+		t.Fatalf("after reopen: %s", got)
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+	s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100))
+
+	s.expect(http.StatusNoContent, marketer, "DELETE", "/api/reports/marketing-data/1", nil)
+	s.expect(http.StatusNotFound, marketer, "GET", "/api/reports/marketing-data/1", nil)
+	s.expect(http.StatusNotFound, marketer, "DELETE", "/api/reports/marketing-data/1", nil)
+
+	var rows []domain.MarketingData
+	decode(t, s.expect(http.StatusOK, marketer, "GET", "/api/reports/marketing-data?from=2026-01-15&to=2026-01-15", nil), &rows)
+	if len(rows) != 0 {
+		t.Errorf("deleted row is still listed: %+v", rows)
+	}
+	s.expect(http.StatusForbidden, marketer, "GET", "/api/reports/marketing-data/deleted", nil)
+	decode(t, s.expect(http.StatusOK, admin, "GET", "/api/reports/marketing-data/deleted?from=2026-01-15&to=2026-01-15", nil), &rows)
+	if len(rows) != 1 || rows[0].ID != 1 || rows[0].DeletedAt == nil {
+		t.Fatalf("deleted rows: %+v", rows)
+	}
+
+	s.expect(http.StatusForbidden, marketer, "POST", "/api/reports/marketing-data/1/restore", nil)
+	s.expect(http.StatusNoContent, admin, "POST", "/api/reports/marketing-data/1/restore", nil)
+	var row domain.MarketingData
+	decode(t, s.expect(http.StatusOK, marketer, "GET", "/api/reports/marketing-data/1", nil), &row)
+	if row.Expense != 100 || row.DeletedAt != nil {
+		t.Errorf("restored row: %+v", row)
+	}
+
+	// Saving over a deleted row revives it without a version
+	s.expect(http.StatusNoContent, marketer, "DELETE", "/api/reports/marketing-data/1", nil)
+	decode(t, s.expect(http.StatusOK, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 300)), &row)
+	if row.ID != 1 || row.Expense != 300 || row.DeletedAt != nil {
+		t.Errorf("revived row: %+v", row)
+	}
+}
+
+// multipartFile wraps content as the "file" field of a form upload.
+func multipartFile(t *testing.T, filename string, content []byte) ([]byte, string) {
+	t.Helper()
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes(), mw.FormDataContentType()
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	for _, format := range []string{exportFormatCSV, exportFormatXLSX} {
+		t.Run(format, func(t *testing.T) {
+			s := newTestServer(t, repository.NewMemoryRepository())
+			s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-14", 1, 1234.5))
+			s.expect(http.StatusCreated, marketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 8, 99.99))
+			s.expect(http.StatusCreated, admin, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 3, 7))
+
+			for _, entity := range []string{"marketing-data", "sales-data"} {
+				export := s.expect(http.StatusOK, admin, "GET",
+					"/api/reports/"+entity+"/export?from=2026-01-01&to=2026-01-31&format="+format, nil).Body.Bytes()
+
+				// Importing an export back changes nothing
+				body, contentType := multipartFile(t, "export."+format, export)
+				rec := s.expect(http.StatusOK, admin, "POST", "/api/reports/"+entity+"/import", body, "Content-Type", contentType)
+				var summary domain.ImportResult
+				decode(t, rec, &summary)
+				if summary.Errors != 0 || summary.Inserted != 0 || summary.Updated != 0 || summary.Unchanged == 0 {
+					t.Errorf("%s: importing the export: %s", entity, rec.Body.String())
+				}
+			}
+
+			// Changed and new rows, checked with a dry run first
+			csv := "Дата;Источник;Расход;Лиды;Пробные назначены;Пробные проведены;Оплаты;Сумма оплат\n" +
+				"14.01.2026;Facebook-1;2 000,00;10;5;0;0;0,00\n" +
+				"16.01.2026;TikTok;50,5;3;1;1;1;45 000\n"
+			var summary domain.ImportResult
+			decode(t, s.expect(http.StatusOK, marketer, "POST", "/api/reports/marketing-data/import?dry_run=true", csv), &summary)
+			if summary.Applied || summary.Updated != 1 || summary.Inserted != 1 {
+				t.Fatalf("dry run: %+v", summary)
+			}
+			var rows []domain.MarketingData
+			decode(t, s.expect(http.StatusOK, marketer, "GET", "/api/reports/marketing-data?from=2026-01-01&to=2026-01-31", nil), &rows)
+			if len(rows) != 2 {
+				t.Fatalf("the dry run wrote rows: %+v", rows)
+			}
+
+			decode(t, s.expect(http.StatusOK, marketer, "POST", "/api/reports/marketing-data/import", csv), &summary)
+			if !summary.Applied || summary.Updated != 1 || summary.Inserted != 1 {
+				t.Fatalf("import: %+v", summary)
+			}
+			decode(t, s.expect(http.StatusOK, marketer, "GET", "/api/reports/marketing-data?from=2026-01-01&to=2026-01-31", nil), &rows)
+			got := map[string]float64{}
+			for _, r := range rows {
+				got[r.Date[:10]] = r.Expense
+			}
+			if got["2026-01-14"] != 2000 || got["2026-01-15"] != 99.99 || got["2026-01-16"] != 50.5 {
+				t.Errorf("expenses after import: %v", got)
+			}
+		})
+	}
+}
+
+func TestImportReportsBadRows(t *testing.T) {
+	s := newTestServer(t, repository.NewMemoryRepository())
+
+	csv := "Дата;Источник;Расход;Лиды;Пробные назначены;Пробные проведены;Оплаты;Сумма оплат\n" +
+		"14.01.2026;Facebook-1;12,500;10;5;0;0;0\n" +
+		"15.01.2026;Nowhere;1;1;0;0;0;0\n" +
+		"16.01.2026;TikTok;1;1;0;0;0;0\n"
+	rec := s.expect(http.StatusUnprocessableEntity, marketer, "POST", "/api/reports/marketing-data/import", csv)
+	var summary domain.ImportResult
+	decode(t, rec, &summary)
+	if summary.Applied || summary.Errors != 2 {
+		t.Fatalf("summary: %s", rec.Body.String())
+	}
+	if !strings.Contains(summary.Rows[0].Error, "ambiguous") {
+		t.Errorf("12,500 was not reported as ambiguous: %+v", summary.Rows[0])
+	}
+
+	var rows []domain.MarketingData
+	decode(t, s.expect(http.StatusOK, marketer, "GET", "/api/reports/marketing-data?from=2026-01-01&to=2026-01-31", nil), &rows)
+	if len(rows) != 0 {
+		t.Errorf("a failed import wrote rows: %+v", rows)
+	}
+
+	big := bytes.Repeat([]byte("x"), maxImportSize+1)
+	s.expect(http.StatusRequestEntityTooLarge, marketer, "POST", "/api/reports/marketing-data/import", big)
+}
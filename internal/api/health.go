@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Readiness reports whether the server accepts new work. It starts unready,
+// is set once the listener is up and cleared when shutdown begins, so load
+// balancers stop routing to an instance that is draining.
+type Readiness struct {
+	ready atomic.Bool
+}
+
+func (rd *Readiness) Set(ready bool) {
+	rd.ready.Store(ready)
+}
+
+// ServeHTTP answers GET /readyz.
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !rd.ready.Load() {
+		WriteError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "shutting down", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// Live answers GET /healthz while the process is running.
+func Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,479 @@
+package api
+
+import (
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	"bake_backend/internal/validation"
+	dateutil "bake_backend/pkg"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxImportSize bounds the request body of an import, multipart envelope
+// included. Larger uploads are refused with 413 rather than cut short.
+const maxImportSize = 32 << 20
+
+// importLine is a spreadsheet row split into the daily-report layout:
+// date, source/team name, then the metrics in export column order.
+type importLine struct {
+	number  int
+	date    string
+	name    string
+	metrics []string
+}
+
+func (h *Handler) ImportMarketingData(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	lines, err := readImportLines(w, r, 6)
+	if err != nil {
+		writeImportReadError(w, r, err)
+		return
+	}
+
+	sources, err := h.scoped(r).GetMarketingSources(r.Context(), true)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	ids := make(map[string]int, len(sources))
+	for _, s := range sources {
+		ids[normalizeName(s.Name)] = s.ID
+	}
+
+	v := h.validator(r)
+	results := make([]domain.ImportRowResult, len(lines))
+	var rows []domain.MarketingData
+	var rowResults []int // index into results for each entry of rows
+	seen := map[string]int{}
+
+	for i, line := range lines {
+		results[i] = domain.ImportRowResult{Line: line.number, Date: line.date, Name: line.name}
+
+		d := domain.MarketingData{}
+		d.SourceID, err = resolveName(ids, line.name, "source")
+		if err == nil {
+			d.Date, err = parseImportDate(line.date)
+		}
+		if err == nil {
+			err = parseMetrics(line.metrics,
+				floatField(&d.Expense), intField(&d.Leads), intField(&d.TrialsScheduled),
+				intField(&d.TrialsConducted), intField(&d.Payments), floatField(&d.TotalAmount))
+		}
+		if err == nil {
+			var checked validation.Result
+			if checked, err = v.Marketing(r.Context(), &d); err != nil {
+				writeRepoError(w, r, err)
+				return
+			}
+			results[i].Warnings = checked.Warnings
+			if len(checked.Errors) > 0 {
+				results[i].Action = domain.ImportActionError
+				results[i].Error = validation.Summary(checked.Errors)
+				results[i].Fields = checked.Errors
+				continue
+			}
+			err = checkDuplicate(seen, fmt.Sprintf("%s/%d", d.Date, d.SourceID), line.number)
+		}
+		if err != nil {
+			results[i].Action = domain.ImportActionError
+			results[i].Error = err.Error()
+			continue
+		}
+
+		results[i].Date = d.Date
+		rows = append(rows, d)
+		rowResults = append(rowResults, i)
+	}
+
+	h.finishImport(w, r, authz.EntityMarketing, results, rowResults, dryRun, func(dryRun bool) ([]domain.ImportRowResult, error) {
+		return h.scoped(r).ImportMarketingData(r.Context(), rows, dryRun, auditMeta(r))
+	})
+}
+
+func (h *Handler) ImportSalesData(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	lines, err := readImportLines(w, r, 6)
+	if err != nil {
+		writeImportReadError(w, r, err)
+		return
+	}
+
+	teams, err := h.scoped(r).GetSalesTeams(r.Context(), "", "")
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+	ids := make(map[string]int, len(teams))
+	for _, t := range teams {
+		ids[normalizeName(t.Name)] = t.ID
+	}
+
+	v := h.validator(r)
+	results := make([]domain.ImportRowResult, len(lines))
+	var rows []domain.SalesData
+	var rowResults []int
+	seen := map[string]int{}
+
+	for i, line := range lines {
+		results[i] = domain.ImportRowResult{Line: line.number, Date: line.date, Name: line.name}
+
+		d := domain.SalesData{}
+		d.TeamID, err = resolveName(ids, line.name, "team")
+		if err == nil {
+			d.Date, err = parseImportDate(line.date)
+		}
+		if err == nil {
+			err = parseMetrics(line.metrics,
+				intField(&d.Leads), intField(&d.TrialsScheduled), intField(&d.TrialsConducted),
+				intField(&d.Payments), floatField(&d.TotalAmount), floatField(&d.KaspiRefund))
+		}
+		if err == nil {
+			var checked validation.Result
+			if checked, err = v.Sales(r.Context(), &d); err != nil {
+				writeRepoError(w, r, err)
+				return
+			}
+			results[i].Warnings = checked.Warnings
+			if len(checked.Errors) > 0 {
+				results[i].Action = domain.ImportActionError
+				results[i].Error = validation.Summary(checked.Errors)
+				results[i].Fields = checked.Errors
+				continue
+			}
+			err = checkDuplicate(seen, fmt.Sprintf("%s/%d", d.Date, d.TeamID), line.number)
+		}
+		if err != nil {
+			results[i].Action = domain.ImportActionError
+			results[i].Error = err.Error()
+			continue
+		}
+
+		results[i].Date = d.Date
+		rows = append(rows, d)
+		rowResults = append(rowResults, i)
+	}
+
+	h.finishImport(w, r, authz.EntitySales, results, rowResults, dryRun, func(dryRun bool) ([]domain.ImportRowResult, error) {
+		return h.scoped(r).ImportSalesData(r.Context(), rows, dryRun, auditMeta(r))
+	})
+}
+
+// finishImport runs the repository import and merges its per-row outcome into
+// results. Nothing is written when any row failed to parse: the import is then
+// executed as a dry run so the client still gets the full diff.
+func (h *Handler) finishImport(w http.ResponseWriter, r *http.Request, entity string, results []domain.ImportRowResult, rowResults []int, dryRun bool,
+	run func(dryRun bool) ([]domain.ImportRowResult, error)) {
+	summary := domain.ImportResult{DryRun: dryRun, Rows: results}
+	for _, res := range results {
+		if res.Action == domain.ImportActionError {
+			summary.Errors++
+		}
+	}
+
+	if len(rowResults) > 0 {
+		repoResults, err := run(dryRun || summary.Errors > 0)
+		if err != nil {
+			writeRepoError(w, r, err)
+			return
+		}
+		for i, res := range repoResults {
+			results[rowResults[i]].Action = res.Action
+			results[rowResults[i]].Changes = res.Changes
+			results[rowResults[i]].Error = res.Error
+			if res.Action == domain.ImportActionError {
+				summary.Errors++
+			}
+		}
+	}
+
+	for _, res := range results {
+		switch res.Action {
+		case domain.ImportActionInsert:
+			summary.Inserted++
+		case domain.ImportActionUpdate:
+			summary.Updated++
+		case domain.ImportActionUnchanged:
+			summary.Unchanged++
+		}
+	}
+	summary.Applied = !dryRun && summary.Errors == 0 && len(rowResults) > 0
+
+	status := http.StatusOK
+	if summary.Errors > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	h.writeData(w, r, status, entity, summary)
+}
+
+// readImportLines reads a CSV or XLSX upload (multipart "file" field or raw
+// body) and returns its data rows. The header row, blank rows and the totals
+// row produced by the export are skipped.
+func readImportLines(w http.ResponseWriter, r *http.Request, metricCount int) ([]importLine, error) {
+	body, filename, err := readImportBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = exportFormatCSV
+		if strings.EqualFold(filepath.Ext(filename), ".xlsx") || strings.Contains(r.Header.Get("Content-Type"), "spreadsheetml") {
+			format = exportFormatXLSX
+		}
+	}
+
+	var records [][]string
+	switch format {
+	case exportFormatCSV:
+		records, err = readCSVRecords(body)
+	case exportFormatXLSX:
+		records, err = readXLSXRecords(body)
+	default:
+		return nil, fmt.Errorf("invalid format %q, expected csv or xlsx", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []importLine
+	for i, record := range records {
+		for len(record) > 0 && strings.TrimSpace(record[len(record)-1]) == "" {
+			record = record[:len(record)-1]
+		}
+		if len(record) == 0 {
+			continue
+		}
+		first := strings.TrimSpace(record[0])
+		if first == totalsLabel || (i == 0 && !looksLikeDate(first)) {
+			continue
+		}
+
+		line := importLine{number: i + 1, date: first}
+		if len(record) > 1 {
+			line.name = strings.TrimSpace(record[1])
+		}
+		if len(record) > 2 {
+			line.metrics = record[2:]
+		}
+		for len(line.metrics) < metricCount {
+			line.metrics = append(line.metrics, "")
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// writeImportReadError answers an upload that could not be read.
+func writeImportReadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge,
+			fmt.Sprintf("the upload exceeds %d MB", maxImportSize>>20), nil)
+		return
+	}
+	badRequest(w, r, err.Error())
+}
+
+func readImportBody(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			return nil, "", err
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+		defer file.Close()
+
+		body, err := io.ReadAll(file)
+		return body, header.Filename, err
+	}
+
+	body, err := io.ReadAll(r.Body)
+	return body, "", err
+}
+
+func readCSVRecords(body []byte) ([][]string, error) {
+	body = bytes.TrimPrefix(body, []byte("\xEF\xBB\xBF"))
+
+	// Our own exports use ';', Google Sheets uses ','
+	firstLine := body
+	if i := bytes.IndexByte(body, '\n'); i >= 0 {
+		firstLine = body[:i]
+	}
+	cr := csv.NewReader(bytes.NewReader(body))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	return cr.ReadAll()
+}
+
+func readXLSXRecords(body []byte) ([][]string, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.GetRows(f.GetSheetName(0), excelize.Options{RawCellValue: true})
+}
+
+func looksLikeDate(s string) bool {
+	_, err := parseImportDate(s)
+	return err == nil
+}
+
+// parseImportDate accepts the formats of dateutil.ParseDate and Excel serial
+// dates, returning an ISO date.
+func parseImportDate(s string) (string, error) {
+	if t, err := dateutil.ParseDate(s); err == nil {
+		return t.Format(dateutil.ISOLayout), nil
+	}
+	if serial, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && serial > 0 {
+		if t, err := excelize.ExcelDateToTime(serial, false); err == nil {
+			return t.Format(dateutil.ISOLayout), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q", s)
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func resolveName(ids map[string]int, name, kind string) (int, error) {
+	if name == "" {
+		return 0, fmt.Errorf("%s name is empty", kind)
+	}
+	id, ok := ids[normalizeName(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown %s %q", kind, name)
+	}
+	return id, nil
+}
+
+func checkDuplicate(seen map[string]int, key string, line int) error {
+	if prev, ok := seen[key]; ok {
+		return fmt.Errorf("duplicate of line %d", prev)
+	}
+	seen[key] = line
+	return nil
+}
+
+// metricField parses one spreadsheet cell into a struct field.
+type metricField func(value string) error
+
+func intField(dst *int) metricField {
+	return func(value string) error {
+		v, err := parseDecimal(value)
+		if err != nil {
+			return err
+		}
+		if v != math.Trunc(v) {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*dst = int(v)
+		return nil
+	}
+}
+
+func floatField(dst *float64) metricField {
+	return func(value string) error {
+		v, err := parseDecimal(value)
+		if err != nil {
+			return err
+		}
+		*dst = math.Round(v*100) / 100
+		return nil
+	}
+}
+
+func parseMetrics(values []string, fields ...metricField) error {
+	var errs []error
+	for i, field := range fields {
+		if err := field(values[i]); err != nil {
+			errs = append(errs, fmt.Errorf("column %d: %w", i+3, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseDecimal accepts both "1 234,50" and "1,234.50": when both separators
+// are present the last one is the decimal separator. A lone comma followed by
+// exactly three digits ("12,500") may be either, so it is rejected rather
+// than guessed; several commas without a dot are thousands separators. Only
+// digits, separators and a leading sign are allowed, so "NaN", "Inf" and
+// exponents are refused. Empty cells are zero.
+func parseDecimal(value string) (float64, error) {
+	s := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' || r == '\u202f' {
+			return -1
+		}
+		return r
+	}, value)
+	if s == "" {
+		return 0, nil
+	}
+	if unsigned := strings.TrimLeft(s, "+-"); len(s)-len(unsigned) > 1 || !isDecimalDigits(unsigned) {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+
+	comma, dot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	switch {
+	case comma >= 0 && dot >= 0 && comma > dot:
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	case comma >= 0 && dot >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case strings.Count(s, ",") > 1:
+		s = strings.ReplaceAll(s, ",", "")
+	case comma >= 0 && len(s)-comma-1 == 3 && isDigits(s[comma+1:]):
+		return 0, fmt.Errorf("ambiguous number %q, write it without a thousands separator", value)
+	case comma >= 0:
+		s = strings.Replace(s, ",", ".", 1)
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return v, nil
+}
+
+// isDecimalDigits reports whether s is made of digits and separators and has
+// at least one digit.
+func isDecimalDigits(s string) bool {
+	var digits bool
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case r != ',' && r != '.':
+			return false
+		}
+	}
+	return digits
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package api
+
+import "testing"
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"42", 42, false},
+		{"-5", -5, false},
+		{"+5", 5, false},
+		{"12,5", 12.5, false},
+		{"12.5", 12.5, false},
+		{"1 234,50", 1234.5, false},
+		{"1\u00a0234,50", 1234.5, false},
+		{"1.234,50", 1234.5, false},
+		{"1,234.50", 1234.5, false},
+		{"1,234,567", 1234567, false},
+		{"0,125", 0, true},
+		{"12,500", 0, true},
+		{"12,50", 12.5, false},
+		{"12,5000", 12.5, false},
+		{"NaN", 0, true},
+		{"nan", 0, true},
+		{"Inf", 0, true},
+		{"-Inf", 0, true},
+		{"+Infinity", 0, true},
+		{"1e400", 0, true},
+		{"1e3", 0, true},
+		{"0x10", 0, true},
+		{"+-5", 0, true},
+		{".", 0, true},
+		{"-", 0, true},
+		{"1.2.3", 0, true},
+		{"12 руб", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDecimal(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
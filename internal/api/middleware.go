@@ -0,0 +1,53 @@
+package api
+
+import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/domain"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// WithRequestID tags every request with an ID, reusing a well-formed
+// X-Request-ID from the client or proxy, and echoes it in the response.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// auditMeta describes the authenticated caller for the audit log.
+func auditMeta(r *http.Request) domain.AuditMeta {
+	meta := domain.AuditMeta{RequestID: RequestIDFromContext(r.Context())}
+	if p := auth.PrincipalFromContext(r.Context()); p != nil {
+		meta.Actor = p.Username
+	}
+	return meta
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/repository"
+	"bake_backend/migrations"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+// testBackend opens an empty, migrated store.
+type testBackend struct {
+	name string
+	open func(t *testing.T) Repository
+}
+
+var testBackends = []testBackend{
+	{"memory", func(t *testing.T) Repository { return repository.NewMemoryRepository() }},
+	{"sqlite", openSQLiteBackend},
+	{"postgres", openPostgresBackend},
+}
+
+func openSQLiteBackend(t *testing.T) Repository {
+	db, err := sql.Open("sqlite", repository.SQLiteDSN(filepath.Join(t.TempDir(), "bake.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	fsys, err := fs.Sub(migrations.SQLite, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrate(t, goose.DialectSQLite3, db, fsys)
+	return repository.NewSQLiteRepository(db, repository.Timeouts{})
+}
+
+// openPostgresBackend migrates a new schema of the database named by
+// TEST_DATABASE_URL and drops it afterwards. Without the variable the
+// backend is skipped, except in CI, which has to run it.
+func openPostgresBackend(t *testing.T) Repository {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" && os.Getenv("CI") != "" {
+		t.Fatal("TEST_DATABASE_URL is not set, CI runs the Postgres backend")
+	}
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	schema := fmt.Sprintf("parity_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if cleanup, err := sql.Open("postgres", dsn); err == nil {
+			cleanup.Exec("DROP SCHEMA " + schema + " CASCADE")
+			cleanup.Close()
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrate(t, goose.DialectPostgres, db, migrations.Postgres)
+	return repository.NewPostgresRepository(db, repository.Timeouts{})
+}
+
+func migrate(t *testing.T, dialect goose.Dialect, db *sql.DB, fsys fs.FS) {
+	t.Helper()
+	provider, err := goose.NewProvider(dialect, db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+}
+
+// TestBackendParity runs the same requests against every backend and
+// expects the same answers as from memory, up to timestamps.
+func TestBackendParity(t *testing.T) {
+	var want []string
+	for _, b := range testBackends {
+		t.Run(b.name, func(t *testing.T) {
+			got := parityScenario(newTestServer(t, b.open(t)))
+			if want == nil {
+				want = got
+				return
+			}
+			for i := range want {
+				if i >= len(got) {
+					t.Fatalf("transcript ends after %d of %d steps", len(got), len(want))
+				}
+				if got[i] != want[i] {
+					t.Errorf("step %d differs from memory:\n got: %s\nwant: %s", i+1, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// parityScenario records a request and its normalized answer per step.
+func parityScenario(s *testServer) []string {
+	var transcript []string
+	step := func(p *principalName, method, path string, body interface{}, headers ...string) {
+		rec := s.do(p.principal, method, path, body, headers...)
+		transcript = append(transcript, fmt.Sprintf("%s %s %s -> %d %s", p.name, method, path, rec.Code, normalizeAnswer(rec.Body.Bytes())))
+	}
+	asAdmin := &principalName{"admin", admin}
+	asMarketer := &principalName{"marketer", marketer}
+	asLead := &principalName{"lead", salesLead}
+	asHead := &principalName{"head", salesHead}
+
+	// Saves: create, stale and missing versions, rounding, validation
+	step(asMarketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 100.555))
+	step(asMarketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 1, 120))
+	row := marketingRow("2026-01-15", 1, 120.004)
+	row["version"] = 1
+	step(asMarketer, "POST", "/api/reports/marketing-data", row)
+	step(asMarketer, "POST", "/api/reports/marketing-data", row)
+	step(asMarketer, "PUT", "/api/reports/marketing-data/1", marketingRow("2026-01-15", 1, 130), "If-Match", `"2"`)
+	step(asMarketer, "PUT", "/api/reports/marketing-data/1", marketingRow("2026-01-15", 1, 130), "If-Match", `"2"`)
+	step(asMarketer, "PUT", "/api/reports/marketing-data/99", marketingRow("2026-01-15", 1, 130), "If-Match", `"1"`)
+	step(asMarketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-15", 99, 1))
+	step(asMarketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-16", 2, 1e15))
+	step(asAdmin, "POST", "/api/reports/marketing-sources", map[string]string{"name": "Instagram"})
+
+	// Daily batch
+	step(asMarketer, "POST", "/api/reports/daily-batch", map[string]interface{}{
+		"date": "2026-01-16", "marketing": []interface{}{marketingRow("2026-01-16", 1, 10), marketingRow("2026-01-16", 2, 20)},
+	})
+	step(asMarketer, "POST", "/api/reports/daily-batch", map[string]interface{}{
+		"date": "2026-01-16", "marketing": []interface{}{marketingRow("2026-01-16", 1, 11), marketingRow("2026-01-16", 3, 30)},
+	})
+	step(asMarketer, "GET", "/api/reports/marketing-data?from=2026-01-01&to=2026-01-31", nil)
+	step(asMarketer, "GET", "/api/reports/marketing-data?from=2026-13-01", nil)
+	step(asMarketer, "GET", "/api/reports/marketing-funnel?from=2026-01-31&to=2026-01-01", nil)
+
+	// Sales leads and field policy
+	step(asAdmin, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 2, 20))
+	step(asLead, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 2, 30))
+	step(asLead, "POST", "/api/reports/sales-data", salesRow("2026-01-15", 1, 10))
+	step(asLead, "GET", "/api/reports/sales-data?from=2026-01-01&to=2026-01-31", nil)
+	step(asLead, "GET", "/api/reports/sales-data/1", nil)
+	step(asLead, "GET", "/api/reports/marketing-data/1", nil)
+
+	// Status workflow
+	step(asLead, "POST", "/api/reports/sales-data/status", map[string]string{"date": "2026-01-15", "action": "submit"})
+	step(asLead, "POST", "/api/reports/sales-data/status", map[string]string{"date": "2026-01-15", "action": "approve"})
+	step(asHead, "POST", "/api/reports/sales-data/status", map[string]interface{}{"date": "2026-01-15", "action": "reject", "comment": "check the CRM", "team_ids": []int{1}})
+	step(asLead, "PUT", "/api/reports/sales-data/2", salesRow("2026-01-15", 1, 11), "If-Match", `"3"`)
+	step(asLead, "POST", "/api/reports/sales-data/status", map[string]string{"date": "2026-01-15", "action": "submit"})
+	step(asHead, "POST", "/api/reports/sales-data/status", map[string]string{"date": "2026-01-15", "action": "approve"})
+	step(asHead, "POST", "/api/reports/sales-data/status", map[string]interface{}{"date": "2026-01-15", "action": "approve", "team_ids": []int{1}})
+	step(asLead, "DELETE", "/api/reports/sales-data/2", nil)
+	step(asHead, "POST", "/api/reports/sales-data/status", map[string]interface{}{"date": "2026-01-15", "action": "reopen", "team_ids": []int{1}})
+	step(asAdmin, "GET", "/api/reports/sales-data?from=2026-01-01&to=2026-01-31", nil)
+
+	// Soft delete
+	step(asMarketer, "DELETE", "/api/reports/marketing-data/1", nil)
+	step(asMarketer, "GET", "/api/reports/marketing-data/1", nil)
+	step(asAdmin, "GET", "/api/reports/marketing-data/deleted?from=2026-01-01&to=2026-01-31", nil)
+	step(asAdmin, "POST", "/api/reports/marketing-data/1/restore", nil)
+	step(asMarketer, "GET", "/api/reports/marketing-data/1", nil)
+
+	// Import and export
+	step(asAdmin, "GET", "/api/reports/marketing-data/export?from=2026-01-01&to=2026-01-31", nil)
+	step(asAdmin, "GET", "/api/reports/sales-data/export?from=2026-01-01&to=2026-01-31", nil)
+	csv := "Дата;Источник;Расход;Лиды;Пробные назначены;Пробные проведены;Оплаты;Сумма оплат\n" +
+		"15.01.2026;Facebook-1;130,00;10;5;0;0;0\n" +
+		"16.01.2026;Facebook-2;25,5;10;5;0;0;0\n" +
+		"17.01.2026;TikTok;1 000;3;1;1;1;45 000\n"
+	step(asMarketer, "POST", "/api/reports/marketing-data/import?dry_run=true", csv)
+	step(asMarketer, "POST", "/api/reports/marketing-data/import", csv)
+	step(asMarketer, "POST", "/api/reports/marketing-data/import", csv)
+	step(asAdmin, "GET", "/api/reports/marketing-data/export?from=2026-01-01&to=2026-01-31", nil)
+
+	// Analytics: the funnel with its totals row, zero-filled buckets
+	step(asAdmin, "GET", "/api/reports/marketing-funnel?from=2026-01-01&to=2026-01-31", nil)
+	step(asLead, "GET", "/api/reports/marketing-funnel?from=2026-01-01&to=2026-01-31", nil)
+	step(asAdmin, "GET", "/api/reports/marketing-funnel?from=2025-01-01&to=2025-01-31", nil)
+	step(asAdmin, "GET", "/api/reports/marketing-data?from=2026-01-14&to=2026-01-18&group_by=day", nil)
+	step(asAdmin, "GET", "/api/reports/marketing-data?from=2026-01-01&to=2026-03-31&group_by=month", nil)
+	step(asLead, "GET", "/api/reports/marketing-data?from=2026-01-12&to=2026-01-25&group_by=week", nil)
+	step(asAdmin, "GET", "/api/reports/sales-data?from=2026-01-12&to=2026-01-25&group_by=week", nil)
+	step(asLead, "GET", "/api/reports/sales-data?from=2026-01-01&to=2026-06-30&group_by=quarter", nil)
+
+	// Closed periods
+	step(asAdmin, "POST", "/api/periods/close", map[string]string{"month": "2026-01"})
+	step(asMarketer, "POST", "/api/reports/marketing-data", marketingRow("2026-01-20", 4, 1))
+	step(asMarketer, "PUT", "/api/reports/marketing-data/1", marketingRow("2026-01-15", 1, 1), "If-Match", `"5"`)
+	step(asMarketer, "POST", "/api/reports/marketing-data/import", csv)
+	step(asMarketer, "POST", "/api/reports/marketing-data/import", strings.Replace(csv, "25,5", "26", 1))
+	step(asMarketer, "POST", "/api/reports/marketing-data", marketingRow("2026-02-01", 4, 1))
+	return transcript
+}
+
+type principalName struct {
+	name      string
+	principal *auth.Principal
+}
+
+// normalizeAnswer drops what legitimately differs between backends from a
+// JSON answer: timestamps are reduced to whether they are set, dates to
+// YYYY-MM-DD. Row IDs are left out, Postgres sequences skip values on failed
+// inserts, and so are constraint details, SQLite does not name the values.
+// Other answers are kept as they are.
+func normalizeAnswer(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+	out, _ := json.Marshal(normalizeValue("", v))
+	return string(out)
+}
+
+func normalizeValue(key string, v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		delete(x, "request_id")
+		delete(x, "detail")
+		if _, ok := x["id"].(float64); ok {
+			x["id"] = "<id>"
+		}
+		for k, e := range x {
+			x[k] = normalizeValue(k, e)
+		}
+		return x
+	case []interface{}:
+		for i, e := range x {
+			x[i] = normalizeValue(key, e)
+		}
+		return x
+	case string:
+		switch {
+		case strings.HasSuffix(key, "_at"):
+			if x == "" || strings.HasPrefix(x, "0001-01-01") {
+				return "<zero>"
+			}
+			return "<set>"
+		case key == "date" && len(x) > 10:
+			return x[:10]
+		}
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidPeriod = errors.New("expected date, month (YYYY-MM) or from and to")
+
+// closePeriodRequest names the period as a single date, a month (YYYY-MM)
+// or an inclusive from/to range.
+type closePeriodRequest struct {
+	Date  string `json:"date"`
+	Month string `json:"month"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type reopenPeriodRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *Handler) GetPeriodLocks(w http.ResponseWriter, r *http.Request) {
+	includeReopened, _ := strconv.ParseBool(r.URL.Query().Get("include_reopened"))
+
+	locks, err := h.scoped(r).GetPeriodLocks(r.Context(), includeReopened)
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, locks)
+}
+
+func (h *Handler) ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	var req closePeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	from, to, err := periodBounds(req)
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	lock := &domain.PeriodLock{From: from.Format(dateutil.ISOLayout), To: to.Format(dateutil.ISOLayout)}
+	if err := h.scoped(r).ClosePeriod(r.Context(), lock, auditMeta(r)); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, lock)
+}
+
+func (h *Handler) ReopenPeriod(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req reopenPeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		badRequest(w, r, "reason is required")
+		return
+	}
+
+	lock, err := h.scoped(r).ReopenPeriod(r.Context(), id, reason, auditMeta(r))
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lock)
+}
+
+func periodBounds(req closePeriodRequest) (time.Time, time.Time, error) {
+	switch {
+	case req.Month != "":
+		month, err := time.Parse("2006-01", req.Month)
+		if err != nil {
+			return time.Time{}, time.Time{}, errInvalidPeriod
+		}
+		return month, month.AddDate(0, 1, -1), nil
+	case req.Date != "":
+		date, err := dateutil.ParseDate(req.Date)
+		if err != nil {
+			return time.Time{}, time.Time{}, errInvalidPeriod
+		}
+		return date, date, nil
+	case req.From != "" && req.To != "":
+		from, err := dateutil.ParseDate(req.From)
+		if err != nil {
+			return time.Time{}, time.Time{}, errInvalidPeriod
+		}
+		to, err := dateutil.ParseDate(req.To)
+		if err != nil || to.Before(from) {
+			return time.Time{}, time.Time{}, errInvalidPeriod
+		}
+		return from, to, nil
+	}
+	return time.Time{}, time.Time{}, errInvalidPeriod
+}
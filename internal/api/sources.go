@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bake_backend/internal/domain"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxNameLength = 50
+
+type nameRequest struct {
+	Name string `json:"name"`
+}
+
+type reorderRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// decodeName reads {"name": ...} and checks it fits the VARCHAR(50) name columns.
+func decodeName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req nameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return "", false
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		badRequest(w, r, "Name must be between 1 and 50 characters")
+		return "", false
+	}
+	return name, true
+}
+
+func (h *Handler) CreateMarketingSource(w http.ResponseWriter, r *http.Request) {
+	name, ok := decodeName(w, r)
+	if !ok {
+		return
+	}
+
+	source := domain.MarketingSource{Name: name}
+	if err := h.scoped(r).CreateMarketingSource(r.Context(), &source); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, source)
+}
+
+func (h *Handler) RenameMarketingSource(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	name, ok := decodeName(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).RenameMarketingSource(r.Context(), id, name); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ArchiveMarketingSource(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).ArchiveMarketingSource(r.Context(), id); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RestoreMarketingSource(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).RestoreMarketingSource(r.Context(), id); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ReorderMarketingSources(w http.ResponseWriter, r *http.Request) {
+	var req reorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	if err := h.scoped(r).ReorderMarketingSources(r.Context(), req.IDs); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteMarketingSource hard-deletes a source; the repository refuses with
+// 409 when the source already has data.
+func (h *Handler) DeleteMarketingSource(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).DeleteMarketingSource(r.Context(), id); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
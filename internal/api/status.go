@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// statusRequest moves the rows of one date through the approval workflow.
+// Without source_ids/team_ids every row of the date is affected.
+type statusRequest struct {
+	Date      string `json:"date"`
+	Action    string `json:"action"`
+	Comment   string `json:"comment"`
+	SourceIDs []int  `json:"source_ids"`
+	TeamIDs   []int  `json:"team_ids"`
+}
+
+func (h *Handler) ChangeMarketingStatus(w http.ResponseWriter, r *http.Request) {
+	req, change, ok := decodeStatusChange(w, r)
+	if !ok {
+		return
+	}
+	change.IDs = req.SourceIDs
+
+	data, err := h.scoped(r).ChangeMarketingStatus(r.Context(), change, auditMeta(r))
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	h.writeData(w, r, http.StatusOK, authz.EntityMarketing, data)
+}
+
+func (h *Handler) ChangeSalesStatus(w http.ResponseWriter, r *http.Request) {
+	req, change, ok := decodeStatusChange(w, r)
+	if !ok {
+		return
+	}
+	change.IDs = req.TeamIDs
+
+	data, err := h.scoped(r).ChangeSalesStatus(r.Context(), change, auditMeta(r))
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	h.writeData(w, r, http.StatusOK, authz.EntitySales, data)
+}
+
+func decodeStatusChange(w http.ResponseWriter, r *http.Request) (statusRequest, domain.StatusChange, bool) {
+	var req statusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return req, domain.StatusChange{}, false
+	}
+
+	date, err := dateutil.ParseDate(req.Date)
+	if err != nil {
+		badRequest(w, r, "Invalid date")
+		return req, domain.StatusChange{}, false
+	}
+
+	change := domain.StatusChange{Date: date.Format(dateutil.ISOLayout), Action: req.Action, Comment: strings.TrimSpace(req.Comment)}
+	switch change.Action {
+	case domain.StatusActionSubmit, domain.StatusActionApprove, domain.StatusActionReopen:
+	case domain.StatusActionReject:
+		if change.Comment == "" {
+			badRequest(w, r, "comment is required when rejecting")
+			return req, change, false
+		}
+	default:
+		badRequest(w, r, "Invalid action, expected submit, approve, reject or reopen")
+		return req, change, false
+	}
+	return req, change, true
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+type teamRequest struct {
+	Name       string  `json:"name"`
+	ActiveFrom *string `json:"active_from"`
+	ActiveTo   *string `json:"active_to"`
+}
+
+// decodeTeam reads and normalizes a team body; dates may be ISO or dd.mm.yyyy.
+func decodeTeam(w http.ResponseWriter, r *http.Request) (*domain.SalesTeam, bool) {
+	var req teamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return nil, false
+	}
+
+	team := &domain.SalesTeam{Name: strings.TrimSpace(req.Name)}
+	if team.Name == "" || utf8.RuneCountInString(team.Name) > maxNameLength {
+		badRequest(w, r, "Name must be between 1 and 50 characters")
+		return nil, false
+	}
+
+	var ok bool
+	if team.ActiveFrom, ok = optionalDate(w, r, "active_from", req.ActiveFrom); !ok {
+		return nil, false
+	}
+	if team.ActiveTo, ok = optionalDate(w, r, "active_to", req.ActiveTo); !ok {
+		return nil, false
+	}
+	if team.ActiveFrom != nil && team.ActiveTo != nil && *team.ActiveFrom > *team.ActiveTo {
+		badRequest(w, r, "active_from must not be after active_to")
+		return nil, false
+	}
+	return team, true
+}
+
+func optionalDate(w http.ResponseWriter, r *http.Request, field string, value *string) (*string, bool) {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil, true
+	}
+	t, err := dateutil.ParseDate(*value)
+	if err != nil {
+		badRequest(w, r, "Invalid "+field+": "+err.Error())
+		return nil, false
+	}
+	date := t.Format(dateutil.ISOLayout)
+	return &date, true
+}
+
+func (h *Handler) CreateSalesTeam(w http.ResponseWriter, r *http.Request) {
+	team, ok := decodeTeam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).CreateSalesTeam(r.Context(), team); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, team)
+}
+
+func (h *Handler) UpdateSalesTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	team, ok := decodeTeam(w, r)
+	if !ok {
+		return
+	}
+
+	team.ID = id
+	if err := h.scoped(r).UpdateSalesTeam(r.Context(), team); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, team)
+}
+
+// DeleteSalesTeam hard-deletes a team; the repository refuses with 409 when
+// the team already has data.
+func (h *Handler) DeleteSalesTeam(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scoped(r).DeleteSalesTeam(r.Context(), id); err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// requireAdmin answers 403 unless the caller is an admin.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if err := authz.Require(auth.PrincipalFromContext(r.Context()), domain.RoleAdmin); err != nil {
+		writeRepoError(w, r, err)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	users, err := h.auth.ListUsers(r.Context())
+	if err != nil {
+		writeRepoError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req auth.UserInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	user, err := h.auth.CreateUser(r.Context(), req)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, user)
+}
+
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req auth.UserInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	user, err := h.auth.UpdateUser(r.Context(), id, req)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	if user == nil {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "not found", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func writeUserError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, auth.ErrInvalidUser) {
+		badRequest(w, r, err.Error())
+		return
+	}
+	writeRepoError(w, r, err)
+}
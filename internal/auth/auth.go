@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrInvalidUser        = errors.New("invalid user")
+)
+
+// Store persists users and refresh tokens. Refresh tokens are only ever
+// stored as SHA-256 hashes.
+type Store interface {
+	GetUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	GetUserByID(ctx context.Context, id int) (*domain.User, error)
+	CreateUser(ctx context.Context, user *domain.User) error
+	ListUsers(ctx context.Context) ([]domain.User, error)
+	UpdateUser(ctx context.Context, user *domain.User) error
+	CountUsers(ctx context.Context) (int, error)
+	SaveRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// ConsumeRefreshToken revokes a valid, unexpired token and returns its
+	// user; ok is false if the token is unknown, expired or already revoked.
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) (userID int, ok bool, err error)
+}
+
+type TokenPair struct {
+	AccessToken  string       `json:"access_token"`
+	RefreshToken string       `json:"refresh_token"`
+	TokenType    string       `json:"token_type"`
+	ExpiresIn    int          `json:"expires_in"`
+	User         *domain.User `json:"user"`
+}
+
+type Service struct {
+	store      Store
+	tokens     *TokenManager
+	refreshTTL time.Duration
+}
+
+func NewService(store Store, tokens *TokenManager, refreshTTL time.Duration) *Service {
+	// Hashed now rather than on the first login for an unknown user
+	dummyHash()
+	return &Service{store: store, tokens: tokens, refreshTTL: refreshTTL}
+}
+
+func (s *Service) Tokens() *TokenManager {
+	return s.tokens
+}
+
+func (s *Service) Login(ctx context.Context, username, password string) (*TokenPair, error) {
+	user, err := s.store.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every failure costs one bcrypt run, so that the response time does not
+	// tell which usernames exist
+	hash := dummyHash()
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	matches := compareHash(hash, []byte(password)) == nil
+	if user == nil || !user.IsActive || !matches {
+		return nil, ErrInvalidCredentials
+	}
+	return s.issue(ctx, user)
+}
+
+// Refresh rotates the refresh token: the presented token is revoked and a new pair is issued.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	userID, ok, err := s.store.ConsumeRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, ErrInvalidToken
+	}
+	return s.issue(ctx, user)
+}
+
+// Logout revokes the refresh token. Access tokens stay valid until they expire.
+func (s *Service) Logout(ctx context.Context, refreshToken string) error {
+	_, _, err := s.store.ConsumeRefreshToken(ctx, hashToken(refreshToken))
+	return err
+}
+
+// EnsureAdmin creates the initial user when there are no users yet.
+func (s *Service) EnsureAdmin(ctx context.Context, username, password string) (bool, error) {
+	if username == "" || password == "" {
+		return false, nil
+	}
+
+	count, err := s.store.CountUsers(ctx)
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	return true, s.store.CreateUser(ctx, &domain.User{Username: username, PasswordHash: hash, Role: domain.RoleAdmin, IsActive: true})
+}
+
+// UserInput carries the fields an admin may set on an account. Nil fields
+// are left unchanged on update; an empty Password keeps the current one.
+type UserInput struct {
+	Username string  `json:"username"`
+	Password string  `json:"password"`
+	Role     *string `json:"role"`
+	TeamID   *int    `json:"team_id"`
+	IsActive *bool   `json:"is_active"`
+}
+
+func (s *Service) ListUsers(ctx context.Context) ([]domain.User, error) {
+	return s.store.ListUsers(ctx)
+}
+
+func (s *Service) CreateUser(ctx context.Context, in UserInput) (*domain.User, error) {
+	if in.Username == "" || in.Password == "" {
+		return nil, fmt.Errorf("%w: username and password are required", ErrInvalidUser)
+	}
+
+	user := &domain.User{Username: in.Username, Role: domain.RoleViewer, IsActive: true}
+	applyUserInput(user, in)
+	if err := checkUser(user); err != nil {
+		return nil, err
+	}
+
+	hash, err := HashPassword(in.Password)
+	if err != nil {
+		return nil, err
+	}
+	user.PasswordHash = hash
+	return user, s.store.CreateUser(ctx, user)
+}
+
+// UpdateUser changes role, team, password or active flag. Role changes take
+// effect once the user's current access token expires.
+func (s *Service) UpdateUser(ctx context.Context, id int, in UserInput) (*domain.User, error) {
+	user, err := s.store.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	applyUserInput(user, in)
+	if err := checkUser(user); err != nil {
+		return nil, err
+	}
+
+	if in.Password != "" {
+		if user.PasswordHash, err = HashPassword(in.Password); err != nil {
+			return nil, err
+		}
+	}
+	return user, s.store.UpdateUser(ctx, user)
+}
+
+func applyUserInput(user *domain.User, in UserInput) {
+	if in.Role != nil {
+		user.Role = *in.Role
+	}
+	if in.TeamID != nil {
+		user.TeamID = in.TeamID
+	}
+	if in.IsActive != nil {
+		user.IsActive = *in.IsActive
+	}
+	// Only sales leads are bound to a team
+	if user.Role != domain.RoleSalesLead {
+		user.TeamID = nil
+	}
+}
+
+func checkUser(user *domain.User) error {
+	if !domain.IsValidRole(user.Role) {
+		return fmt.Errorf("%w: unknown role %q", ErrInvalidUser, user.Role)
+	}
+	if user.Role == domain.RoleSalesLead && user.TeamID == nil {
+		return fmt.Errorf("%w: sales_lead requires team_id", ErrInvalidUser)
+	}
+	return nil
+}
+
+func (s *Service) issue(ctx context.Context, user *domain.User) (*TokenPair, error) {
+	access, err := s.tokens.Issue(user)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.SaveRefreshToken(ctx, user.ID, hashToken(refresh), time.Now().Add(s.refreshTTL)); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.tokens.ttl.Seconds()),
+		User:         user,
+	}, nil
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func CheckPassword(hash, password string) bool {
+	return compareHash([]byte(hash), []byte(password)) == nil
+}
+
+var compareHash = bcrypt.CompareHashAndPassword
+
+// dummyHash is what Login compares the password with when the user does not
+// exist. It has the cost of real hashes.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("no such user"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID   int
+	Username string
+	Role     string
+	TeamID   *int
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// PrincipalFromContext returns the caller, or nil on unauthenticated routes.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
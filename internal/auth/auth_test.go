@@ -0,0 +1,53 @@
+package auth_test
+
+import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/domain"
+	"bake_backend/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginComparesAPasswordOnEveryFailure(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryRepository()
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []domain.User{
+		{Username: "active", PasswordHash: hash, Role: domain.RoleAdmin, IsActive: true},
+		{Username: "inactive", PasswordHash: hash, Role: domain.RoleAdmin},
+	} {
+		if err := store.CreateUser(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := auth.NewService(store, auth.NewTokenManager("0123456789abcdef0123456789abcdef", time.Minute), time.Hour)
+
+	var compared int
+	restore := auth.CountComparisons(&compared)
+	defer restore()
+
+	tests := []struct {
+		username, password string
+		wantErr            error
+	}{
+		{"active", "secret", nil},
+		{"active", "wrong", auth.ErrInvalidCredentials},
+		{"inactive", "secret", auth.ErrInvalidCredentials},
+		{"nobody", "secret", auth.ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		compared = 0
+		_, err := service.Login(ctx, tt.username, tt.password)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s/%s: got %v, want %v", tt.username, tt.password, err, tt.wantErr)
+		}
+		if compared != 1 {
+			t.Errorf("%s/%s: %d bcrypt comparisons, want 1", tt.username, tt.password, compared)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"bake_backend/internal/domain"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const issuer = "bake_backend"
+
+type claims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	TeamID   *int   `json:"team_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager issues and verifies HS256-signed access tokens.
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTokenManager(secret string, ttl time.Duration) *TokenManager {
+	return &TokenManager{secret: []byte(secret), ttl: ttl}
+}
+
+func (m *TokenManager) Issue(user *domain.User) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		Username: user.Username,
+		Role:     user.Role,
+		TeamID:   user.TeamID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+		},
+	})
+	return token.SignedString(m.secret)
+}
+
+func (m *TokenManager) Parse(tokenString string) (*Principal, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(tokenString, &c, func(*jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{UserID: id, Username: c.Username, Role: c.Role, TeamID: c.TeamID}, nil
+}
@@ -0,0 +1,471 @@
+// Package authz enforces role and team scoping in front of the repository,
+// so handlers never have to trust IDs supplied by the client.
+package authz
+
+import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/domain"
+	"bake_backend/internal/repository"
+	"context"
+	"errors"
+	"strconv"
+)
+
+var ErrForbidden = repository.ErrForbidden
+
+// Require returns ErrForbidden unless the caller has one of the roles.
+func Require(p *auth.Principal, roles ...string) error {
+	if p != nil {
+		for _, role := range roles {
+			if p.Role == role {
+				return nil
+			}
+		}
+	}
+	return ErrForbidden
+}
+
+// Repository wraps a repository for a single caller:
+//   - admin has full access
+//   - marketer reads and writes marketing data, cannot see sales data
+//   - sales_lead reads marketing data and reads/writes sales data of their team only
+//   - sales_head reads marketing and sales data, approves and rejects sales data
+//   - viewer reads marketing and sales data
+//
+// Sources, teams, closed periods and available dates are readable by everyone;
+// managing them, deleted rows and the audit log are admin-only.
+type Repository struct {
+	repo repository.Repository
+	p    *auth.Principal
+}
+
+func New(repo repository.Repository, p *auth.Principal) *Repository {
+	return &Repository{repo: repo, p: p}
+}
+
+func (r *Repository) require(roles ...string) error {
+	return Require(r.p, roles...)
+}
+
+func (r *Repository) canReadMarketing() error {
+	return r.require(domain.RoleAdmin, domain.RoleMarketer, domain.RoleSalesLead, domain.RoleSalesHead, domain.RoleViewer)
+}
+
+func (r *Repository) canWriteMarketing() error {
+	return r.require(domain.RoleAdmin, domain.RoleMarketer)
+}
+
+func (r *Repository) canReadSales() error {
+	return r.require(domain.RoleAdmin, domain.RoleSalesLead, domain.RoleSalesHead, domain.RoleViewer)
+}
+
+// canWriteTeam checks that the caller may write sales rows of the team.
+func (r *Repository) canWriteTeam(teamID int) error {
+	if err := r.require(domain.RoleAdmin, domain.RoleSalesLead); err != nil {
+		return err
+	}
+	if r.p.Role == domain.RoleSalesLead && (r.p.TeamID == nil || *r.p.TeamID != teamID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// salesTeams narrows a team_ids filter to the teams the caller may read.
+// ok is false when nothing is left, so the caller must return no rows
+// instead of passing an empty filter (which means "all teams").
+func (r *Repository) salesTeams(teamIDs []string) (allowed []string, ok bool, err error) {
+	if err := r.canReadSales(); err != nil {
+		return nil, false, err
+	}
+	if r.p.Role != domain.RoleSalesLead {
+		return teamIDs, true, nil
+	}
+	if r.p.TeamID == nil {
+		return nil, false, nil
+	}
+
+	own := strconv.Itoa(*r.p.TeamID)
+	if len(teamIDs) == 0 {
+		return []string{own}, true, nil
+	}
+	for _, id := range teamIDs {
+		if id == own {
+			return []string{own}, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (r *Repository) GetMarketingSources(ctx context.Context, includeArchived bool) ([]domain.MarketingSource, error) {
+	return r.repo.GetMarketingSources(ctx, includeArchived)
+}
+
+func (r *Repository) CreateMarketingSource(ctx context.Context, source *domain.MarketingSource) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.CreateMarketingSource(ctx, source)
+}
+
+func (r *Repository) RenameMarketingSource(ctx context.Context, id int, name string) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.RenameMarketingSource(ctx, id, name)
+}
+
+func (r *Repository) ArchiveMarketingSource(ctx context.Context, id int) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.ArchiveMarketingSource(ctx, id)
+}
+
+func (r *Repository) RestoreMarketingSource(ctx context.Context, id int) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.RestoreMarketingSource(ctx, id)
+}
+
+func (r *Repository) ReorderMarketingSources(ctx context.Context, ids []int) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.ReorderMarketingSources(ctx, ids)
+}
+
+func (r *Repository) DeleteMarketingSource(ctx context.Context, id int) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.DeleteMarketingSource(ctx, id)
+}
+
+func (r *Repository) GetSalesTeams(ctx context.Context, from, to string) ([]domain.SalesTeam, error) {
+	return r.repo.GetSalesTeams(ctx, from, to)
+}
+
+func (r *Repository) CreateSalesTeam(ctx context.Context, team *domain.SalesTeam) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.CreateSalesTeam(ctx, team)
+}
+
+func (r *Repository) UpdateSalesTeam(ctx context.Context, team *domain.SalesTeam) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.UpdateSalesTeam(ctx, team)
+}
+
+func (r *Repository) DeleteSalesTeam(ctx context.Context, id int) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.DeleteSalesTeam(ctx, id)
+}
+
+func (r *Repository) GetMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error) {
+	if err := r.canReadMarketing(); err != nil {
+		return nil, err
+	}
+	return r.repo.GetMarketingData(ctx, filter)
+}
+
+func (r *Repository) GetSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error) {
+	teamIDs, ok, err := r.salesTeams(filter.IDs)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return []domain.SalesData{}, nil
+	}
+	filter.IDs = teamIDs
+	return r.repo.GetSalesData(ctx, filter)
+}
+
+func (r *Repository) EachMarketingData(ctx context.Context, filter domain.ReportFilter, fn func(domain.MarketingData) error) error {
+	if err := r.canReadMarketing(); err != nil {
+		return err
+	}
+	return r.repo.EachMarketingData(ctx, filter, fn)
+}
+
+func (r *Repository) EachSalesData(ctx context.Context, filter domain.ReportFilter, fn func(domain.SalesData) error) error {
+	teamIDs, ok, err := r.salesTeams(filter.IDs)
+	if err != nil || !ok {
+		return err
+	}
+	filter.IDs = teamIDs
+	return r.repo.EachSalesData(ctx, filter, fn)
+}
+
+func (r *Repository) GetMarketingDataByID(ctx context.Context, id int) (*domain.MarketingData, error) {
+	if err := r.canReadMarketing(); err != nil {
+		return nil, err
+	}
+	return r.repo.GetMarketingDataByID(ctx, id)
+}
+
+func (r *Repository) GetSalesDataByID(ctx context.Context, id int) (*domain.SalesData, error) {
+	if err := r.canReadSales(); err != nil {
+		return nil, err
+	}
+
+	data, err := r.repo.GetSalesDataByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Rows of other teams look the same as missing ones to a sales lead
+	if r.p.Role == domain.RoleSalesLead && (r.p.TeamID == nil || *r.p.TeamID != data.TeamID) {
+		return nil, repository.ErrNotFound
+	}
+	return data, nil
+}
+
+func (r *Repository) GetMarketingFunnel(ctx context.Context, filter domain.ReportFilter) (*domain.MarketingFunnel, error) {
+	if err := r.canReadMarketing(); err != nil {
+		return nil, err
+	}
+	return r.repo.GetMarketingFunnel(ctx, filter)
+}
+
+func (r *Repository) GetMarketingSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) ([]domain.MarketingSummary, error) {
+	if err := r.canReadMarketing(); err != nil {
+		return nil, err
+	}
+	return r.repo.GetMarketingSummary(ctx, filter, groupBy)
+}
+
+func (r *Repository) GetSalesSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) ([]domain.SalesSummary, error) {
+	teamIDs, ok, err := r.salesTeams(filter.IDs)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return []domain.SalesSummary{}, nil
+	}
+	filter.IDs = teamIDs
+	return r.repo.GetSalesSummary(ctx, filter, groupBy)
+}
+
+func (r *Repository) SaveMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (bool, error) {
+	if err := r.canWriteMarketing(); err != nil {
+		return false, err
+	}
+	return r.repo.SaveMarketingData(ctx, data, meta)
+}
+
+func (r *Repository) SaveSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (bool, error) {
+	if err := r.canWriteTeam(data.TeamID); err != nil {
+		return false, err
+	}
+	// A non-zero ID updates that row, which may belong to another team
+	if data.ID != 0 {
+		if err := r.canWriteSalesRow(ctx, data.ID); err != nil {
+			return false, err
+		}
+	}
+	return r.repo.SaveSalesData(ctx, data, meta)
+}
+
+func (r *Repository) UpdateMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) error {
+	if err := r.canWriteMarketing(); err != nil {
+		return err
+	}
+	return r.repo.UpdateMarketingData(ctx, data, meta)
+}
+
+func (r *Repository) UpdateSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) error {
+	if err := r.canWriteTeam(data.TeamID); err != nil {
+		return err
+	}
+	if err := r.canWriteSalesRow(ctx, data.ID); err != nil {
+		return err
+	}
+	return r.repo.UpdateSalesData(ctx, data, meta)
+}
+
+func (r *Repository) DeleteMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	if err := r.canWriteMarketing(); err != nil {
+		return err
+	}
+	return r.repo.DeleteMarketingData(ctx, id, meta)
+}
+
+func (r *Repository) DeleteSalesData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	if err := r.canWriteSalesRow(ctx, id); err != nil {
+		return err
+	}
+	return r.repo.DeleteSalesData(ctx, id, meta)
+}
+
+// canWriteSalesRow checks the team of a stored row. Missing rows pass, so
+// the repository reports them as not found.
+func (r *Repository) canWriteSalesRow(ctx context.Context, id int) error {
+	if err := r.require(domain.RoleAdmin, domain.RoleSalesLead); err != nil {
+		return err
+	}
+	if r.p.Role == domain.RoleAdmin {
+		return nil
+	}
+
+	existing, err := r.repo.GetSalesDataByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.canWriteTeam(existing.TeamID)
+}
+
+func (r *Repository) RestoreMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.RestoreMarketingData(ctx, id, meta)
+}
+
+func (r *Repository) RestoreSalesData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.RestoreSalesData(ctx, id, meta)
+}
+
+// ChangeMarketingStatus lets marketers submit; approving, rejecting and
+// reopening marketing data is up to admins.
+func (r *Repository) ChangeMarketingStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) ([]domain.MarketingData, error) {
+	roles := []string{domain.RoleAdmin}
+	if change.Action == domain.StatusActionSubmit {
+		roles = append(roles, domain.RoleMarketer)
+	}
+	if err := r.require(roles...); err != nil {
+		return nil, err
+	}
+	return r.repo.ChangeMarketingStatus(ctx, change, meta)
+}
+
+// ChangeSalesStatus lets sales leads submit their own team's rows; the head
+// of sales approves, rejects and reopens them.
+func (r *Repository) ChangeSalesStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) ([]domain.SalesData, error) {
+	if change.Action != domain.StatusActionSubmit {
+		if err := r.require(domain.RoleAdmin, domain.RoleSalesHead); err != nil {
+			return nil, err
+		}
+		return r.repo.ChangeSalesStatus(ctx, change, meta)
+	}
+
+	if err := r.require(domain.RoleAdmin, domain.RoleSalesLead); err != nil {
+		return nil, err
+	}
+	if r.p.Role == domain.RoleSalesLead {
+		if r.p.TeamID == nil {
+			return nil, ErrForbidden
+		}
+		for _, id := range change.IDs {
+			if id != *r.p.TeamID {
+				return nil, ErrForbidden
+			}
+		}
+		change.IDs = []int{*r.p.TeamID}
+	}
+	return r.repo.ChangeSalesStatus(ctx, change, meta)
+}
+
+func (r *Repository) GetDeletedMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error) {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+	return r.repo.GetDeletedMarketingData(ctx, filter)
+}
+
+func (r *Repository) GetDeletedSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error) {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+	return r.repo.GetDeletedSalesData(ctx, filter)
+}
+
+func (r *Repository) ImportMarketingData(ctx context.Context, rows []domain.MarketingData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error) {
+	if err := r.canWriteMarketing(); err != nil {
+		return nil, err
+	}
+	return r.repo.ImportMarketingData(ctx, rows, dryRun, meta)
+}
+
+func (r *Repository) ImportSalesData(ctx context.Context, rows []domain.SalesData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error) {
+	if err := r.require(domain.RoleAdmin, domain.RoleSalesLead); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := r.canWriteTeam(row.TeamID); err != nil {
+			return nil, err
+		}
+	}
+	return r.repo.ImportSalesData(ctx, rows, dryRun, meta)
+}
+
+func (r *Repository) SaveDailyBatch(ctx context.Context, batch *domain.DailyBatch, meta domain.AuditMeta) ([]domain.BatchRowError, error) {
+	if len(batch.Marketing) > 0 {
+		if err := r.canWriteMarketing(); err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range batch.Sales {
+		if err := r.canWriteTeam(row.TeamID); err != nil {
+			return nil, err
+		}
+		if row.ID != 0 {
+			if err := r.canWriteSalesRow(ctx, row.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(batch.Marketing) == 0 && len(batch.Sales) == 0 {
+		if err := r.require(domain.RoleAdmin, domain.RoleMarketer, domain.RoleSalesLead); err != nil {
+			return nil, err
+		}
+	}
+	return r.repo.SaveDailyBatch(ctx, batch, meta)
+}
+
+func (r *Repository) GetAuditLog(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, error) {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+	return r.repo.GetAuditLog(ctx, filter)
+}
+
+func (r *Repository) GetPeriodLocks(ctx context.Context, includeReopened bool) ([]domain.PeriodLock, error) {
+	return r.repo.GetPeriodLocks(ctx, includeReopened)
+}
+
+func (r *Repository) ClosePeriod(ctx context.Context, lock *domain.PeriodLock, meta domain.AuditMeta) error {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return err
+	}
+	return r.repo.ClosePeriod(ctx, lock, meta)
+}
+
+func (r *Repository) ReopenPeriod(ctx context.Context, id int, reason string, meta domain.AuditMeta) (*domain.PeriodLock, error) {
+	if err := r.require(domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+	return r.repo.ReopenPeriod(ctx, id, reason, meta)
+}
+
+func (r *Repository) GetAvailableDates(ctx context.Context) ([]string, error) {
+	return r.repo.GetAvailableDates(ctx)
+}
+
+func (r *Repository) GetAvailableMarketingDates(ctx context.Context) ([]string, error) {
+	return r.repo.GetAvailableMarketingDates(ctx)
+}
+
+func (r *Repository) GetAvailableSalesDates(ctx context.Context) ([]string, error) {
+	return r.repo.GetAvailableSalesDates(ctx)
+}
@@ -0,0 +1,365 @@
+package authz_test
+
+import (
+	"bake_backend/internal/auth"
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	"bake_backend/internal/repository"
+	"bake_backend/internal/seed"
+	"context"
+	"errors"
+	"testing"
+)
+
+var (
+	teamOne = 1
+
+	admin       = &auth.Principal{UserID: 1, Role: domain.RoleAdmin}
+	marketer    = &auth.Principal{UserID: 2, Role: domain.RoleMarketer}
+	lead        = &auth.Principal{UserID: 3, Role: domain.RoleSalesLead, TeamID: &teamOne}
+	leadNoTeam  = &auth.Principal{UserID: 4, Role: domain.RoleSalesLead}
+	head        = &auth.Principal{UserID: 5, Role: domain.RoleSalesHead}
+	viewer      = &auth.Principal{UserID: 6, Role: domain.RoleViewer}
+	unknownRole = &auth.Principal{UserID: 7, Role: "intern"}
+)
+
+const day = "2026-01-15"
+
+// fixture is a seeded memory store with one marketing row and one sales row
+// for each of teams 1 and 2, all drafts of day.
+type fixture struct {
+	repo      *repository.MemoryRepository
+	marketing domain.MarketingData
+	teamOne   domain.SalesData
+	teamTwo   domain.SalesData
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &fixture{repo: repository.NewMemoryRepository()}
+	if _, err := seed.Run(ctx, f.repo, seed.ProfileProd); err != nil {
+		t.Fatal(err)
+	}
+
+	f.marketing = domain.MarketingData{Date: day, SourceID: 1, Leads: 10}
+	f.teamOne = domain.SalesData{Date: day, TeamID: 1, Leads: 5}
+	f.teamTwo = domain.SalesData{Date: day, TeamID: 2, Leads: 7}
+	if _, err := f.repo.SaveMarketingData(ctx, &f.marketing, domain.AuditMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*domain.SalesData{&f.teamOne, &f.teamTwo} {
+		if _, err := f.repo.SaveSalesData(ctx, d, domain.AuditMeta{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func (f *fixture) as(p *auth.Principal) *authz.Repository {
+	return authz.New(f.repo, p)
+}
+
+func TestRoleMatrix(t *testing.T) {
+	ctx := context.Background()
+	everyone := []*auth.Principal{admin, marketer, lead, leadNoTeam, head, viewer, unknownRole, nil}
+
+	tests := []struct {
+		name    string
+		allowed []*auth.Principal
+		op      func(f *fixture, r *authz.Repository) error
+	}{
+		{"read marketing", []*auth.Principal{admin, marketer, lead, leadNoTeam, head, viewer}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.GetMarketingData(ctx, domain.ReportFilter{})
+			return err
+		}},
+		{"read marketing funnel", []*auth.Principal{admin, marketer, lead, leadNoTeam, head, viewer}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.GetMarketingFunnel(ctx, domain.ReportFilter{})
+			return err
+		}},
+		{"write marketing", []*auth.Principal{admin, marketer}, func(f *fixture, r *authz.Repository) error {
+			d := domain.MarketingData{Date: day, SourceID: 2}
+			_, err := r.SaveMarketingData(ctx, &d, domain.AuditMeta{})
+			return err
+		}},
+		{"delete marketing", []*auth.Principal{admin, marketer}, func(f *fixture, r *authz.Repository) error {
+			return r.DeleteMarketingData(ctx, f.marketing.ID, domain.AuditMeta{})
+		}},
+		{"submit marketing", []*auth.Principal{admin, marketer}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.ChangeMarketingStatus(ctx, domain.StatusChange{Date: day, Action: domain.StatusActionSubmit}, domain.AuditMeta{})
+			return err
+		}},
+		{"read sales", []*auth.Principal{admin, lead, leadNoTeam, head, viewer}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.GetSalesData(ctx, domain.ReportFilter{})
+			return err
+		}},
+		{"read sales summary", []*auth.Principal{admin, lead, leadNoTeam, head, viewer}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.GetSalesSummary(ctx, domain.ReportFilter{}, domain.GroupByMonth)
+			return err
+		}},
+		{"export sales", []*auth.Principal{admin, lead, leadNoTeam, head, viewer}, func(f *fixture, r *authz.Repository) error {
+			return r.EachSalesData(ctx, domain.ReportFilter{}, func(domain.SalesData) error { return nil })
+		}},
+		{"write own team's sales", []*auth.Principal{admin, lead}, func(f *fixture, r *authz.Repository) error {
+			d := domain.SalesData{Date: day, TeamID: 1, Leads: 6}
+			_, err := r.SaveSalesData(ctx, &d, domain.AuditMeta{})
+			return err
+		}},
+		{"write another team's sales", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			d := domain.SalesData{Date: day, TeamID: 2, Leads: 6}
+			_, err := r.SaveSalesData(ctx, &d, domain.AuditMeta{})
+			return err
+		}},
+		{"delete another team's sales", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			return r.DeleteSalesData(ctx, f.teamTwo.ID, domain.AuditMeta{})
+		}},
+		{"import sales", []*auth.Principal{admin, lead}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.ImportSalesData(ctx, []domain.SalesData{{Date: day, TeamID: 1}}, true, domain.AuditMeta{})
+			return err
+		}},
+		{"submit sales", []*auth.Principal{admin, lead}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.ChangeSalesStatus(ctx, domain.StatusChange{Date: day, Action: domain.StatusActionSubmit}, domain.AuditMeta{})
+			return err
+		}},
+		{"approve sales", []*auth.Principal{admin, head}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.ChangeSalesStatus(ctx, domain.StatusChange{Date: day, Action: domain.StatusActionApprove}, domain.AuditMeta{})
+			return err
+		}},
+		{"empty daily batch", []*auth.Principal{admin, marketer, lead, leadNoTeam}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.SaveDailyBatch(ctx, &domain.DailyBatch{}, domain.AuditMeta{})
+			return err
+		}},
+		{"read deleted rows", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.GetDeletedSalesData(ctx, domain.ReportFilter{})
+			return err
+		}},
+		{"restore rows", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			err := r.RestoreMarketingData(ctx, f.marketing.ID, domain.AuditMeta{})
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil
+			}
+			return err
+		}},
+		{"read the audit log", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			_, err := r.GetAuditLog(ctx, domain.AuditFilter{})
+			return err
+		}},
+		{"close a period", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			return r.ClosePeriod(ctx, &domain.PeriodLock{From: "2025-01-01", To: "2025-01-31"}, domain.AuditMeta{})
+		}},
+		{"manage sources", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			return r.CreateMarketingSource(ctx, &domain.MarketingSource{Name: "Radio"})
+		}},
+		{"manage teams", []*auth.Principal{admin}, func(f *fixture, r *authz.Repository) error {
+			return r.CreateSalesTeam(ctx, &domain.SalesTeam{Name: "Team 9"})
+		}},
+		{"read sources and periods", everyone, func(f *fixture, r *authz.Repository) error {
+			if _, err := r.GetMarketingSources(ctx, false); err != nil {
+				return err
+			}
+			_, err := r.GetPeriodLocks(ctx, false)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		for _, p := range everyone {
+			allowed := false
+			for _, a := range tt.allowed {
+				allowed = allowed || a == p
+			}
+			t.Run(tt.name+"/"+roleName(p), func(t *testing.T) {
+				f := newFixture(t)
+				// Allowed calls may still fail for other reasons, e.g. the
+				// status workflow
+				err := tt.op(f, f.as(p))
+				switch {
+				case allowed && errors.Is(err, authz.ErrForbidden):
+					t.Errorf("got %v, want it allowed", err)
+				case !allowed && !errors.Is(err, authz.ErrForbidden):
+					t.Errorf("got %v, want ErrForbidden", err)
+				}
+			})
+		}
+	}
+}
+
+func roleName(p *auth.Principal) string {
+	switch {
+	case p == nil:
+		return "anonymous"
+	case p.Role == domain.RoleSalesLead && p.TeamID == nil:
+		return "sales_lead without a team"
+	}
+	return p.Role
+}
+
+func teamsOf(rows []domain.SalesData) []int {
+	var teams []int
+	for _, d := range rows {
+		teams = append(teams, d.TeamID)
+	}
+	return teams
+}
+
+func TestSalesLeadReadsOwnTeamOnly(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	tests := []struct {
+		name  string
+		p     *auth.Principal
+		ids   []string
+		teams []int
+	}{
+		{"lead, no filter", lead, nil, []int{1}},
+		{"lead, own team", lead, []string{"1"}, []int{1}},
+		{"lead, foreign team", lead, []string{"2"}, nil},
+		{"lead, own and foreign teams", lead, []string{"2", "1"}, []int{1}},
+		{"lead without a team", leadNoTeam, nil, nil},
+		{"head, no filter", head, nil, []int{1, 2}},
+		{"head, foreign team", head, []string{"2"}, []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := f.as(tt.p)
+			filter := domain.ReportFilter{IDs: tt.ids}
+
+			rows, err := r.GetSalesData(ctx, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := teamsOf(rows); !equalInts(got, tt.teams) {
+				t.Errorf("GetSalesData: teams %v, want %v", got, tt.teams)
+			}
+
+			var streamed []domain.SalesData
+			err = r.EachSalesData(ctx, filter, func(d domain.SalesData) error {
+				streamed = append(streamed, d)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := teamsOf(streamed); !equalInts(got, tt.teams) {
+				t.Errorf("EachSalesData: teams %v, want %v", got, tt.teams)
+			}
+
+			summaries, err := r.GetSalesSummary(ctx, filter, domain.GroupByDay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var leads int
+			for _, s := range summaries {
+				leads += s.Leads
+			}
+			want := 0
+			for _, team := range tt.teams {
+				want += map[int]int{1: f.teamOne.Leads, 2: f.teamTwo.Leads}[team]
+			}
+			if leads != want {
+				t.Errorf("GetSalesSummary: %d leads, want %d", leads, want)
+			}
+		})
+	}
+
+	// Another team's row looks missing
+	if _, err := f.as(lead).GetSalesDataByID(ctx, f.teamTwo.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetSalesDataByID of team 2: got %v, want ErrNotFound", err)
+	}
+	if _, err := f.as(lead).GetSalesDataByID(ctx, f.teamOne.ID); err != nil {
+		t.Errorf("GetSalesDataByID of team 1: %v", err)
+	}
+}
+
+func TestSalesLeadWritesOwnTeamOnly(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		op   func(f *fixture, r *authz.Repository) error
+	}{
+		{"moving another team's row into the own team", func(f *fixture, r *authz.Repository) error {
+			d := f.teamTwo
+			d.TeamID = 1
+			_, err := r.SaveSalesData(ctx, &d, domain.AuditMeta{})
+			return err
+		}},
+		{"updating another team's row", func(f *fixture, r *authz.Repository) error {
+			d := f.teamTwo
+			d.TeamID = 1
+			return r.UpdateSalesData(ctx, &d, domain.AuditMeta{})
+		}},
+		{"importing another team's row", func(f *fixture, r *authz.Repository) error {
+			_, err := r.ImportSalesData(ctx, []domain.SalesData{{Date: day, TeamID: 1}, {Date: day, TeamID: 2}}, false, domain.AuditMeta{})
+			return err
+		}},
+		{"batching another team's row", func(f *fixture, r *authz.Repository) error {
+			_, err := r.SaveDailyBatch(ctx, &domain.DailyBatch{Date: day, Sales: []domain.SalesData{{Date: day, TeamID: 2}}}, domain.AuditMeta{})
+			return err
+		}},
+		{"batching a row by the ID of another team's", func(f *fixture, r *authz.Repository) error {
+			_, err := r.SaveDailyBatch(ctx, &domain.DailyBatch{Date: day, Sales: []domain.SalesData{{ID: f.teamTwo.ID, Date: day, TeamID: 1}}}, domain.AuditMeta{})
+			return err
+		}},
+		{"submitting another team", func(f *fixture, r *authz.Repository) error {
+			_, err := r.ChangeSalesStatus(ctx, domain.StatusChange{Date: day, IDs: []int{2}, Action: domain.StatusActionSubmit}, domain.AuditMeta{})
+			return err
+		}},
+		{"submitting the own and another team", func(f *fixture, r *authz.Repository) error {
+			_, err := r.ChangeSalesStatus(ctx, domain.StatusChange{Date: day, IDs: []int{1, 2}, Action: domain.StatusActionSubmit}, domain.AuditMeta{})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			if err := tt.op(f, f.as(lead)); !errors.Is(err, authz.ErrForbidden) {
+				t.Errorf("got %v, want ErrForbidden", err)
+			}
+			stored, err := f.repo.GetSalesDataByID(ctx, f.teamTwo.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Version != f.teamTwo.Version || stored.Status != domain.StatusDraft {
+				t.Errorf("team 2's row changed: %+v", stored)
+			}
+		})
+	}
+}
+
+func TestSalesLeadSubmitIsScopedToOwnTeam(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	// No team IDs means all teams, narrowed to the lead's
+	changed, err := f.as(lead).ChangeSalesStatus(ctx, domain.StatusChange{Date: day, Action: domain.StatusActionSubmit}, domain.AuditMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := teamsOf(changed); !equalInts(got, []int{1}) {
+		t.Errorf("submitted teams %v, want [1]", got)
+	}
+	stored, err := f.repo.GetSalesDataByID(ctx, f.teamTwo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != domain.StatusDraft {
+		t.Errorf("team 2 is %s, want draft", stored.Status)
+	}
+
+	if _, err := f.as(leadNoTeam).ChangeSalesStatus(ctx, domain.StatusChange{Date: day, Action: domain.StatusActionSubmit}, domain.AuditMeta{}); !errors.Is(err, authz.ErrForbidden) {
+		t.Errorf("lead without a team: got %v, want ErrForbidden", err)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
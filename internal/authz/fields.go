@@ -0,0 +1,171 @@
+package authz
+
+import (
+	"bake_backend/internal/domain"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Field actions: a hidden field is left out of responses and exports, a
+// masked one is kept but its value is replaced (null in JSON, "***" in exports).
+const (
+	FieldHide = "hide"
+	FieldMask = "mask"
+)
+
+const (
+	EntityMarketing = "marketing"
+	EntitySales     = "sales"
+)
+
+// restrictedFields lists the fields a policy may restrict and the derived
+// KPIs that give them away, e.g. expense can be recovered from CPL and leads.
+var restrictedFields = map[string]map[string][]string{
+	EntityMarketing: {
+		"expense":          {"cpl", "cost_per_trial", "cost_per_payment", "romi"},
+		"leads":            {"cpl", "lead_to_scheduled", "lead_to_payment"},
+		"trials_scheduled": {"lead_to_scheduled", "scheduled_to_conducted"},
+		"trials_conducted": {"cost_per_trial", "scheduled_to_conducted", "conducted_to_payment"},
+		"payments":         {"cost_per_payment", "conducted_to_payment", "lead_to_payment"},
+		"total_amount":     {"romi"},
+	},
+	EntitySales: {
+		"leads":            nil,
+		"trials_scheduled": nil,
+		"trials_conducted": nil,
+		"payments":         nil,
+		"total_amount":     nil,
+		"kaspi_refund":     nil,
+	},
+}
+
+// FieldPolicy maps role → entity → field → action, e.g.
+//
+//	{"sales_lead": {"marketing": {"expense": "hide"}},
+//	 "viewer": {"sales": {"total_amount": "mask", "kaspi_refund": "mask"}}}
+type FieldPolicy map[string]map[string]map[string]string
+
+// DefaultFieldPolicy is used when no policy file is configured: sales leads
+// don't see marketing expense.
+func DefaultFieldPolicy() FieldPolicy {
+	return FieldPolicy{
+		domain.RoleSalesLead: {EntityMarketing: {"expense": FieldHide}},
+	}
+}
+
+// LoadFieldPolicy reads a JSON policy file, falling back to the default
+// policy when path is empty.
+func LoadFieldPolicy(path string) (FieldPolicy, error) {
+	if path == "" {
+		return DefaultFieldPolicy(), nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("field policy: %w", err)
+	}
+
+	var p FieldPolicy
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("field policy %s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("field policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p FieldPolicy) validate() error {
+	for role, entities := range p {
+		if !domain.IsValidRole(role) {
+			return fmt.Errorf("unknown role %q", role)
+		}
+		for entity, fields := range entities {
+			known, ok := restrictedFields[entity]
+			if !ok {
+				return fmt.Errorf("unknown entity %q, expected marketing or sales", entity)
+			}
+			for field, action := range fields {
+				if _, ok := known[field]; !ok {
+					return fmt.Errorf("%s: field %q cannot be restricted", entity, field)
+				}
+				if action != FieldHide && action != FieldMask {
+					return fmt.Errorf("%s.%s: unknown action %q, expected hide or mask", entity, field, action)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Rules returns the restricted JSON fields of an entity for a role,
+// including derived KPIs. Hiding wins over masking.
+func (p FieldPolicy) Rules(role, entity string) map[string]string {
+	fields := p[role][entity]
+	if len(fields) == 0 {
+		return nil
+	}
+
+	rules := make(map[string]string)
+	set := func(field, action string) {
+		if rules[field] != FieldHide {
+			rules[field] = action
+		}
+	}
+	for field, action := range fields {
+		set(field, action)
+		for _, derived := range restrictedFields[entity][field] {
+			set(derived, action)
+		}
+	}
+	return rules
+}
+
+// Apply returns v with the role's rules for entity applied. Restricted keys
+// are removed or nulled in every nested object, so the same call covers
+// rows, summaries, funnels and import diffs.
+func (p FieldPolicy) Apply(role, entity string, v interface{}) (interface{}, error) {
+	rules := p.Rules(role, entity)
+	if len(rules) == 0 {
+		return v, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	redact(generic, rules)
+	return generic, nil
+}
+
+func redact(v interface{}, rules map[string]string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			switch rules[key] {
+			case FieldHide:
+				delete(val, key)
+			case FieldMask:
+				val[key] = nil
+			default:
+				redact(child, rules)
+			}
+		}
+	case []interface{}:
+		for _, child := range val {
+			redact(child, rules)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package authz_test
+
+import (
+	"bake_backend/internal/authz"
+	"bake_backend/internal/domain"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRulesIncludeDerivedKPIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy authz.FieldPolicy
+		role   string
+		entity string
+		want   map[string]string
+	}{
+		{
+			name:   "default policy",
+			policy: authz.DefaultFieldPolicy(),
+			role:   domain.RoleSalesLead,
+			entity: authz.EntityMarketing,
+			want:   map[string]string{"expense": "hide", "cpl": "hide", "cost_per_trial": "hide", "cost_per_payment": "hide", "romi": "hide"},
+		},
+		{
+			name:   "unrestricted role",
+			policy: authz.DefaultFieldPolicy(),
+			role:   domain.RoleAdmin,
+			entity: authz.EntityMarketing,
+			want:   nil,
+		},
+		{
+			name:   "unrestricted entity",
+			policy: authz.DefaultFieldPolicy(),
+			role:   domain.RoleSalesLead,
+			entity: authz.EntitySales,
+			want:   nil,
+		},
+		{
+			name: "hiding wins over masking",
+			policy: authz.FieldPolicy{domain.RoleViewer: {authz.EntityMarketing: {
+				"leads":        authz.FieldHide,
+				"total_amount": authz.FieldMask,
+			}}},
+			role:   domain.RoleViewer,
+			entity: authz.EntityMarketing,
+			want:   map[string]string{"leads": "hide", "cpl": "hide", "lead_to_scheduled": "hide", "lead_to_payment": "hide", "total_amount": "mask", "romi": "mask"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Rules(tt.role, tt.entity); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRedactsNestedObjects(t *testing.T) {
+	cpl, romi := 10.0, 2.5
+	funnel := &domain.MarketingFunnel{
+		Sources: []domain.MarketingFunnelMetrics{{SourceID: 1, Expense: 100, Leads: 10, CPL: &cpl, ROMI: &romi}},
+		Total:   domain.MarketingFunnelMetrics{Expense: 100, Leads: 10, CPL: &cpl, ROMI: &romi},
+	}
+	policy := authz.FieldPolicy{
+		domain.RoleSalesLead: {authz.EntityMarketing: {"expense": authz.FieldHide}},
+		domain.RoleViewer:    {authz.EntityMarketing: {"expense": authz.FieldMask}},
+	}
+
+	out, err := policy.Apply(domain.RoleSalesLead, authz.EntityMarketing, funnel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(out)
+	for _, key := range []string{"expense", "cpl", "romi", "cost_per_trial", "cost_per_payment"} {
+		if strings.Contains(string(raw), `"`+key+`"`) {
+			t.Errorf("hidden %s is in %s", key, raw)
+		}
+	}
+	if strings.Count(string(raw), `"leads":10`) != 2 {
+		t.Errorf("leads went missing: %s", raw)
+	}
+
+	out, err = policy.Apply(domain.RoleViewer, authz.EntityMarketing, funnel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = json.Marshal(out)
+	if strings.Count(string(raw), `"expense":null`) != 2 || strings.Count(string(raw), `"cpl":null`) != 2 {
+		t.Errorf("masked fields not nulled: %s", raw)
+	}
+
+	// Unrestricted callers get the value itself
+	if out, _ := policy.Apply(domain.RoleAdmin, authz.EntityMarketing, funnel); out != interface{}(funnel) {
+		t.Errorf("admin got a copy: %#v", out)
+	}
+}
+
+func TestLoadFieldPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", `{"viewer": {"sales": {"total_amount": "mask"}}}`, ""},
+		{"unknown role", `{"intern": {"sales": {"total_amount": "mask"}}}`, `unknown role "intern"`},
+		{"unknown entity", `{"viewer": {"users": {"role": "hide"}}}`, `unknown entity "users"`},
+		{"unrestrictable field", `{"viewer": {"sales": {"team_id": "hide"}}}`, `field "team_id" cannot be restricted`},
+		{"derived KPI", `{"viewer": {"marketing": {"cpl": "hide"}}}`, `field "cpl" cannot be restricted`},
+		{"unknown action", `{"viewer": {"sales": {"leads": "blur"}}}`, `unknown action "blur"`},
+		{"malformed", `{"viewer": [`, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := authz.LoadFieldPolicy(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	policy, err := authz.LoadFieldPolicy("")
+	if err != nil || !reflect.DeepEqual(policy, authz.DefaultFieldPolicy()) {
+		t.Errorf("no file: got %v, %v, want the default policy", policy, err)
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var settings = []string{
+	"STORAGE", "SQLITE_PATH", "MIGRATE_ON_START", "MIGRATE_ALLOW_DESTRUCTIVE", "SEED_PROFILE",
+	"DATABASE_URL", "DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME", "DB_SSLMODE",
+	"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_CONN_MAX_IDLE_TIME",
+	"DB_QUERY_TIMEOUT", "DB_BULK_TIMEOUT",
+	"HTTP_ADDR", "PORT", "HTTP_READ_TIMEOUT", "HTTP_READ_HEADER_TIMEOUT", "HTTP_WRITE_TIMEOUT",
+	"HTTP_IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT", "SHUTDOWN_DRAIN_DELAY",
+	"JWT_SECRET", "JWT_ACCESS_TTL", "JWT_REFRESH_TTL", "ADMIN_USERNAME", "ADMIN_PASSWORD",
+	"FIELD_POLICY_FILE", "VALIDATION_MODE", "BUSINESS_TZ",
+}
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+// setenv clears every setting, then sets the pairs of key, value.
+func setenv(t *testing.T, pairs ...string) {
+	t.Helper()
+	for _, key := range settings {
+		t.Setenv(key, "")
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		t.Setenv(pairs[i], pairs[i+1])
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		env  []string
+		want []string
+	}{
+		{
+			name: "postgres without settings",
+			env:  nil,
+			want: []string{"DB_USER is required", "DB_NAME is required", "JWT_SECRET must be set"},
+		},
+		{
+			name: "short secret",
+			env:  []string{"DB_USER", "u", "DB_NAME", "d", "JWT_SECRET", "short"},
+			want: []string{"JWT_SECRET must be set"},
+		},
+		{
+			name: "unparsable values",
+			env:  []string{"DB_USER", "u", "DB_NAME", "d", "JWT_SECRET", secret, "DB_PORT", "x", "HTTP_READ_TIMEOUT", "0", "DB_QUERY_TIMEOUT", "-1s", "BUSINESS_TZ", "Mars/Olympus"},
+			want: []string{"DB_PORT: invalid number", "HTTP_READ_TIMEOUT: invalid duration", "DB_QUERY_TIMEOUT: invalid duration", "BUSINESS_TZ: unknown time zone"},
+		},
+		{
+			name: "out of range values",
+			env:  []string{"DB_USER", "u", "DB_NAME", "d", "JWT_SECRET", secret, "DB_PORT", "70000", "DB_SSLMODE", "maybe", "DB_MAX_OPEN_CONNS", "2", "DB_MAX_IDLE_CONNS", "3", "VALIDATION_MODE", "lenient"},
+			want: []string{"DB_PORT: 70000", "DB_SSLMODE: invalid mode", "DB_MAX_IDLE_CONNS (3) must not exceed", "VALIDATION_MODE: invalid mode"},
+		},
+		{
+			name: "bulk timeout outlasting the write timeout",
+			env:  []string{"DB_USER", "u", "DB_NAME", "d", "JWT_SECRET", secret, "DB_BULK_TIMEOUT", "60s"},
+			want: []string{"DB_BULK_TIMEOUT (1m0s) must be shorter than HTTP_WRITE_TIMEOUT (1m0s)"},
+		},
+		{
+			name: "malformed database URL",
+			env:  []string{"DATABASE_URL", "mysql://host/db", "JWT_SECRET", secret},
+			want: []string{"DATABASE_URL: expected postgres://"},
+		},
+		{
+			name: "unknown storage",
+			opts: Options{Storage: "redis"},
+			env:  []string{"JWT_SECRET", secret},
+			want: []string{"STORAGE: invalid backend"},
+		},
+		{
+			name: "unknown seed profile",
+			opts: Options{Storage: StorageMemory},
+			env:  []string{"SEED_PROFILE", "staging"},
+			want: []string{"SEED_PROFILE: invalid profile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, tt.env...)
+			_, err := LoadConfig(tt.opts)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tt.want) {
+				t.Errorf("got %d problems, want %d: %v", got, len(tt.want), err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	setenv(t, "DB_USER", "u", "DB_NAME", "d", "JWT_SECRET", secret)
+	cfg, err := LoadConfig(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBHost != legacyDBHost {
+		t.Errorf("DBHost %q, want the legacy host", cfg.DBHost)
+	}
+	if cfg.HTTPAddr != ":8080" || cfg.DBQueryTimeout != 15*time.Second || cfg.DBBulkTimeout != 50*time.Second {
+		t.Errorf("defaults: %+v", cfg)
+	}
+	if cfg.BusinessLocation.String() != "Asia/Almaty" {
+		t.Errorf("BusinessLocation %s", cfg.BusinessLocation)
+	}
+}
+
+func TestLoadConfigZeroDisablesTimeouts(t *testing.T) {
+	setenv(t, "DB_HOST", "db", "DB_USER", "u", "DB_NAME", "d", "JWT_SECRET", secret,
+		"DB_QUERY_TIMEOUT", "0", "DB_BULK_TIMEOUT", "0s", "SHUTDOWN_DRAIN_DELAY", "0")
+	cfg, err := LoadConfig(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBQueryTimeout != 0 || cfg.DBBulkTimeout != 0 || cfg.ShutdownDrainDelay != 0 {
+		t.Errorf("timeouts %s, %s, %s, want all zero", cfg.DBQueryTimeout, cfg.DBBulkTimeout, cfg.ShutdownDrainDelay)
+	}
+	if cfg.DBHost != "db" {
+		t.Errorf("DBHost %q, want db", cfg.DBHost)
+	}
+}
+
+func TestLoadConfigServerSettingsOnlyForTheServer(t *testing.T) {
+	// Subcommands such as migrate need no JWT secret
+	setenv(t, "DATABASE_URL", "postgres://u:p@db:5432/d")
+	if _, err := LoadConfig(Options{Command: "migrate"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The memory backend generates one
+	setenv(t)
+	cfg, err := LoadConfig(Options{Storage: StorageMemory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.JWTSecret) < 32 {
+		t.Errorf("generated secret %q", cfg.JWTSecret)
+	}
+}
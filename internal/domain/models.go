@@ -1,49 +1,363 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Удаляем ReportDate struct - больше не нужен
 
 type MarketingSource struct {
-	ID        int       `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID         int        `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	SortOrder  int        `json:"sort_order" db:"sort_order"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// SalesTeam exists from ActiveFrom to ActiveTo inclusive (YYYY-MM-DD);
+// a nil bound means the period is open on that side.
 type SalesTeam struct {
-	ID        int       `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID         int       `json:"id" db:"id"`
+	Name       string    `json:"name" db:"name"`
+	ActiveFrom *string   `json:"active_from" db:"active_from"`
+	ActiveTo   *string   `json:"active_to" db:"active_to"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type MarketingData struct {
-	ID              int       `json:"id" db:"id"`
-	Date            string    `json:"date" db:"date"` // Новое поле вместо ReportDateID
-	SourceID        int       `json:"source_id" db:"source_id"`
-	Expense         float64   `json:"expense" db:"expense"`
-	Leads           int       `json:"leads" db:"leads"`
-	TrialsScheduled int       `json:"trials_scheduled" db:"trials_scheduled"`
-	TrialsConducted int       `json:"trials_conducted" db:"trials_conducted"`
-	Payments        int       `json:"payments" db:"payments"`
-	TotalAmount     float64   `json:"total_amount" db:"total_amount"`
-	IsSaved         bool      `json:"is_saved" db:"is_saved"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	ID              int        `json:"id" db:"id"`
+	Date            string     `json:"date" db:"date"` // Новое поле вместо ReportDateID
+	SourceID        int        `json:"source_id" db:"source_id"`
+	Expense         float64    `json:"expense" db:"expense"`
+	Leads           int        `json:"leads" db:"leads"`
+	TrialsScheduled int        `json:"trials_scheduled" db:"trials_scheduled"`
+	TrialsConducted int        `json:"trials_conducted" db:"trials_conducted"`
+	Payments        int        `json:"payments" db:"payments"`
+	TotalAmount     float64    `json:"total_amount" db:"total_amount"`
+	Status          string     `json:"status" db:"status"`
+	StatusComment   *string    `json:"status_comment,omitempty" db:"status_comment"`
+	StatusChangedBy *string    `json:"status_changed_by,omitempty" db:"status_changed_by"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty" db:"status_changed_at"`
+	Version         int        `json:"version" db:"version"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
 type SalesData struct {
-	ID              int       `json:"id" db:"id"`
-	Date            string    `json:"date" db:"date"` // Новое поле вместо ReportDateID
-	TeamID          int       `json:"team_id" db:"team_id"`
-	Leads           int       `json:"leads" db:"leads"`
-	TrialsScheduled int       `json:"trials_scheduled" db:"trials_scheduled"`
-	TrialsConducted int       `json:"trials_conducted" db:"trials_conducted"`
-	Payments        int       `json:"payments" db:"payments"`
-	TotalAmount     float64   `json:"total_amount" db:"total_amount"`
-	KaspiRefund     float64   `json:"kaspi_refund" db:"kaspi_refund"`
-	IsSaved         bool      `json:"is_saved" db:"is_saved"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	ID              int        `json:"id" db:"id"`
+	Date            string     `json:"date" db:"date"` // Новое поле вместо ReportDateID
+	TeamID          int        `json:"team_id" db:"team_id"`
+	Leads           int        `json:"leads" db:"leads"`
+	TrialsScheduled int        `json:"trials_scheduled" db:"trials_scheduled"`
+	TrialsConducted int        `json:"trials_conducted" db:"trials_conducted"`
+	Payments        int        `json:"payments" db:"payments"`
+	TotalAmount     float64    `json:"total_amount" db:"total_amount"`
+	KaspiRefund     float64    `json:"kaspi_refund" db:"kaspi_refund"`
+	Status          string     `json:"status" db:"status"`
+	StatusComment   *string    `json:"status_comment,omitempty" db:"status_comment"`
+	StatusChangedBy *string    `json:"status_changed_by,omitempty" db:"status_changed_by"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty" db:"status_changed_at"`
+	Version         int        `json:"version" db:"version"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// Report rows go draft → submitted → approved, or submitted → rejected and
+// back to submitted once fixed. Reopen returns a submitted or approved row to
+// draft. Only draft and rejected rows can be edited; editing a rejected row
+// makes it a draft again.
+const (
+	StatusDraft     = "draft"
+	StatusSubmitted = "submitted"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+)
+
+const (
+	StatusActionSubmit  = "submit"
+	StatusActionApprove = "approve"
+	StatusActionReject  = "reject"
+	StatusActionReopen  = "reopen"
+)
+
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusDraft, StatusSubmitted, StatusApproved, StatusRejected:
+		return true
+	}
+	return false
+}
+
+// NextStatus returns the status an action leads to from current, and false
+// if the action is not allowed in that status.
+func NextStatus(current, action string) (string, bool) {
+	switch {
+	case action == StatusActionSubmit && (current == StatusDraft || current == StatusRejected):
+		return StatusSubmitted, true
+	case action == StatusActionApprove && current == StatusSubmitted:
+		return StatusApproved, true
+	case action == StatusActionReject && current == StatusSubmitted:
+		return StatusRejected, true
+	case action == StatusActionReopen && (current == StatusSubmitted || current == StatusApproved):
+		return StatusDraft, true
+	}
+	return "", false
+}
+
+// IsEditableStatus reports whether rows in the status may be changed or deleted.
+func IsEditableStatus(status string) bool {
+	return status == StatusDraft || status == StatusRejected
+}
+
+// StatusChange applies a workflow action to all rows of a date, optionally
+// limited to some sources (marketing) or teams (sales).
+type StatusChange struct {
+	Date    string
+	IDs     []int
+	Action  string
+	Comment string
+}
+
+// ReportFilter selects report rows. IDs are source IDs for marketing data and
+// team IDs for sales data; an empty Status matches rows in any status.
+type ReportFilter struct {
+	From   string
+	To     string
+	IDs    []string
+	Status string
+}
+
+// MarketingFunnelMetrics holds summed marketing figures and the KPIs derived from them.
+// Ratios are nil when their denominator is zero.
+type MarketingFunnelMetrics struct {
+	SourceID             int      `json:"source_id,omitempty"`
+	SourceName           string   `json:"source_name,omitempty"`
+	Expense              float64  `json:"expense"`
+	Leads                int      `json:"leads"`
+	TrialsScheduled      int      `json:"trials_scheduled"`
+	TrialsConducted      int      `json:"trials_conducted"`
+	Payments             int      `json:"payments"`
+	TotalAmount          float64  `json:"total_amount"`
+	CPL                  *float64 `json:"cpl"`
+	CostPerTrial         *float64 `json:"cost_per_trial"`
+	CostPerPayment       *float64 `json:"cost_per_payment"`
+	LeadToScheduled      *float64 `json:"lead_to_scheduled"`
+	ScheduledToConducted *float64 `json:"scheduled_to_conducted"`
+	ConductedToPayment   *float64 `json:"conducted_to_payment"`
+	LeadToPayment        *float64 `json:"lead_to_payment"`
+	ROMI                 *float64 `json:"romi"`
+}
+
+type MarketingFunnel struct {
+	From    string                   `json:"from,omitempty"`
+	To      string                   `json:"to,omitempty"`
+	Sources []MarketingFunnelMetrics `json:"sources"`
+	Total   MarketingFunnelMetrics   `json:"total"`
+}
+
+// Time buckets supported by the summary (group_by) mode of the report endpoints.
+const (
+	GroupByDay     = "day"
+	GroupByWeek    = "week"
+	GroupByMonth   = "month"
+	GroupByQuarter = "quarter"
+)
+
+func IsValidGroupBy(groupBy string) bool {
+	switch groupBy {
+	case GroupByDay, GroupByWeek, GroupByMonth, GroupByQuarter:
+		return true
+	}
+	return false
+}
+
+// MarketingSummary is marketing data summed per time bucket and source.
+// Period is the first day of the bucket (YYYY-MM-DD).
+type MarketingSummary struct {
+	Period          string  `json:"period"`
+	SourceID        int     `json:"source_id"`
+	Expense         float64 `json:"expense"`
+	Leads           int     `json:"leads"`
+	TrialsScheduled int     `json:"trials_scheduled"`
+	TrialsConducted int     `json:"trials_conducted"`
+	Payments        int     `json:"payments"`
+	TotalAmount     float64 `json:"total_amount"`
+}
+
+// SalesSummary is sales data summed per time bucket and team.
+type SalesSummary struct {
+	Period          string  `json:"period"`
+	TeamID          int     `json:"team_id"`
+	Leads           int     `json:"leads"`
+	TrialsScheduled int     `json:"trials_scheduled"`
+	TrialsConducted int     `json:"trials_conducted"`
+	Payments        int     `json:"payments"`
+	TotalAmount     float64 `json:"total_amount"`
+	KaspiRefund     float64 `json:"kaspi_refund"`
+}
+
+// Row outcomes of a spreadsheet import.
+const (
+	ImportActionInsert    = "insert"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+	ImportActionError     = "error"
+)
+
+type ImportChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+type ImportRowResult struct {
+	Line     int                     `json:"line"`
+	Date     string                  `json:"date,omitempty"`
+	Name     string                  `json:"name,omitempty"`
+	Action   string                  `json:"action"`
+	Changes  map[string]ImportChange `json:"changes,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+	Fields   []FieldError            `json:"fields,omitempty"`
+	Warnings []FieldError            `json:"warnings,omitempty"`
+}
+
+type ImportResult struct {
+	DryRun    bool              `json:"dry_run"`
+	Applied   bool              `json:"applied"`
+	Inserted  int               `json:"inserted"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Errors    int               `json:"errors"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// DailyBatch is the whole data-entry grid for a date (or a range of dates).
+// Rows without a date inherit Date.
+type DailyBatch struct {
+	Date      string          `json:"date,omitempty"`
+	Marketing []MarketingData `json:"marketing"`
+	Sales     []SalesData     `json:"sales"`
+}
+
+const (
+	BatchKindMarketing = "marketing"
+	BatchKindSales     = "sales"
+)
+
+// BatchRowError points at a rejected row by its kind and position in the batch.
+// Code is set for rows rejected by the version check.
+type BatchRowError struct {
+	Kind   string       `json:"kind"`
+	Index  int          `json:"index"`
+	Code   string       `json:"code,omitempty"`
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// BatchCodeVersionMismatch is the Code of a row whose version is stale, the
+// same as the API error code of single-row saves.
+const BatchCodeVersionMismatch = "version_mismatch"
+
+// FieldError is a single validation problem, Field being the JSON name of
+// the offending field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type DailyBatchResult struct {
+	Marketing []MarketingData `json:"marketing"`
+	Sales     []SalesData     `json:"sales"`
+	Errors    []BatchRowError `json:"errors,omitempty"`
+	Warnings  []BatchRowError `json:"warnings,omitempty"`
+}
+
+// Entities and actions recorded in the audit log.
+const (
+	AuditEntityMarketingData = "marketing_data"
+	AuditEntitySalesData     = "sales_data"
+
+	AuditActionInsert  = "insert"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionStatus  = "status"
+)
+
+// AuditMeta identifies who made a change and in which API request.
+type AuditMeta struct {
+	Actor     string
+	RequestID string
+}
+
+// AuditEntry is one recorded change. Before is null for inserts.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Entity    string          `json:"entity"`
+	EntityID  int             `json:"entity_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	From     string
+	To       string
+	Limit    int
+}
+
+// PeriodLock closes the dates From..To (inclusive) for writes until it is reopened.
+type PeriodLock struct {
+	ID           int        `json:"id"`
+	From         string     `json:"from"`
+	To           string     `json:"to"`
+	ClosedBy     string     `json:"closed_by"`
+	ClosedAt     time.Time  `json:"closed_at"`
+	ReopenedBy   *string    `json:"reopened_by,omitempty"`
+	ReopenedAt   *time.Time `json:"reopened_at,omitempty"`
+	ReopenReason *string    `json:"reopen_reason,omitempty"`
+}
+
+// Roles decide what a user may read and write:
+//   - admin: everything, including sources, teams, users, deleted rows and the audit log
+//   - marketer: marketing data
+//   - sales_lead: sales data of their own team, marketing data read-only
+//   - sales_head: reads everything, approves and rejects submitted sales data
+//   - viewer: read-only access to marketing and sales data
+const (
+	RoleAdmin     = "admin"
+	RoleMarketer  = "marketer"
+	RoleSalesLead = "sales_lead"
+	RoleSalesHead = "sales_head"
+	RoleViewer    = "viewer"
+)
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleMarketer, RoleSalesLead, RoleSalesHead, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// User.TeamID is the team a sales lead is responsible for.
+type User struct {
+	ID           int       `json:"id" db:"id"`
+	Username     string    `json:"username" db:"username"`
+	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         string    `json:"role" db:"role"`
+	TeamID       *int      `json:"team_id" db:"team_id"`
+	IsActive     bool      `json:"is_active" db:"is_active"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// GetMarketingFunnel aggregates marketing data per source for the given range.
+// The last row of the ROLLUP holds the overall totals.
+func (r *PostgresRepository) GetMarketingFunnel(ctx context.Context, filter domain.ReportFilter) (_ *domain.MarketingFunnel, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	joinConditions, args := dateFilter("d.", filter.From, filter.To, 1)
+	joinConditions = append([]string{"d.source_id = s.id", "d.deleted_at IS NULL"}, joinConditions...)
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		joinConditions = append(joinConditions, fmt.Sprintf("d.status = $%d", len(args)))
+	}
+
+	query := `
+		SELECT s.id, s.name,
+			COALESCE(SUM(d.expense), 0),
+			COALESCE(SUM(d.leads), 0),
+			COALESCE(SUM(d.trials_scheduled), 0),
+			COALESCE(SUM(d.trials_conducted), 0),
+			COALESCE(SUM(d.payments), 0),
+			COALESCE(SUM(d.total_amount), 0),
+			ROUND(SUM(d.expense) / NULLIF(SUM(d.leads), 0), 2),
+			ROUND(SUM(d.expense) / NULLIF(SUM(d.trials_conducted), 0), 2),
+			ROUND(SUM(d.expense) / NULLIF(SUM(d.payments), 0), 2),
+			ROUND(SUM(d.trials_scheduled)::numeric / NULLIF(SUM(d.leads), 0), 4),
+			ROUND(SUM(d.trials_conducted)::numeric / NULLIF(SUM(d.trials_scheduled), 0), 4),
+			ROUND(SUM(d.payments)::numeric / NULLIF(SUM(d.trials_conducted), 0), 4),
+			ROUND(SUM(d.payments)::numeric / NULLIF(SUM(d.leads), 0), 4),
+			ROUND(SUM(d.total_amount) / NULLIF(SUM(d.expense), 0), 4)
+		FROM marketing_sources s
+		LEFT JOIN marketing_data d ON ` + strings.Join(joinConditions, " AND ")
+
+	// Archived sources only show up for periods in which they have data
+	query += " WHERE (s.archived_at IS NULL OR d.id IS NOT NULL)"
+	if cond, idArgs := idFilter("s.id", filter.IDs, len(args)+1); cond != "" {
+		query += " AND " + cond
+		args = append(args, idArgs...)
+	}
+	query += " GROUP BY ROLLUP ((s.id, s.name)) ORDER BY s.id NULLS LAST"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	funnel := &domain.MarketingFunnel{From: filter.From, To: filter.To, Sources: []domain.MarketingFunnelMetrics{}}
+	for rows.Next() {
+		var (
+			m                                   domain.MarketingFunnelMetrics
+			sourceID                            sql.NullInt64
+			sourceName                          sql.NullString
+			cpl, perTrial, perPayment           sql.NullFloat64
+			toScheduled, toConducted, toPayment sql.NullFloat64
+			leadToPayment, romi                 sql.NullFloat64
+		)
+		if err := rows.Scan(&sourceID, &sourceName, &m.Expense, &m.Leads, &m.TrialsScheduled, &m.TrialsConducted, &m.Payments, &m.TotalAmount,
+			&cpl, &perTrial, &perPayment, &toScheduled, &toConducted, &toPayment, &leadToPayment, &romi); err != nil {
+			return nil, err
+		}
+		m.CPL = nullFloat(cpl)
+		m.CostPerTrial = nullFloat(perTrial)
+		m.CostPerPayment = nullFloat(perPayment)
+		m.LeadToScheduled = nullFloat(toScheduled)
+		m.ScheduledToConducted = nullFloat(toConducted)
+		m.ConductedToPayment = nullFloat(toPayment)
+		m.LeadToPayment = nullFloat(leadToPayment)
+		m.ROMI = nullFloat(romi)
+
+		if !sourceID.Valid {
+			funnel.Total = m
+			continue
+		}
+		m.SourceID = int(sourceID.Int64)
+		m.SourceName = sourceName.String
+		funnel.Sources = append(funnel.Sources, m)
+	}
+	return funnel, rows.Err()
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+// bucketIntervals maps a group_by value to the generate_series step.
+// The keys are also valid date_trunc units.
+var bucketIntervals = map[string]string{
+	domain.GroupByDay:     "1 day",
+	domain.GroupByWeek:    "1 week",
+	domain.GroupByMonth:   "1 month",
+	domain.GroupByQuarter: "3 months",
+}
+
+func (r *PostgresRepository) GetMarketingSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) (_ []domain.MarketingSummary, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query, args, err := summaryQuery("marketing_data", "source_id", "marketing_sources", "archived_at IS NULL",
+		[]string{"expense", "leads", "trials_scheduled", "trials_conducted", "payments", "total_amount"},
+		filter, groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []domain.MarketingSummary{}
+	for rows.Next() {
+		var s domain.MarketingSummary
+		if err := rows.Scan(&s.Period, &s.SourceID, &s.Expense, &s.Leads, &s.TrialsScheduled, &s.TrialsConducted, &s.Payments, &s.TotalAmount); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+func (r *PostgresRepository) GetSalesSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) (_ []domain.SalesSummary, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query, args, err := summaryQuery("sales_data", "team_id", "sales_teams",
+		"(active_from IS NULL OR active_from <= (SELECT hi FROM bounds)) AND (active_to IS NULL OR active_to >= (SELECT lo FROM bounds))",
+		[]string{"leads", "trials_scheduled", "trials_conducted", "payments", "total_amount", "kaspi_refund"},
+		filter, groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []domain.SalesSummary{}
+	for rows.Next() {
+		var s domain.SalesSummary
+		if err := rows.Scan(&s.Period, &s.TeamID, &s.Leads, &s.TrialsScheduled, &s.TrialsConducted, &s.Payments, &s.TotalAmount, &s.KaspiRefund); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// summaryQuery sums the given columns of table per time bucket and per row of
+// dimTable (sources or teams). Every bucket between from and to (or the first and
+// last date with data) is returned for every dimension row, zero-filled.
+// Dimension rows not matching dimActive (e.g. archived sources) are only
+// included when they have data in the range.
+func summaryQuery(table, idColumn, dimTable, dimActive string, columns []string, filter domain.ReportFilter, groupBy string) (string, []interface{}, error) {
+	step, ok := bucketIntervals[groupBy]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported group_by %q", groupBy)
+	}
+
+	conditions, args := dataFilter("", idColumn, filter)
+	where := " WHERE " + strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")
+
+	args = append(args, filter.From, filter.To)
+	fromArg, toArg := len(args)-1, len(args)
+
+	var dimConditions []string
+	if dimActive != "" {
+		dimConditions = append(dimConditions, fmt.Sprintf("(%s OR id IN (SELECT %s FROM filtered))", dimActive, idColumn))
+	}
+	if cond, idArgs := idFilter("id", filter.IDs, len(args)+1); cond != "" {
+		dimConditions = append(dimConditions, cond)
+		args = append(args, idArgs...)
+	}
+	dimWhere := ""
+	if len(dimConditions) > 0 {
+		dimWhere = " WHERE " + strings.Join(dimConditions, " AND ")
+	}
+
+	sums := make([]string, len(columns))
+	for i, c := range columns {
+		sums[i] = fmt.Sprintf("COALESCE(SUM(f.%s), 0)", c)
+	}
+
+	query := fmt.Sprintf(`
+		WITH filtered AS (
+			SELECT * FROM %[1]s%[2]s
+		), bounds AS (
+			SELECT date_trunc('%[3]s', COALESCE(NULLIF($%[4]d, '')::date, MIN(date)))::date AS lo,
+				COALESCE(NULLIF($%[5]d, '')::date, MAX(date)) AS hi
+			FROM filtered
+		), buckets AS (
+			SELECT generate_series(lo, hi, interval '%[6]s')::date AS period FROM bounds
+		), dims AS (
+			SELECT id FROM %[7]s%[8]s
+		)
+		SELECT to_char(b.period, 'YYYY-MM-DD'), dims.id, %[9]s
+		FROM buckets b
+		CROSS JOIN dims
+		LEFT JOIN filtered f ON f.%[10]s = dims.id AND date_trunc('%[3]s', f.date)::date = b.period
+		GROUP BY b.period, dims.id
+		ORDER BY b.period, dims.id`,
+		table, where, groupBy, fromArg, toArg, step, dimTable, dimWhere, strings.Join(sums, ", "), idColumn)
+
+	return query, args, nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const defaultAuditLimit = 500
+
+// auditMarketingChange records the transition from before (nil for inserts)
+// to the current state of the row. It must run in the transaction that made the change.
+func auditMarketingChange(ctx context.Context, q queryer, meta domain.AuditMeta, action string, id int, before *domain.MarketingData) error {
+	after, err := getMarketingRow(ctx, q, "id=$1", id)
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, q, meta, domain.AuditEntityMarketingData, id, action, auditJSON(before), auditJSON(after))
+}
+
+func auditSalesChange(ctx context.Context, q queryer, meta domain.AuditMeta, action string, id int, before *domain.SalesData) error {
+	after, err := getSalesRow(ctx, q, "id=$1", id)
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, q, meta, domain.AuditEntitySalesData, id, action, auditJSON(before), auditJSON(after))
+}
+
+// auditJSON encodes a row snapshot; nil becomes SQL NULL. The value is passed
+// as text because lib/pq would send []byte as bytea.
+func auditJSON[T any](row *T) sql.NullString {
+	if row == nil {
+		return sql.NullString{}
+	}
+	b, err := json.Marshal(row)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(b), Valid: true}
+}
+
+// writeAudit stores created_at in UTC, which keeps it comparable as text in SQLite.
+func writeAudit(ctx context.Context, q queryer, meta domain.AuditMeta, entity string, id int, action string, before, after sql.NullString) error {
+	_, err := q.ExecContext(ctx,
+		"INSERT INTO audit_log (entity, entity_id, action, actor, request_id, before, after, created_at) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)",
+		entity, id, action, actorOrSystem(meta), meta.RequestID, before, after, time.Now().UTC(),
+	)
+	return err
+}
+
+// actorOrSystem names changes made without an authenticated user, e.g. at startup.
+func actorOrSystem(meta domain.AuditMeta) string {
+	if meta.Actor == "" {
+		return "system"
+	}
+	return meta.Actor
+}
+
+// GetAuditLog returns matching entries, newest first. From and To are
+// inclusive dates compared against the time of the change.
+func (r *PostgresRepository) GetAuditLog(ctx context.Context, filter domain.AuditFilter) (_ []domain.AuditEntry, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var conditions []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.Entity != "" {
+		add("entity = $%d", filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		add("entity_id = $%d", filter.EntityID)
+	}
+	if filter.From != "" {
+		add("created_at >= $%d::date", filter.From)
+	}
+	if filter.To != "" {
+		add("created_at < $%d::date + 1", filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	query := "SELECT id, entity, entity_id, action, actor, COALESCE(request_id, ''), before, after, created_at FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d", limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []domain.AuditEntry{}
+	for rows.Next() {
+		var e domain.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.Entity, &e.EntityID, &e.Action, &e.Actor, &e.RequestID, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
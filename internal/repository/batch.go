@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SaveDailyBatch upserts all rows of the batch on their natural keys in one
+// transaction. Every row runs under its own savepoint so that all failing rows
+// are reported; if any row fails nothing is committed.
+func (r *PostgresRepository) SaveDailyBatch(ctx context.Context, batch *domain.DailyBatch, meta domain.AuditMeta) (_ []domain.BatchRowError, err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	return saveDailyBatch(ctx, r.db, postgresOps, batch, meta)
+}
+
+func saveDailyBatch(ctx context.Context, db *sql.DB, ops txOps, batch *domain.DailyBatch, meta domain.AuditMeta) ([]domain.BatchRowError, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var rowErrors []domain.BatchRowError
+	saveRow := func(kind string, index int, upsert func() error) error {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_row"); err != nil {
+			return err
+		}
+		if err := upsert(); err != nil {
+			rowError, ok := batchRowError(kind, index, err)
+			if !ok {
+				return err
+			}
+			rowErrors = append(rowErrors, rowError)
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_row")
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_row")
+		return err
+	}
+
+	for i := range batch.Marketing {
+		d := &batch.Marketing[i]
+		err := saveRow(domain.BatchKindMarketing, i, func() error {
+			_, err := ops.upsertMarketingData(ctx, tx, d, meta)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range batch.Sales {
+		d := &batch.Sales[i]
+		err := saveRow(domain.BatchKindSales, i, func() error {
+			_, err := ops.upsertSalesData(ctx, tx, d, meta)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rowErrors) > 0 {
+		// The transaction is rolled back, IDs handed out so far are void
+		for i := range batch.Marketing {
+			batch.Marketing[i].ID = 0
+		}
+		for i := range batch.Sales {
+			batch.Sales[i].ID = 0
+		}
+		return rowErrors, nil
+	}
+	return nil, tx.Commit()
+}
+
+// batchRowError describes a row's error. Only row problems are reported per
+// row; for a closed period or an internal failure ok is false and the whole
+// batch is rejected.
+func batchRowError(kind string, index int, err error) (_ domain.BatchRowError, ok bool) {
+	rowError := domain.BatchRowError{Kind: kind, Index: index, Error: err.Error()}
+	var invalid *ValidationError
+	switch {
+	case errors.Is(err, ErrVersionMismatch):
+		rowError.Code = domain.BatchCodeVersionMismatch
+	case errors.As(err, &invalid):
+		rowError.Fields = invalid.Fields
+	case !errors.Is(err, ErrConflict) && !errors.Is(err, ErrInvalidStatus):
+		return rowError, false
+	}
+	return rowError, true
+}
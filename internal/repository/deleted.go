@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+)
+
+// Report rows are never removed physically: deleting sets deleted_at, which
+// hides the row from all reads and aggregates until it is restored.
+
+func (r *PostgresRepository) DeleteMarketingData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return deleteMarketingRow(ctx, tx, postgresOps, id, meta)
+	})
+}
+
+func (r *PostgresRepository) RestoreMarketingData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return restoreMarketingRow(ctx, tx, postgresOps, id, meta)
+	})
+}
+
+func (r *PostgresRepository) DeleteSalesData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return deleteSalesRow(ctx, tx, postgresOps, id, meta)
+	})
+}
+
+func (r *PostgresRepository) RestoreSalesData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return restoreSalesRow(ctx, tx, postgresOps, id, meta)
+	})
+}
+
+func deleteMarketingRow(ctx context.Context, tx *sql.Tx, ops txOps, id int, meta domain.AuditMeta) error {
+	before, err := getMarketingRow(ctx, tx, "id=$1 AND deleted_at IS NULL"+ops.forUpdate, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrNotFound
+	}
+	if err := checkEditable(before.ID, before.Status); err != nil {
+		return err
+	}
+	if err := ops.checkPeriodOpen(ctx, tx, before.Date); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE marketing_data SET deleted_at=$1, version=version+1 WHERE id=$2", ops.now(), id); err != nil {
+		return err
+	}
+	return auditMarketingChange(ctx, tx, meta, domain.AuditActionDelete, id, before)
+}
+
+func restoreMarketingRow(ctx context.Context, tx *sql.Tx, ops txOps, id int, meta domain.AuditMeta) error {
+	before, err := getMarketingRow(ctx, tx, "id=$1 AND deleted_at IS NOT NULL"+ops.forUpdate, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrNotFound
+	}
+	if err := ops.checkPeriodOpen(ctx, tx, before.Date); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE marketing_data SET deleted_at=NULL, updated_at=$1, version=version+1 WHERE id=$2", ops.now(), id); err != nil {
+		return err
+	}
+	return auditMarketingChange(ctx, tx, meta, domain.AuditActionRestore, id, before)
+}
+
+func deleteSalesRow(ctx context.Context, tx *sql.Tx, ops txOps, id int, meta domain.AuditMeta) error {
+	before, err := getSalesRow(ctx, tx, "id=$1 AND deleted_at IS NULL"+ops.forUpdate, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrNotFound
+	}
+	if err := checkEditable(before.ID, before.Status); err != nil {
+		return err
+	}
+	if err := ops.checkPeriodOpen(ctx, tx, before.Date); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE sales_data SET deleted_at=$1, version=version+1 WHERE id=$2", ops.now(), id); err != nil {
+		return err
+	}
+	return auditSalesChange(ctx, tx, meta, domain.AuditActionDelete, id, before)
+}
+
+func restoreSalesRow(ctx context.Context, tx *sql.Tx, ops txOps, id int, meta domain.AuditMeta) error {
+	before, err := getSalesRow(ctx, tx, "id=$1 AND deleted_at IS NOT NULL"+ops.forUpdate, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return ErrNotFound
+	}
+	if err := ops.checkPeriodOpen(ctx, tx, before.Date); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE sales_data SET deleted_at=NULL, updated_at=$1, version=version+1 WHERE id=$2", ops.now(), id); err != nil {
+		return err
+	}
+	return auditSalesChange(ctx, tx, meta, domain.AuditActionRestore, id, before)
+}
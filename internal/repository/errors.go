@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Errors returned by a Repository are one of the typed errors below (matched
+// with errors.Is/errors.As) or an internal failure that must not be shown to
+// clients as is.
+
+var ErrNotFound = errors.New("not found")
+
+// ErrForbidden is returned when the caller's role or team does not allow the
+// operation.
+var ErrForbidden = errors.New("forbidden")
+
+// ErrTimeout is returned when a call ran out of time, either the query
+// timeout or the caller's own deadline.
+var ErrTimeout = errors.New("query timed out")
+
+// ErrConflict is matched by every *ConflictError.
+var ErrConflict = errors.New("conflict")
+
+// ConflictError reports a violated database constraint, e.g. a second row for
+// the same (date, source_id) or a reference to a missing source.
+type ConflictError struct {
+	Constraint string `json:"constraint"`
+	Message    string `json:"message"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s (%s)", e.Message, e.Constraint)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// ErrValidation is matched by every *ValidationError.
+var ErrValidation = errors.New("validation failed")
+
+// ValidationError reports row values that cannot be stored, one entry per
+// offending field.
+type ValidationError struct {
+	Fields []domain.FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// ErrLocked is matched by every *LockedError.
+var ErrLocked = errors.New("period is closed")
+
+// LockedError reports a write to a date inside a closed period.
+type LockedError struct {
+	Date   string `json:"date"`
+	LockID int    `json:"lock_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("period %s..%s is closed, %s cannot be changed", e.From, e.To, e.Date)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// ErrInvalidStatus is matched by every *StatusError.
+var ErrInvalidStatus = errors.New("action not allowed in the current status")
+
+// StatusError reports a workflow action, or an edit, that the row's status
+// does not allow, e.g. approving a draft or changing an approved row.
+type StatusError struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Action string `json:"action"`
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("row %d is %s, cannot %s it", e.ID, e.Status, e.Action)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrInvalidStatus
+}
+
+// ErrVersionMismatch is matched by every *VersionError.
+var ErrVersionMismatch = errors.New("row was changed by someone else")
+
+// VersionError reports an update based on a stale version of a row. Current
+// holds the stored copy (*domain.MarketingData or *domain.SalesData).
+type VersionError struct {
+	Current interface{}
+}
+
+func (e *VersionError) Error() string {
+	return ErrVersionMismatch.Error()
+}
+
+func (e *VersionError) Unwrap() error {
+	return ErrVersionMismatch
+}
+
+// ErrVersionRequired is returned for an update by ID that does not name the
+// version it is based on.
+var ErrVersionRequired = errors.New("the version of the row is required to change it")
+
+// checkVersion compares the version an update by ID is based on with the
+// stored row's. Unconditional updates are refused like stale ones, so that a
+// concurrent edit is never lost silently.
+func checkVersion(version int, current int, row interface{}) error {
+	if version == 0 {
+		return ErrVersionRequired
+	}
+	return checkUpsertVersion(version, current, row)
+}
+
+// checkUpsertVersion is checkVersion for saves on the natural key. Those are
+// idempotent, so a save without a version overwrites the stored row; one that
+// names a version must name the current one.
+func checkUpsertVersion(version int, current int, row interface{}) error {
+	if version != 0 && version != current {
+		return &VersionError{Current: row}
+	}
+	return nil
+}
+
+// checkEditable refuses changes to submitted and approved rows.
+func checkEditable(id int, status string) error {
+	if !domain.IsEditableStatus(status) {
+		return &StatusError{ID: id, Status: status, Action: "edit"}
+	}
+	return nil
+}
+
+// mapConstraintError converts unique and foreign key violations reported by
+// Postgres into a *ConflictError, and check violations and unparsable values
+// into a *ValidationError. Any other error is returned unchanged.
+func mapConstraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return uniqueViolation(pqErr.Constraint, pqErr.Detail)
+	case "foreign_key_violation":
+		return foreignKeyViolation(pqErr.Constraint, pqErr.Detail)
+	case "check_violation", "not_null_violation":
+		return checkViolation(pqErr.Column, constraintName(pqErr))
+	case "invalid_datetime_format", "datetime_field_overflow", "invalid_text_representation", "numeric_value_out_of_range":
+		return invalidValue(pqErr.Column)
+	}
+	return err
+}
+
+// The constructors below are shared by mapConstraintError, mapSQLiteError and
+// the in-memory repository, so all backends report a violated constraint the
+// same way.
+
+func uniqueViolation(constraint, detail string) error {
+	return &ConflictError{Constraint: constraint, Message: "row already exists", Detail: detail}
+}
+
+func foreignKeyViolation(constraint, detail string) error {
+	return &ConflictError{Constraint: constraint, Message: "referenced row does not exist or is still in use", Detail: detail}
+}
+
+func checkViolation(column, constraint string) error {
+	return &ValidationError{Fields: []domain.FieldError{{
+		Field: column, Code: "invalid", Message: fmt.Sprintf("value violates %s", constraint),
+	}}}
+}
+
+func invalidValue(column string) error {
+	return &ValidationError{Fields: []domain.FieldError{{
+		Field: column, Code: "invalid", Message: "invalid value",
+	}}}
+}
+
+func constraintName(pqErr *pq.Error) string {
+	if pqErr.Constraint != "" {
+		return pqErr.Constraint
+	}
+	if pqErr.Column != "" {
+		return "not null constraint on " + pqErr.Column
+	}
+	return "a constraint"
+}
+
+// mapTimeout reports err as ErrTimeout when ctx has passed its deadline,
+// whichever form the driver returned it in (context.DeadlineExceeded or a
+// cancelled statement).
+func mapTimeout(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrTimeout, err)
+}
+
+// mapNoRows turns sql.ErrNoRows from a single-row query into ErrNotFound.
+func mapNoRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+)
+
+// ImportMarketingData upserts rows keyed on (date, source_id) in a single
+// transaction. The returned results are aligned with rows. With dryRun the
+// transaction is rolled back, so only the computed diff is returned.
+func (r *PostgresRepository) ImportMarketingData(ctx context.Context, rows []domain.MarketingData, dryRun bool, meta domain.AuditMeta) (_ []domain.ImportRowResult, err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	return importMarketingData(ctx, r.db, postgresOps, rows, dryRun, meta)
+}
+
+func importMarketingData(ctx context.Context, db *sql.DB, ops txOps, rows []domain.MarketingData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]domain.ImportRowResult, len(rows))
+	for i := range rows {
+		d := &rows[i]
+
+		old, err := getMarketingRow(ctx, tx, "date=$1 AND source_id=$2"+ops.forUpdate, d.Date, d.SourceID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case old == nil:
+			results[i].Action = domain.ImportActionInsert
+		case old.DeletedAt != nil:
+			// A soft-deleted row is revived with the imported values
+			results[i].Action = domain.ImportActionInsert
+		default:
+			changes := marketingChanges(old, d)
+			if len(changes) == 0 {
+				d.ID = old.ID
+				results[i].Action = domain.ImportActionUnchanged
+				continue
+			}
+			results[i].Action = domain.ImportActionUpdate
+			results[i].Changes = changes
+		}
+
+		err = ops.checkPeriodOpen(ctx, tx, d.Date)
+		if err == nil && old != nil && old.DeletedAt == nil {
+			err = checkEditable(old.ID, old.Status)
+		}
+		if err != nil {
+			// A dry run reports closed periods and locked rows per row, a real import is rejected
+			if !dryRun {
+				return nil, err
+			}
+			results[i].Action = domain.ImportActionError
+			results[i].Changes = nil
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if dryRun {
+			if old != nil {
+				d.ID = old.ID
+			}
+			continue
+		}
+		// Importing overwrites on purpose, the diff was shown by the dry run
+		if old != nil {
+			d.Version = old.Version
+		}
+		if _, err := ops.upsertMarketingData(ctx, tx, d, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return results, nil
+	}
+	return results, tx.Commit()
+}
+
+// ImportSalesData is the sales counterpart of ImportMarketingData, keyed on (date, team_id).
+func (r *PostgresRepository) ImportSalesData(ctx context.Context, rows []domain.SalesData, dryRun bool, meta domain.AuditMeta) (_ []domain.ImportRowResult, err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	return importSalesData(ctx, r.db, postgresOps, rows, dryRun, meta)
+}
+
+func importSalesData(ctx context.Context, db *sql.DB, ops txOps, rows []domain.SalesData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]domain.ImportRowResult, len(rows))
+	for i := range rows {
+		d := &rows[i]
+
+		old, err := getSalesRow(ctx, tx, "date=$1 AND team_id=$2"+ops.forUpdate, d.Date, d.TeamID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case old == nil:
+			results[i].Action = domain.ImportActionInsert
+		case old.DeletedAt != nil:
+			results[i].Action = domain.ImportActionInsert
+		default:
+			changes := salesChanges(old, d)
+			if len(changes) == 0 {
+				d.ID = old.ID
+				results[i].Action = domain.ImportActionUnchanged
+				continue
+			}
+			results[i].Action = domain.ImportActionUpdate
+			results[i].Changes = changes
+		}
+
+		err = ops.checkPeriodOpen(ctx, tx, d.Date)
+		if err == nil && old != nil && old.DeletedAt == nil {
+			err = checkEditable(old.ID, old.Status)
+		}
+		if err != nil {
+			// A dry run reports closed periods and locked rows per row, a real import is rejected
+			if !dryRun {
+				return nil, err
+			}
+			results[i].Action = domain.ImportActionError
+			results[i].Changes = nil
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if dryRun {
+			if old != nil {
+				d.ID = old.ID
+			}
+			continue
+		}
+		if old != nil {
+			d.Version = old.Version
+		}
+		if _, err := ops.upsertSalesData(ctx, tx, d, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return results, nil
+	}
+	return results, tx.Commit()
+}
+
+func marketingChanges(old, new *domain.MarketingData) map[string]domain.ImportChange {
+	changes := map[string]domain.ImportChange{}
+	addChange(changes, "expense", old.Expense, new.Expense)
+	addChange(changes, "leads", old.Leads, new.Leads)
+	addChange(changes, "trials_scheduled", old.TrialsScheduled, new.TrialsScheduled)
+	addChange(changes, "trials_conducted", old.TrialsConducted, new.TrialsConducted)
+	addChange(changes, "payments", old.Payments, new.Payments)
+	addChange(changes, "total_amount", old.TotalAmount, new.TotalAmount)
+	return changes
+}
+
+func salesChanges(old, new *domain.SalesData) map[string]domain.ImportChange {
+	changes := map[string]domain.ImportChange{}
+	addChange(changes, "leads", old.Leads, new.Leads)
+	addChange(changes, "trials_scheduled", old.TrialsScheduled, new.TrialsScheduled)
+	addChange(changes, "trials_conducted", old.TrialsConducted, new.TrialsConducted)
+	addChange(changes, "payments", old.Payments, new.Payments)
+	addChange(changes, "total_amount", old.TotalAmount, new.TotalAmount)
+	addChange(changes, "kaspi_refund", old.KaspiRefund, new.KaspiRefund)
+	return changes
+}
+
+func addChange(changes map[string]domain.ImportChange, field string, old, new interface{}) {
+	if old != new {
+		changes[field] = domain.ImportChange{Old: old, New: new}
+	}
+}
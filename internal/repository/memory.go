@@ -0,0 +1,758 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps all data in process memory. It implements
+// Repository and auth.Store with the semantics of PostgresRepository: the
+// same unique and foreign keys, the same errors and the same row format.
+// It backs tests and the --storage=memory mode; nothing survives a restart.
+type MemoryRepository struct {
+	mu    sync.RWMutex
+	state *memState
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{state: &memState{
+		sources:       map[int]domain.MarketingSource{},
+		teams:         map[int]domain.SalesTeam{},
+		marketing:     map[int]domain.MarketingData{},
+		marketingKeys: map[memKey]int{},
+		sales:         map[int]domain.SalesData{},
+		salesKeys:     map[memKey]int{},
+		locks:         map[int]domain.PeriodLock{},
+		users:         map[int]domain.User{},
+		tokens:        map[string]memToken{},
+		seq:           map[string]int{},
+	}}
+}
+
+// memState holds every table. A write works on a copy that replaces the
+// current state only when the whole operation succeeds, which makes writes
+// all-or-nothing like the transactions of PostgresRepository.
+type memState struct {
+	sources   map[int]domain.MarketingSource
+	teams     map[int]domain.SalesTeam
+	marketing map[int]domain.MarketingData
+	sales     map[int]domain.SalesData
+	locks     map[int]domain.PeriodLock
+	users     map[int]domain.User
+	tokens    map[string]memToken
+	audit     []domain.AuditEntry
+	seq       map[string]int
+
+	// marketingKeys and salesKeys are the (date, source_id) and
+	// (date, team_id) unique indexes, soft-deleted rows included.
+	marketingKeys map[memKey]int
+	salesKeys     map[memKey]int
+}
+
+// memKey is a natural key of report rows: the stored date and the source or team ID.
+type memKey struct {
+	date string
+	id   int
+}
+
+type memToken struct {
+	userID    int
+	expiresAt time.Time
+	revoked   bool
+}
+
+// Rows and values are copied by value; pointer fields are never modified
+// in place, so a shallow copy of the maps is enough.
+func (s *memState) clone() *memState {
+	return &memState{
+		sources:       maps.Clone(s.sources),
+		teams:         maps.Clone(s.teams),
+		marketing:     maps.Clone(s.marketing),
+		marketingKeys: maps.Clone(s.marketingKeys),
+		sales:         maps.Clone(s.sales),
+		salesKeys:     maps.Clone(s.salesKeys),
+		locks:         maps.Clone(s.locks),
+		users:         maps.Clone(s.users),
+		tokens:        maps.Clone(s.tokens),
+		audit:         slices.Clip(s.audit),
+		seq:           maps.Clone(s.seq),
+	}
+}
+
+// nextID plays the part of a SERIAL column.
+func (s *memState) nextID(table string) int {
+	s.seq[table]++
+	return s.seq[table]
+}
+
+// errRollback ends a write successfully but discards its changes, e.g. for
+// a dry-run import.
+var errRollback = errors.New("rollback")
+
+func (r *MemoryRepository) write(ctx context.Context, fn func(s *memState) error) error {
+	if err := ctx.Err(); err != nil {
+		return mapTimeout(ctx, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.state.clone()
+	if err := fn(s); err != nil {
+		if err == errRollback {
+			return nil
+		}
+		return err
+	}
+	r.state = s
+	return nil
+}
+
+func (r *MemoryRepository) read(ctx context.Context, fn func(s *memState) error) error {
+	if err := ctx.Err(); err != nil {
+		return mapTimeout(ctx, err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return fn(r.state)
+}
+
+// memNow returns the current time at the microsecond precision of a
+// TIMESTAMP WITH TIME ZONE column.
+func memNow() time.Time {
+	return time.Now().Round(0).Truncate(time.Microsecond)
+}
+
+// lib/pq returns DATE columns as midnight UTC timestamps, which database/sql
+// formats as RFC 3339. Report rows are stored in that form so that they read
+// back exactly as from Postgres.
+const memDateSuffix = "T00:00:00Z"
+
+// memDate parses a value bound for a DATE column and returns it as YYYY-MM-DD.
+func memDate(column, value string) (string, error) {
+	t, err := dateutil.ParseDate(value)
+	if err != nil {
+		return "", invalidValue(column)
+	}
+	return t.Format(dateutil.ISOLayout), nil
+}
+
+// memOptionalDate is memDate for a nullable column.
+func memOptionalDate(column string, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	date, err := memDate(column, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
+
+// isoDate strips the time part of a stored report date.
+func isoDate(stored string) string {
+	return strings.TrimSuffix(stored, memDateSuffix)
+}
+
+// maxNumeric is the smallest magnitude that no longer fits DECIMAL(15,2).
+const maxNumeric = 1e13
+
+// memAmount rounds v to the two decimals of a DECIMAL(15,2) column.
+func memAmount(column string, v float64) (float64, error) {
+	rounded := roundTo(v, 2)
+	if math.IsNaN(v) || math.Abs(rounded) >= maxNumeric {
+		return 0, invalidValue(column)
+	}
+	return rounded, nil
+}
+
+// memCount checks that v fits an INTEGER column.
+func memCount(column string, v int) error {
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return invalidValue(column)
+	}
+	return nil
+}
+
+// roundTo rounds half away from zero, like ROUND on numeric.
+func roundTo(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+func memJSON[T any](row *T) json.RawMessage {
+	if row == nil {
+		return nil
+	}
+	b, err := json.Marshal(row)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// memFilter matches report rows like dataFilter.
+type memFilter struct {
+	from, to string
+	ids      map[int]bool
+	status   string
+}
+
+func newMemFilter(filter domain.ReportFilter) (memFilter, error) {
+	f := memFilter{ids: memIDs(filter.IDs), status: filter.Status}
+	var err error
+	if filter.From != "" {
+		if f.from, err = memDate("date", filter.From); err != nil {
+			return f, err
+		}
+	}
+	if filter.To != "" {
+		if f.to, err = memDate("date", filter.To); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+func (f memFilter) match(stored string, id int, status string) bool {
+	date := isoDate(stored)
+	switch {
+	case f.from != "" && date < f.from,
+		f.to != "" && date > f.to,
+		f.ids != nil && !f.ids[id],
+		f.status != "" && status != f.status:
+		return false
+	}
+	return true
+}
+
+// memIDs parses IDs like idFilter, nil meaning no restriction.
+func memIDs(ids []string) map[int]bool {
+	var set map[int]bool
+	for _, idStr := range ids {
+		if id, err := strconv.Atoi(strings.TrimSpace(idStr)); err == nil {
+			if set == nil {
+				set = map[int]bool{}
+			}
+			set[id] = true
+		}
+	}
+	return set
+}
+
+// GetMarketingSources lists sources in display order.
+func (r *MemoryRepository) GetMarketingSources(ctx context.Context, includeArchived bool) (sources []domain.MarketingSource, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		for _, source := range s.sources {
+			if includeArchived || source.ArchivedAt == nil {
+				sources = append(sources, source)
+			}
+		}
+		return nil
+	})
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].SortOrder != sources[j].SortOrder {
+			return sources[i].SortOrder < sources[j].SortOrder
+		}
+		return sources[i].ID < sources[j].ID
+	})
+	return sources, err
+}
+
+func (s *memState) checkSourceName(id int, name string) error {
+	for _, other := range s.sources {
+		if other.ID != id && other.Name == name {
+			return uniqueViolation("marketing_sources_name_key", fmt.Sprintf("Key (name)=(%s) already exists.", name))
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateMarketingSource(ctx context.Context, source *domain.MarketingSource) error {
+	return r.write(ctx, func(s *memState) error {
+		if err := s.checkSourceName(0, source.Name); err != nil {
+			return err
+		}
+
+		sortOrder := 0
+		for _, other := range s.sources {
+			sortOrder = max(sortOrder, other.SortOrder)
+		}
+		now := memNow()
+		stored := domain.MarketingSource{ID: s.nextID("marketing_sources"), Name: source.Name, SortOrder: sortOrder + 1, CreatedAt: now, UpdatedAt: now}
+		s.sources[stored.ID] = stored
+		*source = stored
+		return nil
+	})
+}
+
+func (r *MemoryRepository) RenameMarketingSource(ctx context.Context, id int, name string) error {
+	return r.write(ctx, func(s *memState) error {
+		source, ok := s.sources[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := s.checkSourceName(id, name); err != nil {
+			return err
+		}
+		source.Name, source.UpdatedAt = name, memNow()
+		s.sources[id] = source
+		return nil
+	})
+}
+
+func (r *MemoryRepository) ArchiveMarketingSource(ctx context.Context, id int) error {
+	return r.write(ctx, func(s *memState) error {
+		source, ok := s.sources[id]
+		if !ok {
+			return ErrNotFound
+		}
+		now := memNow()
+		if source.ArchivedAt == nil {
+			source.ArchivedAt = &now
+		}
+		source.UpdatedAt = now
+		s.sources[id] = source
+		return nil
+	})
+}
+
+func (r *MemoryRepository) RestoreMarketingSource(ctx context.Context, id int) error {
+	return r.write(ctx, func(s *memState) error {
+		source, ok := s.sources[id]
+		if !ok {
+			return ErrNotFound
+		}
+		source.ArchivedAt, source.UpdatedAt = nil, memNow()
+		s.sources[id] = source
+		return nil
+	})
+}
+
+// ReorderMarketingSources assigns sort_order following the position of each ID.
+// Sources missing from ids keep their order but move behind the listed ones.
+func (r *MemoryRepository) ReorderMarketingSources(ctx context.Context, ids []int) error {
+	return r.write(ctx, func(s *memState) error {
+		for id, source := range s.sources {
+			source.SortOrder += len(ids)
+			s.sources[id] = source
+		}
+		now := memNow()
+		for i, id := range ids {
+			source, ok := s.sources[id]
+			if !ok {
+				return ErrNotFound
+			}
+			source.SortOrder, source.UpdatedAt = i+1, now
+			s.sources[id] = source
+		}
+		return nil
+	})
+}
+
+// DeleteMarketingSource removes a source that was never used. Sources with
+// marketing data can only be archived.
+func (r *MemoryRepository) DeleteMarketingSource(ctx context.Context, id int) error {
+	return r.write(ctx, func(s *memState) error {
+		for _, d := range s.marketing {
+			if d.SourceID == id {
+				return &ConflictError{Constraint: "marketing_data_source_id_fkey", Message: "source has marketing data, archive it instead"}
+			}
+		}
+		if _, ok := s.sources[id]; !ok {
+			return ErrNotFound
+		}
+		delete(s.sources, id)
+		return nil
+	})
+}
+
+// GetSalesTeams lists teams whose activity period overlaps [from, to].
+func (r *MemoryRepository) GetSalesTeams(ctx context.Context, from, to string) (teams []domain.SalesTeam, err error) {
+	if from != "" {
+		if from, err = memDate("active_to", from); err != nil {
+			return nil, err
+		}
+	}
+	if to != "" {
+		if to, err = memDate("active_from", to); err != nil {
+			return nil, err
+		}
+	}
+
+	err = r.read(ctx, func(s *memState) error {
+		for _, id := range slices.Sorted(maps.Keys(s.teams)) {
+			if t := s.teams[id]; teamActive(t, from, to) {
+				teams = append(teams, t)
+			}
+		}
+		return nil
+	})
+	return teams, err
+}
+
+// teamActive reports whether the team's activity period overlaps [from, to],
+// empty bounds being open.
+func teamActive(t domain.SalesTeam, from, to string) bool {
+	if to != "" && t.ActiveFrom != nil && *t.ActiveFrom > to {
+		return false
+	}
+	if from != "" && t.ActiveTo != nil && *t.ActiveTo < from {
+		return false
+	}
+	return true
+}
+
+// checkTeam applies the constraints of sales_teams to a new or changed team.
+func (s *memState) checkTeam(team *domain.SalesTeam) (domain.SalesTeam, error) {
+	stored := domain.SalesTeam{ID: team.ID, Name: team.Name}
+	var err error
+	if stored.ActiveFrom, err = memOptionalDate("active_from", team.ActiveFrom); err != nil {
+		return stored, err
+	}
+	if stored.ActiveTo, err = memOptionalDate("active_to", team.ActiveTo); err != nil {
+		return stored, err
+	}
+	if stored.ActiveFrom != nil && stored.ActiveTo != nil && *stored.ActiveFrom > *stored.ActiveTo {
+		return stored, checkViolation("", "sales_teams_active_period_check")
+	}
+	for _, other := range s.teams {
+		if other.ID != team.ID && other.Name == team.Name {
+			return stored, uniqueViolation("sales_teams_name_key", fmt.Sprintf("Key (name)=(%s) already exists.", team.Name))
+		}
+	}
+	return stored, nil
+}
+
+func (r *MemoryRepository) CreateSalesTeam(ctx context.Context, team *domain.SalesTeam) error {
+	return r.write(ctx, func(s *memState) error {
+		stored, err := s.checkTeam(team)
+		if err != nil {
+			return err
+		}
+		now := memNow()
+		stored.ID = s.nextID("sales_teams")
+		stored.CreatedAt, stored.UpdatedAt = now, now
+		s.teams[stored.ID] = stored
+		team.ID, team.CreatedAt, team.UpdatedAt = stored.ID, now, now
+		return nil
+	})
+}
+
+// UpdateSalesTeam renames a team and replaces its activity period.
+func (r *MemoryRepository) UpdateSalesTeam(ctx context.Context, team *domain.SalesTeam) error {
+	return r.write(ctx, func(s *memState) error {
+		current, ok := s.teams[team.ID]
+		if !ok {
+			return ErrNotFound
+		}
+		stored, err := s.checkTeam(team)
+		if err != nil {
+			return err
+		}
+		stored.CreatedAt, stored.UpdatedAt = current.CreatedAt, memNow()
+		s.teams[team.ID] = stored
+		team.CreatedAt, team.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+		return nil
+	})
+}
+
+// DeleteSalesTeam removes a team that was never used.
+func (r *MemoryRepository) DeleteSalesTeam(ctx context.Context, id int) error {
+	return r.write(ctx, func(s *memState) error {
+		for _, d := range s.sales {
+			if d.TeamID == id {
+				return &ConflictError{Constraint: "sales_data_team_id_fkey", Message: "team has sales data, set active_to instead"}
+			}
+		}
+		if _, ok := s.teams[id]; !ok {
+			return ErrNotFound
+		}
+		for _, u := range s.users {
+			if u.TeamID != nil && *u.TeamID == id {
+				return foreignKeyViolation("users_team_id_fkey", fmt.Sprintf(`Key (id)=(%d) is still referenced from table "users".`, id))
+			}
+		}
+		delete(s.teams, id)
+		return nil
+	})
+}
+
+// checkPeriodOpen returns a *LockedError if any of the dates falls into a
+// closed period.
+func (s *memState) checkPeriodOpen(dates ...string) error {
+	for _, date := range dates {
+		date = isoDate(date)
+		for _, id := range slices.Sorted(maps.Keys(s.locks)) {
+			l := s.locks[id]
+			if l.ReopenedAt == nil && l.From <= date && date <= l.To {
+				return &LockedError{Date: date, LockID: l.ID, From: l.From, To: l.To}
+			}
+		}
+	}
+	return nil
+}
+
+// GetPeriodLocks lists closed periods, newest first.
+func (r *MemoryRepository) GetPeriodLocks(ctx context.Context, includeReopened bool) (_ []domain.PeriodLock, err error) {
+	locks := []domain.PeriodLock{}
+	err = r.read(ctx, func(s *memState) error {
+		for _, l := range s.locks {
+			if includeReopened || l.ReopenedAt == nil {
+				locks = append(locks, l)
+			}
+		}
+		return nil
+	})
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].From != locks[j].From {
+			return locks[i].From > locks[j].From
+		}
+		return locks[i].ID > locks[j].ID
+	})
+	return locks, err
+}
+
+func (r *MemoryRepository) ClosePeriod(ctx context.Context, lock *domain.PeriodLock, meta domain.AuditMeta) error {
+	from, err := memDate("date_from", lock.From)
+	if err != nil {
+		return err
+	}
+	to, err := memDate("date_to", lock.To)
+	if err != nil {
+		return err
+	}
+	if from > to {
+		return checkViolation("", "period_locks_check")
+	}
+
+	return r.write(ctx, func(s *memState) error {
+		lock.ClosedBy = actorOrSystem(meta)
+		lock.ClosedAt = memNow()
+		lock.ID = s.nextID("period_locks")
+		s.locks[lock.ID] = domain.PeriodLock{ID: lock.ID, From: from, To: to, ClosedBy: lock.ClosedBy, ClosedAt: lock.ClosedAt}
+		return nil
+	})
+}
+
+// ReopenPeriod lifts an active lock, recording who did it and why.
+func (r *MemoryRepository) ReopenPeriod(ctx context.Context, id int, reason string, meta domain.AuditMeta) (lock *domain.PeriodLock, err error) {
+	err = r.write(ctx, func(s *memState) error {
+		l, ok := s.locks[id]
+		if !ok || l.ReopenedAt != nil {
+			return ErrNotFound
+		}
+		actor, now := actorOrSystem(meta), memNow()
+		l.ReopenedBy, l.ReopenedAt, l.ReopenReason = &actor, &now, &reason
+		s.locks[id] = l
+		lock = &l
+		return nil
+	})
+	return lock, err
+}
+
+func (s *memState) writeAudit(meta domain.AuditMeta, entity string, id int, action string, before, after json.RawMessage) {
+	s.audit = append(s.audit, domain.AuditEntry{
+		ID:        int64(s.nextID("audit_log")),
+		Entity:    entity,
+		EntityID:  id,
+		Action:    action,
+		Actor:     actorOrSystem(meta),
+		RequestID: meta.RequestID,
+		Before:    before,
+		After:     after,
+		CreatedAt: memNow(),
+	})
+}
+
+// GetAuditLog returns matching entries, newest first.
+func (r *MemoryRepository) GetAuditLog(ctx context.Context, filter domain.AuditFilter) (_ []domain.AuditEntry, err error) {
+	var from, to time.Time
+	if filter.From != "" {
+		if from, err = time.ParseInLocation(dateutil.ISOLayout, filter.From, time.Local); err != nil {
+			return nil, invalidValue("")
+		}
+	}
+	if filter.To != "" {
+		if to, err = time.ParseInLocation(dateutil.ISOLayout, filter.To, time.Local); err != nil {
+			return nil, invalidValue("")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	entries := []domain.AuditEntry{}
+	err = r.read(ctx, func(s *memState) error {
+		for _, e := range s.audit {
+			switch {
+			case filter.Entity != "" && e.Entity != filter.Entity,
+				filter.EntityID != 0 && e.EntityID != filter.EntityID,
+				filter.From != "" && e.CreatedAt.Before(from),
+				filter.To != "" && !e.CreatedAt.Before(to):
+				continue
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, err
+}
+
+// GetUserByUsername returns nil when there is no such user.
+func (r *MemoryRepository) GetUserByUsername(ctx context.Context, username string) (user *domain.User, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		for _, u := range s.users {
+			if u.Username == username {
+				user = &u
+				break
+			}
+		}
+		return nil
+	})
+	return user, err
+}
+
+func (r *MemoryRepository) GetUserByID(ctx context.Context, id int) (user *domain.User, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		if u, ok := s.users[id]; ok {
+			user = &u
+		}
+		return nil
+	})
+	return user, err
+}
+
+// checkUser applies the constraints of users to a new or changed account.
+func (s *memState) checkUser(user *domain.User) error {
+	if !domain.IsValidRole(user.Role) {
+		return checkViolation("", "users_role_check")
+	}
+	for _, other := range s.users {
+		if other.ID != user.ID && other.Username == user.Username {
+			return uniqueViolation("users_username_key", fmt.Sprintf("Key (username)=(%s) already exists.", user.Username))
+		}
+	}
+	if user.TeamID != nil {
+		if _, ok := s.teams[*user.TeamID]; !ok {
+			return foreignKeyViolation("users_team_id_fkey", fmt.Sprintf(`Key (team_id)=(%d) is not present in table "sales_teams".`, *user.TeamID))
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateUser(ctx context.Context, user *domain.User) error {
+	return r.write(ctx, func(s *memState) error {
+		if err := s.checkUser(user); err != nil {
+			return err
+		}
+		now := memNow()
+		user.ID = s.nextID("users")
+		user.CreatedAt, user.UpdatedAt = now, now
+		stored := *user
+		if user.TeamID != nil {
+			teamID := *user.TeamID
+			stored.TeamID = &teamID
+		}
+		s.users[user.ID] = stored
+		return nil
+	})
+}
+
+func (r *MemoryRepository) ListUsers(ctx context.Context) (_ []domain.User, err error) {
+	users := []domain.User{}
+	err = r.read(ctx, func(s *memState) error {
+		for _, id := range slices.Sorted(maps.Keys(s.users)) {
+			users = append(users, s.users[id])
+		}
+		return nil
+	})
+	return users, err
+}
+
+// UpdateUser saves role, team, active flag and password hash of an existing user.
+func (r *MemoryRepository) UpdateUser(ctx context.Context, user *domain.User) error {
+	return r.write(ctx, func(s *memState) error {
+		stored, ok := s.users[user.ID]
+		if !ok {
+			return ErrNotFound
+		}
+		// The username is not changed, the check runs against the stored one
+		check := *user
+		check.Username = stored.Username
+		if err := s.checkUser(&check); err != nil {
+			return err
+		}
+
+		user.UpdatedAt = memNow()
+		stored.PasswordHash, stored.Role, stored.IsActive, stored.UpdatedAt = user.PasswordHash, user.Role, user.IsActive, user.UpdatedAt
+		stored.TeamID = nil
+		if user.TeamID != nil {
+			teamID := *user.TeamID
+			stored.TeamID = &teamID
+		}
+		s.users[user.ID] = stored
+		return nil
+	})
+}
+
+func (r *MemoryRepository) CountUsers(ctx context.Context) (count int, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		count = len(s.users)
+		return nil
+	})
+	return count, err
+}
+
+func (r *MemoryRepository) SaveRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	return r.write(ctx, func(s *memState) error {
+		if _, ok := s.tokens[tokenHash]; ok {
+			return uniqueViolation("refresh_tokens_token_hash_key", fmt.Sprintf("Key (token_hash)=(%s) already exists.", tokenHash))
+		}
+		if _, ok := s.users[userID]; !ok {
+			return foreignKeyViolation("refresh_tokens_user_id_fkey", fmt.Sprintf(`Key (user_id)=(%d) is not present in table "users".`, userID))
+		}
+		s.tokens[tokenHash] = memToken{userID: userID, expiresAt: expiresAt}
+		return nil
+	})
+}
+
+// ConsumeRefreshToken revokes the token if it is still valid, so a token can
+// never be used twice.
+func (r *MemoryRepository) ConsumeRefreshToken(ctx context.Context, tokenHash string) (userID int, ok bool, err error) {
+	err = r.write(ctx, func(s *memState) error {
+		t, found := s.tokens[tokenHash]
+		if !found || t.revoked || !t.expiresAt.After(time.Now()) {
+			return nil
+		}
+		t.revoked = true
+		s.tokens[tokenHash] = t
+		userID, ok = t.userID, true
+		return nil
+	})
+	return userID, ok, err
+}
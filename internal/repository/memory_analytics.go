@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// GetMarketingFunnel aggregates marketing data per source for the given range,
+// like the ROLLUP query of PostgresRepository.
+func (r *MemoryRepository) GetMarketingFunnel(ctx context.Context, filter domain.ReportFilter) (funnel *domain.MarketingFunnel, err error) {
+	// The ID filter applies to sources, not to the joined rows
+	f, err := newMemFilter(domain.ReportFilter{From: filter.From, To: filter.To, Status: filter.Status})
+	if err != nil {
+		return nil, err
+	}
+	ids := memIDs(filter.IDs)
+
+	err = r.read(ctx, func(s *memState) error {
+		sums := map[int]*domain.MarketingFunnelMetrics{}
+		for _, d := range s.marketing {
+			if d.DeletedAt != nil || !f.match(d.Date, d.SourceID, d.Status) {
+				continue
+			}
+			m := sums[d.SourceID]
+			if m == nil {
+				m = &domain.MarketingFunnelMetrics{}
+				sums[d.SourceID] = m
+			}
+			addFunnel(m, domain.MarketingFunnelMetrics{Expense: d.Expense, Leads: d.Leads, TrialsScheduled: d.TrialsScheduled,
+				TrialsConducted: d.TrialsConducted, Payments: d.Payments, TotalAmount: d.TotalAmount})
+		}
+
+		funnel = &domain.MarketingFunnel{From: filter.From, To: filter.To, Sources: []domain.MarketingFunnelMetrics{}}
+		for _, id := range slices.Sorted(maps.Keys(s.sources)) {
+			source := s.sources[id]
+			m, hasData := sums[id]
+			// Archived sources only show up for periods in which they have data
+			if (source.ArchivedAt != nil && !hasData) || (ids != nil && !ids[id]) {
+				continue
+			}
+			metrics := domain.MarketingFunnelMetrics{SourceID: id, SourceName: source.Name}
+			if hasData {
+				addFunnel(&metrics, *m)
+			}
+			addFunnel(&funnel.Total, metrics)
+			setFunnelKPIs(&metrics)
+			funnel.Sources = append(funnel.Sources, metrics)
+		}
+		setFunnelKPIs(&funnel.Total)
+		return nil
+	})
+	return funnel, err
+}
+
+// addFunnel adds the summed figures of m to total. Amounts are rounded to
+// cents, as exact DECIMAL sums would be.
+func addFunnel(total *domain.MarketingFunnelMetrics, m domain.MarketingFunnelMetrics) {
+	total.Expense = roundTo(total.Expense+m.Expense, 2)
+	total.Leads += m.Leads
+	total.TrialsScheduled += m.TrialsScheduled
+	total.TrialsConducted += m.TrialsConducted
+	total.Payments += m.Payments
+	total.TotalAmount = roundTo(total.TotalAmount+m.TotalAmount, 2)
+}
+
+func setFunnelKPIs(m *domain.MarketingFunnelMetrics) {
+	m.CPL = memRatio(m.Expense, float64(m.Leads), 2)
+	m.CostPerTrial = memRatio(m.Expense, float64(m.TrialsConducted), 2)
+	m.CostPerPayment = memRatio(m.Expense, float64(m.Payments), 2)
+	m.LeadToScheduled = memRatio(float64(m.TrialsScheduled), float64(m.Leads), 4)
+	m.ScheduledToConducted = memRatio(float64(m.TrialsConducted), float64(m.TrialsScheduled), 4)
+	m.ConductedToPayment = memRatio(float64(m.Payments), float64(m.TrialsConducted), 4)
+	m.LeadToPayment = memRatio(float64(m.Payments), float64(m.Leads), 4)
+	m.ROMI = memRatio(m.TotalAmount, m.Expense, 4)
+}
+
+// memRatio is ROUND(num / NULLIF(den, 0), places).
+func memRatio(num, den float64, places int) *float64 {
+	if den == 0 {
+		return nil
+	}
+	v := roundTo(num/den, places)
+	return &v
+}
+
+// memBounds returns the first and last bucket of a summary like the bounds
+// CTE of summaryQuery: from (or the first date with data) truncated to the
+// bucket, and to (or the last date with data). ok is false when either end
+// is unknown, in which case there are no buckets.
+func memBounds(f memFilter, dates []string, groupBy string) (lo, hi time.Time, ok bool) {
+	from, to := f.from, f.to
+	for _, date := range dates {
+		date = isoDate(date)
+		if f.from == "" && (from == "" || date < from) {
+			from = date
+		}
+		if f.to == "" && (to == "" || date > to) {
+			to = date
+		}
+	}
+	if from == "" || to == "" {
+		return lo, hi, false
+	}
+	lo, _ = time.Parse(dateutil.ISOLayout, from)
+	hi, _ = time.Parse(dateutil.ISOLayout, to)
+	return truncDate(groupBy, lo), hi, true
+}
+
+// truncDate is date_trunc for the summary buckets; weeks start on Monday.
+func truncDate(groupBy string, t time.Time) time.Time {
+	switch groupBy {
+	case domain.GroupByWeek:
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	case domain.GroupByMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case domain.GroupByQuarter:
+		return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
+
+// memBuckets lists the bucket starts from lo to hi, like generate_series.
+func memBuckets(groupBy string, lo, hi time.Time) []string {
+	var buckets []string
+	for t := lo; !t.After(hi); {
+		buckets = append(buckets, t.Format(dateutil.ISOLayout))
+		switch groupBy {
+		case domain.GroupByDay:
+			t = t.AddDate(0, 0, 1)
+		case domain.GroupByWeek:
+			t = t.AddDate(0, 0, 7)
+		case domain.GroupByMonth:
+			t = t.AddDate(0, 1, 0)
+		case domain.GroupByQuarter:
+			t = t.AddDate(0, 3, 0)
+		}
+	}
+	return buckets
+}
+
+// bucketOf returns the bucket a stored report date falls into.
+func bucketOf(groupBy, stored string) string {
+	t, _ := time.Parse(dateutil.ISOLayout, isoDate(stored))
+	return truncDate(groupBy, t).Format(dateutil.ISOLayout)
+}
+
+func (r *MemoryRepository) GetMarketingSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) (_ []domain.MarketingSummary, err error) {
+	if _, ok := bucketIntervals[groupBy]; !ok {
+		return nil, fmt.Errorf("unsupported group_by %q", groupBy)
+	}
+	f, err := newMemFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []domain.MarketingSummary{}
+	err = r.read(ctx, func(s *memState) error {
+		sums := map[memKey]*domain.MarketingSummary{}
+		inData := map[int]bool{}
+		var dates []string
+		for _, d := range s.marketing {
+			if d.DeletedAt != nil || !f.match(d.Date, d.SourceID, d.Status) {
+				continue
+			}
+			dates = append(dates, d.Date)
+			inData[d.SourceID] = true
+
+			key := memKey{bucketOf(groupBy, d.Date), d.SourceID}
+			sum := sums[key]
+			if sum == nil {
+				sum = &domain.MarketingSummary{}
+				sums[key] = sum
+			}
+			sum.Expense = roundTo(sum.Expense+d.Expense, 2)
+			sum.Leads += d.Leads
+			sum.TrialsScheduled += d.TrialsScheduled
+			sum.TrialsConducted += d.TrialsConducted
+			sum.Payments += d.Payments
+			sum.TotalAmount = roundTo(sum.TotalAmount+d.TotalAmount, 2)
+		}
+
+		lo, hi, ok := memBounds(f, dates, groupBy)
+		if !ok {
+			return nil
+		}
+		var dims []int
+		for _, id := range slices.Sorted(maps.Keys(s.sources)) {
+			if (s.sources[id].ArchivedAt == nil || inData[id]) && (f.ids == nil || f.ids[id]) {
+				dims = append(dims, id)
+			}
+		}
+
+		for _, period := range memBuckets(groupBy, lo, hi) {
+			for _, id := range dims {
+				row := domain.MarketingSummary{}
+				if sum := sums[memKey{period, id}]; sum != nil {
+					row = *sum
+				}
+				row.Period, row.SourceID = period, id
+				summaries = append(summaries, row)
+			}
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+func (r *MemoryRepository) GetSalesSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) (_ []domain.SalesSummary, err error) {
+	if _, ok := bucketIntervals[groupBy]; !ok {
+		return nil, fmt.Errorf("unsupported group_by %q", groupBy)
+	}
+	f, err := newMemFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []domain.SalesSummary{}
+	err = r.read(ctx, func(s *memState) error {
+		sums := map[memKey]*domain.SalesSummary{}
+		inData := map[int]bool{}
+		var dates []string
+		for _, d := range s.sales {
+			if d.DeletedAt != nil || !f.match(d.Date, d.TeamID, d.Status) {
+				continue
+			}
+			dates = append(dates, d.Date)
+			inData[d.TeamID] = true
+
+			key := memKey{bucketOf(groupBy, d.Date), d.TeamID}
+			sum := sums[key]
+			if sum == nil {
+				sum = &domain.SalesSummary{}
+				sums[key] = sum
+			}
+			sum.Leads += d.Leads
+			sum.TrialsScheduled += d.TrialsScheduled
+			sum.TrialsConducted += d.TrialsConducted
+			sum.Payments += d.Payments
+			sum.TotalAmount = roundTo(sum.TotalAmount+d.TotalAmount, 2)
+			sum.KaspiRefund = roundTo(sum.KaspiRefund+d.KaspiRefund, 2)
+		}
+
+		lo, hi, ok := memBounds(f, dates, groupBy)
+		if !ok {
+			return nil
+		}
+		// Teams active at any point of the range, or with data in it
+		from, to := lo.Format(dateutil.ISOLayout), hi.Format(dateutil.ISOLayout)
+		var dims []int
+		for _, id := range slices.Sorted(maps.Keys(s.teams)) {
+			if (teamActive(s.teams[id], from, to) || inData[id]) && (f.ids == nil || f.ids[id]) {
+				dims = append(dims, id)
+			}
+		}
+
+		for _, period := range memBuckets(groupBy, lo, hi) {
+			for _, id := range dims {
+				row := domain.SalesSummary{}
+				if sum := sums[memKey{period, id}]; sum != nil {
+					row = *sum
+				}
+				row.Period, row.TeamID = period, id
+				summaries = append(summaries, row)
+			}
+		}
+		return nil
+	})
+	return summaries, err
+}
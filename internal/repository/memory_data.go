@@ -0,0 +1,869 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+func (r *MemoryRepository) GetMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error) {
+	return r.queryMarketingData(ctx, filter, false)
+}
+
+// EachMarketingData calls fn with the rows GetMarketingData returns. They are
+// copied out first, fn must not run under the lock.
+func (r *MemoryRepository) EachMarketingData(ctx context.Context, filter domain.ReportFilter, fn func(domain.MarketingData) error) error {
+	data, err := r.queryMarketingData(ctx, filter, false)
+	if err != nil {
+		return err
+	}
+	for _, d := range data {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetMarketingDataByID(ctx context.Context, id int) (data *domain.MarketingData, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		d, ok := s.marketing[id]
+		if !ok || d.DeletedAt != nil {
+			return ErrNotFound
+		}
+		data = &d
+		return nil
+	})
+	return data, err
+}
+
+// GetDeletedMarketingData lists soft-deleted rows, most recently deleted first.
+func (r *MemoryRepository) GetDeletedMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error) {
+	return r.queryMarketingData(ctx, filter, true)
+}
+
+func (r *MemoryRepository) queryMarketingData(ctx context.Context, filter domain.ReportFilter, deleted bool) (data []domain.MarketingData, err error) {
+	f, err := newMemFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.read(ctx, func(s *memState) error {
+		for _, d := range s.marketing {
+			if (d.DeletedAt != nil) == deleted && f.match(d.Date, d.SourceID, d.Status) {
+				data = append(data, d)
+			}
+		}
+		return nil
+	})
+	sort.Slice(data, func(i, j int) bool {
+		a, b := data[i], data[j]
+		return dataLess(a.DeletedAt, b.DeletedAt, a.Date, b.Date, a.SourceID, b.SourceID)
+	})
+	return data, err
+}
+
+func (r *MemoryRepository) GetSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error) {
+	return r.querySalesData(ctx, filter, false)
+}
+
+func (r *MemoryRepository) EachSalesData(ctx context.Context, filter domain.ReportFilter, fn func(domain.SalesData) error) error {
+	data, err := r.querySalesData(ctx, filter, false)
+	if err != nil {
+		return err
+	}
+	for _, d := range data {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetSalesDataByID(ctx context.Context, id int) (data *domain.SalesData, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		d, ok := s.sales[id]
+		if !ok || d.DeletedAt != nil {
+			return ErrNotFound
+		}
+		data = &d
+		return nil
+	})
+	return data, err
+}
+
+func (r *MemoryRepository) GetDeletedSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error) {
+	return r.querySalesData(ctx, filter, true)
+}
+
+func (r *MemoryRepository) querySalesData(ctx context.Context, filter domain.ReportFilter, deleted bool) (data []domain.SalesData, err error) {
+	f, err := newMemFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.read(ctx, func(s *memState) error {
+		for _, d := range s.sales {
+			if (d.DeletedAt != nil) == deleted && f.match(d.Date, d.TeamID, d.Status) {
+				data = append(data, d)
+			}
+		}
+		return nil
+	})
+	sort.Slice(data, func(i, j int) bool {
+		a, b := data[i], data[j]
+		return dataLess(a.DeletedAt, b.DeletedAt, a.Date, b.Date, a.TeamID, b.TeamID)
+	})
+	return data, err
+}
+
+// dataLess orders report rows by deleted_at DESC NULLS FIRST, date DESC and
+// source or team ID.
+func dataLess(deletedA, deletedB *time.Time, dateA, dateB string, idA, idB int) bool {
+	switch {
+	case (deletedA == nil) != (deletedB == nil):
+		return deletedA == nil
+	case deletedA != nil && !deletedA.Equal(*deletedB):
+		return deletedA.After(*deletedB)
+	case dateA != dateB:
+		return dateA > dateB
+	}
+	return idA < idB
+}
+
+// normalizeMarketing checks data against the column types of marketing_data
+// and returns the values as they would be stored.
+func normalizeMarketing(data *domain.MarketingData) (domain.MarketingData, error) {
+	d := *data
+	date, err := memDate("date", d.Date)
+	if err != nil {
+		return d, err
+	}
+	d.Date = date + memDateSuffix
+	if d.Expense, err = memAmount("expense", d.Expense); err != nil {
+		return d, err
+	}
+	if d.TotalAmount, err = memAmount("total_amount", d.TotalAmount); err != nil {
+		return d, err
+	}
+	for column, v := range map[string]int{"leads": d.Leads, "trials_scheduled": d.TrialsScheduled, "trials_conducted": d.TrialsConducted, "payments": d.Payments} {
+		if err := memCount(column, v); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+func normalizeSales(data *domain.SalesData) (domain.SalesData, error) {
+	d := *data
+	date, err := memDate("date", d.Date)
+	if err != nil {
+		return d, err
+	}
+	d.Date = date + memDateSuffix
+	if d.TotalAmount, err = memAmount("total_amount", d.TotalAmount); err != nil {
+		return d, err
+	}
+	if d.KaspiRefund, err = memAmount("kaspi_refund", d.KaspiRefund); err != nil {
+		return d, err
+	}
+	for column, v := range map[string]int{"leads": d.Leads, "trials_scheduled": d.TrialsScheduled, "trials_conducted": d.TrialsConducted, "payments": d.Payments} {
+		if err := memCount(column, v); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// checkMarketingKey enforces the (date, source_id) unique key and the
+// source_id foreign key for the row id is about to become.
+func (s *memState) checkMarketingKey(id int, key memKey) error {
+	if other, ok := s.marketingKeys[key]; ok && other != id {
+		return uniqueViolation("marketing_data_date_source_id_key", fmt.Sprintf("Key (date, source_id)=(%s, %d) already exists.", isoDate(key.date), key.id))
+	}
+	if _, ok := s.sources[key.id]; !ok {
+		return foreignKeyViolation("marketing_data_source_id_fkey", fmt.Sprintf(`Key (source_id)=(%d) is not present in table "marketing_sources".`, key.id))
+	}
+	return nil
+}
+
+func (s *memState) checkSalesKey(id int, key memKey) error {
+	if other, ok := s.salesKeys[key]; ok && other != id {
+		return uniqueViolation("sales_data_date_team_id_key", fmt.Sprintf("Key (date, team_id)=(%s, %d) already exists.", isoDate(key.date), key.id))
+	}
+	if _, ok := s.teams[key.id]; !ok {
+		return foreignKeyViolation("sales_data_team_id_fkey", fmt.Sprintf(`Key (team_id)=(%d) is not present in table "sales_teams".`, key.id))
+	}
+	return nil
+}
+
+// putMarketing stores a row and keeps the unique index in step.
+func (s *memState) putMarketing(d domain.MarketingData) {
+	if old, ok := s.marketing[d.ID]; ok {
+		delete(s.marketingKeys, memKey{old.Date, old.SourceID})
+	}
+	s.marketing[d.ID] = d
+	s.marketingKeys[memKey{d.Date, d.SourceID}] = d.ID
+}
+
+func (s *memState) putSales(d domain.SalesData) {
+	if old, ok := s.sales[d.ID]; ok {
+		delete(s.salesKeys, memKey{old.Date, old.TeamID})
+	}
+	s.sales[d.ID] = d
+	s.salesKeys[memKey{d.Date, d.TeamID}] = d.ID
+}
+
+// marketingByKey returns the row with the natural key, soft-deleted or not.
+func (s *memState) marketingByKey(date string, sourceID int) *domain.MarketingData {
+	id, ok := s.marketingKeys[memKey{date, sourceID}]
+	if !ok {
+		return nil
+	}
+	d := s.marketing[id]
+	return &d
+}
+
+func (s *memState) salesByKey(date string, teamID int) *domain.SalesData {
+	id, ok := s.salesKeys[memKey{date, teamID}]
+	if !ok {
+		return nil
+	}
+	d := s.sales[id]
+	return &d
+}
+
+func (s *memState) auditMarketingChange(meta domain.AuditMeta, action string, id int, before *domain.MarketingData) {
+	after := s.marketing[id]
+	s.writeAudit(meta, domain.AuditEntityMarketingData, id, action, memJSON(before), memJSON(&after))
+}
+
+func (s *memState) auditSalesChange(meta domain.AuditMeta, action string, id int, before *domain.SalesData) {
+	after := s.sales[id]
+	s.writeAudit(meta, domain.AuditEntitySalesData, id, action, memJSON(before), memJSON(&after))
+}
+
+// upsertMarketingData is the counterpart of the Postgres upsertMarketingData.
+// Every check runs before the first change, so a failing row leaves the
+// state untouched.
+func (s *memState) upsertMarketingData(data *domain.MarketingData, meta domain.AuditMeta) (bool, error) {
+	values, err := normalizeMarketing(data)
+	if err != nil {
+		return false, err
+	}
+	if err := s.checkPeriodOpen(values.Date); err != nil {
+		return false, err
+	}
+
+	before := s.marketingByKey(values.Date, values.SourceID)
+	if before != nil && before.DeletedAt == nil {
+		if err := checkUpsertVersion(data.Version, before.Version, before); err != nil {
+			return false, err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return false, err
+		}
+	}
+
+	var row domain.MarketingData
+	now := memNow()
+	if before == nil {
+		if err := s.checkMarketingKey(0, memKey{values.Date, values.SourceID}); err != nil {
+			return false, err
+		}
+		row = domain.MarketingData{ID: s.nextID("marketing_data"), Date: values.Date, SourceID: values.SourceID, Version: 1, CreatedAt: now}
+	} else {
+		row = *before
+		row.Version++
+	}
+	row.Expense, row.Leads, row.TrialsScheduled = values.Expense, values.Leads, values.TrialsScheduled
+	row.TrialsConducted, row.Payments, row.TotalAmount = values.TrialsConducted, values.Payments, values.TotalAmount
+	row.Status, row.UpdatedAt, row.DeletedAt = domain.StatusDraft, now, nil
+	s.putMarketing(row)
+	*data = row
+
+	action := domain.AuditActionUpdate
+	if before == nil || before.DeletedAt != nil {
+		action = domain.AuditActionInsert
+	}
+	s.auditMarketingChange(meta, action, row.ID, before)
+	return before == nil, nil
+}
+
+func (s *memState) upsertSalesData(data *domain.SalesData, meta domain.AuditMeta) (bool, error) {
+	values, err := normalizeSales(data)
+	if err != nil {
+		return false, err
+	}
+	if err := s.checkPeriodOpen(values.Date); err != nil {
+		return false, err
+	}
+
+	before := s.salesByKey(values.Date, values.TeamID)
+	if before != nil && before.DeletedAt == nil {
+		if err := checkUpsertVersion(data.Version, before.Version, before); err != nil {
+			return false, err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return false, err
+		}
+	}
+
+	var row domain.SalesData
+	now := memNow()
+	if before == nil {
+		if err := s.checkSalesKey(0, memKey{values.Date, values.TeamID}); err != nil {
+			return false, err
+		}
+		row = domain.SalesData{ID: s.nextID("sales_data"), Date: values.Date, TeamID: values.TeamID, Version: 1, CreatedAt: now}
+	} else {
+		row = *before
+		row.Version++
+	}
+	row.Leads, row.TrialsScheduled, row.TrialsConducted = values.Leads, values.TrialsScheduled, values.TrialsConducted
+	row.Payments, row.TotalAmount, row.KaspiRefund = values.Payments, values.TotalAmount, values.KaspiRefund
+	row.Status, row.UpdatedAt, row.DeletedAt = domain.StatusDraft, now, nil
+	s.putSales(row)
+	*data = row
+
+	action := domain.AuditActionUpdate
+	if before == nil || before.DeletedAt != nil {
+		action = domain.AuditActionInsert
+	}
+	s.auditSalesChange(meta, action, row.ID, before)
+	return before == nil, nil
+}
+
+// SaveMarketingData upserts on (date, source_id) when data.ID is zero and
+// updates by ID otherwise. It reports whether a new row was created.
+func (r *MemoryRepository) SaveMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (created bool, err error) {
+	if data.ID != 0 {
+		return false, r.UpdateMarketingData(ctx, data, meta)
+	}
+	err = r.write(ctx, func(s *memState) error {
+		created, err = s.upsertMarketingData(data, meta)
+		return err
+	})
+	return created, err
+}
+
+// SaveSalesData upserts on (date, team_id) when data.ID is zero and updates by ID otherwise.
+func (r *MemoryRepository) SaveSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (created bool, err error) {
+	if data.ID != 0 {
+		return false, r.UpdateSalesData(ctx, data, meta)
+	}
+	err = r.write(ctx, func(s *memState) error {
+		created, err = s.upsertSalesData(data, meta)
+		return err
+	})
+	return created, err
+}
+
+func (r *MemoryRepository) UpdateMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) error {
+	return r.write(ctx, func(s *memState) error {
+		current, ok := s.marketing[data.ID]
+		if !ok || current.DeletedAt != nil {
+			return ErrNotFound
+		}
+		before := &current
+		if err := checkVersion(data.Version, before.Version, before); err != nil {
+			return err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		values, err := normalizeMarketing(data)
+		if err != nil {
+			return err
+		}
+		// Moving a row needs both the old and the new date to be open
+		if err := s.checkPeriodOpen(before.Date, values.Date); err != nil {
+			return err
+		}
+		if err := s.checkMarketingKey(data.ID, memKey{values.Date, values.SourceID}); err != nil {
+			return err
+		}
+
+		row := *before
+		row.Date, row.SourceID, row.Expense, row.Leads = values.Date, values.SourceID, values.Expense, values.Leads
+		row.TrialsScheduled, row.TrialsConducted, row.Payments, row.TotalAmount = values.TrialsScheduled, values.TrialsConducted, values.Payments, values.TotalAmount
+		row.Status, row.UpdatedAt = domain.StatusDraft, memNow()
+		row.Version++
+		s.putMarketing(row)
+		*data = row
+		s.auditMarketingChange(meta, domain.AuditActionUpdate, data.ID, before)
+		return nil
+	})
+}
+
+func (r *MemoryRepository) UpdateSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) error {
+	return r.write(ctx, func(s *memState) error {
+		current, ok := s.sales[data.ID]
+		if !ok || current.DeletedAt != nil {
+			return ErrNotFound
+		}
+		before := &current
+		if err := checkVersion(data.Version, before.Version, before); err != nil {
+			return err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		values, err := normalizeSales(data)
+		if err != nil {
+			return err
+		}
+		if err := s.checkPeriodOpen(before.Date, values.Date); err != nil {
+			return err
+		}
+		if err := s.checkSalesKey(data.ID, memKey{values.Date, values.TeamID}); err != nil {
+			return err
+		}
+
+		row := *before
+		row.Date, row.TeamID, row.Leads, row.TrialsScheduled = values.Date, values.TeamID, values.Leads, values.TrialsScheduled
+		row.TrialsConducted, row.Payments, row.TotalAmount, row.KaspiRefund = values.TrialsConducted, values.Payments, values.TotalAmount, values.KaspiRefund
+		row.Status, row.UpdatedAt = domain.StatusDraft, memNow()
+		row.Version++
+		s.putSales(row)
+		*data = row
+		s.auditSalesChange(meta, domain.AuditActionUpdate, data.ID, before)
+		return nil
+	})
+}
+
+func (r *MemoryRepository) DeleteMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	return r.write(ctx, func(s *memState) error {
+		before, ok := s.marketing[id]
+		if !ok || before.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		if err := s.checkPeriodOpen(before.Date); err != nil {
+			return err
+		}
+
+		row, now := before, memNow()
+		row.DeletedAt = &now
+		row.Version++
+		s.putMarketing(row)
+		s.auditMarketingChange(meta, domain.AuditActionDelete, id, &before)
+		return nil
+	})
+}
+
+func (r *MemoryRepository) RestoreMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	return r.write(ctx, func(s *memState) error {
+		before, ok := s.marketing[id]
+		if !ok || before.DeletedAt == nil {
+			return ErrNotFound
+		}
+		if err := s.checkPeriodOpen(before.Date); err != nil {
+			return err
+		}
+
+		row := before
+		row.DeletedAt, row.UpdatedAt = nil, memNow()
+		row.Version++
+		s.putMarketing(row)
+		s.auditMarketingChange(meta, domain.AuditActionRestore, id, &before)
+		return nil
+	})
+}
+
+func (r *MemoryRepository) DeleteSalesData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	return r.write(ctx, func(s *memState) error {
+		before, ok := s.sales[id]
+		if !ok || before.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		if err := s.checkPeriodOpen(before.Date); err != nil {
+			return err
+		}
+
+		row, now := before, memNow()
+		row.DeletedAt = &now
+		row.Version++
+		s.putSales(row)
+		s.auditSalesChange(meta, domain.AuditActionDelete, id, &before)
+		return nil
+	})
+}
+
+func (r *MemoryRepository) RestoreSalesData(ctx context.Context, id int, meta domain.AuditMeta) error {
+	return r.write(ctx, func(s *memState) error {
+		before, ok := s.sales[id]
+		if !ok || before.DeletedAt == nil {
+			return ErrNotFound
+		}
+		if err := s.checkPeriodOpen(before.Date); err != nil {
+			return err
+		}
+
+		row := before
+		row.DeletedAt, row.UpdatedAt = nil, memNow()
+		row.Version++
+		s.putSales(row)
+		s.auditSalesChange(meta, domain.AuditActionRestore, id, &before)
+		return nil
+	})
+}
+
+// statusRows lists the IDs of the live rows of a date, optionally limited to
+// some sources or teams, ordered by that source or team.
+func statusRows[T any](rows map[int]T, key func(T) (date string, id int, deleted bool), change domain.StatusChange) []int {
+	var ids []int
+	for id, row := range rows {
+		date, dimID, deleted := key(row)
+		if !deleted && isoDate(date) == change.Date && (len(change.IDs) == 0 || slices.Contains(change.IDs, dimID)) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		_, a, _ := key(rows[ids[i]])
+		_, b, _ := key(rows[ids[j]])
+		return a < b
+	})
+	return ids
+}
+
+// ChangeMarketingStatus applies a workflow action to the marketing rows of a
+// date. Either every matching row moves or none does.
+func (r *MemoryRepository) ChangeMarketingStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) (changed []domain.MarketingData, err error) {
+	if change.Date, err = memDate("date", change.Date); err != nil {
+		return nil, err
+	}
+
+	err = r.write(ctx, func(s *memState) error {
+		if err := s.checkPeriodOpen(change.Date); err != nil {
+			return err
+		}
+
+		ids := statusRows(s.marketing, func(d domain.MarketingData) (string, int, bool) {
+			return d.Date, d.SourceID, d.DeletedAt != nil
+		}, change)
+		if len(ids) == 0 {
+			return ErrNotFound
+		}
+
+		changed = nil
+		for _, id := range ids {
+			before := s.marketing[id]
+			next, ok := domain.NextStatus(before.Status, change.Action)
+			if !ok {
+				return &StatusError{ID: id, Status: before.Status, Action: change.Action}
+			}
+			row := before
+			row.Status, row.StatusComment, row.StatusChangedBy, row.StatusChangedAt = statusFields(next, change, meta)
+			row.Version++
+			s.putMarketing(row)
+			s.auditMarketingChange(meta, domain.AuditActionStatus, id, &before)
+			changed = append(changed, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// ChangeSalesStatus is the sales counterpart of ChangeMarketingStatus.
+func (r *MemoryRepository) ChangeSalesStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) (changed []domain.SalesData, err error) {
+	if change.Date, err = memDate("date", change.Date); err != nil {
+		return nil, err
+	}
+
+	err = r.write(ctx, func(s *memState) error {
+		if err := s.checkPeriodOpen(change.Date); err != nil {
+			return err
+		}
+
+		ids := statusRows(s.sales, func(d domain.SalesData) (string, int, bool) {
+			return d.Date, d.TeamID, d.DeletedAt != nil
+		}, change)
+		if len(ids) == 0 {
+			return ErrNotFound
+		}
+
+		changed = nil
+		for _, id := range ids {
+			before := s.sales[id]
+			next, ok := domain.NextStatus(before.Status, change.Action)
+			if !ok {
+				return &StatusError{ID: id, Status: before.Status, Action: change.Action}
+			}
+			row := before
+			row.Status, row.StatusComment, row.StatusChangedBy, row.StatusChangedAt = statusFields(next, change, meta)
+			row.Version++
+			s.putSales(row)
+			s.auditSalesChange(meta, domain.AuditActionStatus, id, &before)
+			changed = append(changed, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// statusFields returns the status columns set by setStatus.
+func statusFields(next string, change domain.StatusChange, meta domain.AuditMeta) (string, *string, *string, *time.Time) {
+	var comment *string
+	if change.Comment != "" {
+		c := change.Comment
+		comment = &c
+	}
+	actor, now := actorOrSystem(meta), memNow()
+	return next, comment, &actor, &now
+}
+
+// ImportMarketingData upserts rows keyed on (date, source_id) in a single
+// write. The returned results are aligned with rows. With dryRun nothing is
+// stored, only the computed diff is returned.
+func (r *MemoryRepository) ImportMarketingData(ctx context.Context, rows []domain.MarketingData, dryRun bool, meta domain.AuditMeta) (results []domain.ImportRowResult, err error) {
+	err = r.write(ctx, func(s *memState) error {
+		results = make([]domain.ImportRowResult, len(rows))
+		for i := range rows {
+			d := &rows[i]
+
+			values, err := normalizeMarketing(d)
+			if err != nil {
+				return err
+			}
+			old := s.marketingByKey(values.Date, values.SourceID)
+
+			switch {
+			case old == nil:
+				results[i].Action = domain.ImportActionInsert
+			case old.DeletedAt != nil:
+				// A soft-deleted row is revived with the imported values
+				results[i].Action = domain.ImportActionInsert
+			default:
+				changes := marketingChanges(old, d)
+				if len(changes) == 0 {
+					d.ID = old.ID
+					results[i].Action = domain.ImportActionUnchanged
+					continue
+				}
+				results[i].Action = domain.ImportActionUpdate
+				results[i].Changes = changes
+			}
+
+			err = s.checkPeriodOpen(values.Date)
+			if err == nil && old != nil && old.DeletedAt == nil {
+				err = checkEditable(old.ID, old.Status)
+			}
+			if err != nil {
+				// A dry run reports closed periods and locked rows per row, a real import is rejected
+				if !dryRun {
+					return err
+				}
+				results[i].Action = domain.ImportActionError
+				results[i].Changes = nil
+				results[i].Error = err.Error()
+				continue
+			}
+
+			if dryRun {
+				if old != nil {
+					d.ID = old.ID
+				}
+				continue
+			}
+			// Importing overwrites on purpose, the diff was shown by the dry run
+			if old != nil {
+				d.Version = old.Version
+			}
+			if _, err := s.upsertMarketingData(d, meta); err != nil {
+				return err
+			}
+		}
+
+		if dryRun {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ImportSalesData is the sales counterpart of ImportMarketingData, keyed on (date, team_id).
+func (r *MemoryRepository) ImportSalesData(ctx context.Context, rows []domain.SalesData, dryRun bool, meta domain.AuditMeta) (results []domain.ImportRowResult, err error) {
+	err = r.write(ctx, func(s *memState) error {
+		results = make([]domain.ImportRowResult, len(rows))
+		for i := range rows {
+			d := &rows[i]
+
+			values, err := normalizeSales(d)
+			if err != nil {
+				return err
+			}
+			old := s.salesByKey(values.Date, values.TeamID)
+
+			switch {
+			case old == nil:
+				results[i].Action = domain.ImportActionInsert
+			case old.DeletedAt != nil:
+				results[i].Action = domain.ImportActionInsert
+			default:
+				changes := salesChanges(old, d)
+				if len(changes) == 0 {
+					d.ID = old.ID
+					results[i].Action = domain.ImportActionUnchanged
+					continue
+				}
+				results[i].Action = domain.ImportActionUpdate
+				results[i].Changes = changes
+			}
+
+			err = s.checkPeriodOpen(values.Date)
+			if err == nil && old != nil && old.DeletedAt == nil {
+				err = checkEditable(old.ID, old.Status)
+			}
+			if err != nil {
+				if !dryRun {
+					return err
+				}
+				results[i].Action = domain.ImportActionError
+				results[i].Changes = nil
+				results[i].Error = err.Error()
+				continue
+			}
+
+			if dryRun {
+				if old != nil {
+					d.ID = old.ID
+				}
+				continue
+			}
+			if old != nil {
+				d.Version = old.Version
+			}
+			if _, err := s.upsertSalesData(d, meta); err != nil {
+				return err
+			}
+		}
+
+		if dryRun {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SaveDailyBatch upserts all rows of the batch on their natural keys in one
+// write. All failing rows are reported; if any row fails nothing is stored.
+func (r *MemoryRepository) SaveDailyBatch(ctx context.Context, batch *domain.DailyBatch, meta domain.AuditMeta) (rowErrors []domain.BatchRowError, err error) {
+	err = r.write(ctx, func(s *memState) error {
+		rowErrors = nil
+		// upsert leaves the state untouched when it fails, which stands in
+		// for the per-row savepoint of the Postgres implementation
+		saveRow := func(kind string, index int, err error) error {
+			if err == nil {
+				return nil
+			}
+			rowError, ok := batchRowError(kind, index, err)
+			if !ok {
+				return err
+			}
+			rowErrors = append(rowErrors, rowError)
+			return nil
+		}
+
+		for i := range batch.Marketing {
+			_, err := s.upsertMarketingData(&batch.Marketing[i], meta)
+			if err := saveRow(domain.BatchKindMarketing, i, err); err != nil {
+				return err
+			}
+		}
+		for i := range batch.Sales {
+			_, err := s.upsertSalesData(&batch.Sales[i], meta)
+			if err := saveRow(domain.BatchKindSales, i, err); err != nil {
+				return err
+			}
+		}
+
+		if len(rowErrors) > 0 {
+			// Nothing is stored, IDs handed out so far are void
+			for i := range batch.Marketing {
+				batch.Marketing[i].ID = 0
+			}
+			for i := range batch.Sales {
+				batch.Sales[i].ID = 0
+			}
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rowErrors, nil
+}
+
+func (r *MemoryRepository) GetAvailableMarketingDates(ctx context.Context) (dates []string, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		dates = availableDates(s.marketing, func(d domain.MarketingData) (string, bool) { return d.Date, d.DeletedAt != nil })
+		return nil
+	})
+	return dates, err
+}
+
+func (r *MemoryRepository) GetAvailableSalesDates(ctx context.Context) (dates []string, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		dates = availableDates(s.sales, func(d domain.SalesData) (string, bool) { return d.Date, d.DeletedAt != nil })
+		return nil
+	})
+	return dates, err
+}
+
+func (r *MemoryRepository) GetAvailableDates(ctx context.Context) (dates []string, err error) {
+	err = r.read(ctx, func(s *memState) error {
+		dates = append(
+			availableDates(s.marketing, func(d domain.MarketingData) (string, bool) { return d.Date, d.DeletedAt != nil }),
+			availableDates(s.sales, func(d domain.SalesData) (string, bool) { return d.Date, d.DeletedAt != nil })...,
+		)
+		return nil
+	})
+	if len(dates) == 0 {
+		return nil, err
+	}
+	slices.Sort(dates)
+	dates = slices.Compact(dates)
+	slices.Reverse(dates)
+	return dates, err
+}
+
+// availableDates returns the distinct dates of live rows, newest first.
+func availableDates[T any](rows map[int]T, key func(T) (date string, deleted bool)) []string {
+	set := map[string]bool{}
+	for _, row := range rows {
+		if date, deleted := key(row); !deleted {
+			set[date] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	dates := slices.Sorted(maps.Keys(set))
+	slices.Reverse(dates)
+	return dates
+}
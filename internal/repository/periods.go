@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"context"
+	"database/sql"
+	"time"
+)
+
+const periodLockColumns = "id, to_char(date_from, 'YYYY-MM-DD'), to_char(date_to, 'YYYY-MM-DD'), closed_by, closed_at, reopened_by, reopened_at, reopen_reason"
+
+func scanPeriodLock(s rowScanner) (domain.PeriodLock, error) {
+	var l domain.PeriodLock
+	err := s.Scan(&l.ID, &l.From, &l.To, &l.ClosedBy, &l.ClosedAt, &l.ReopenedBy, &l.ReopenedAt, &l.ReopenReason)
+	return l, err
+}
+
+// GetPeriodLocks lists closed periods, newest first. Reopened locks are kept
+// for the record and only listed on request.
+func (r *PostgresRepository) GetPeriodLocks(ctx context.Context, includeReopened bool) (_ []domain.PeriodLock, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query := "SELECT " + periodLockColumns + " FROM period_locks"
+	if !includeReopened {
+		query += " WHERE reopened_at IS NULL"
+	}
+	query += " ORDER BY date_from DESC, id DESC"
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locks := []domain.PeriodLock{}
+	for rows.Next() {
+		l, err := scanPeriodLock(rows)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, rows.Err()
+}
+
+func (r *PostgresRepository) ClosePeriod(ctx context.Context, lock *domain.PeriodLock, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		// SHARE conflicts with the ROW EXCLUSIVE lock checkPeriodOpen takes
+		// before it looks at period_locks: writers that already passed the
+		// check finish first, later ones wait and then see the new lock
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE marketing_data, sales_data IN SHARE MODE"); err != nil {
+			return err
+		}
+
+		lock.ClosedBy = actorOrSystem(meta)
+		lock.ClosedAt = time.Now()
+		return tx.QueryRowContext(ctx,
+			"INSERT INTO period_locks (date_from, date_to, closed_by, closed_at) VALUES ($1, $2, $3, $4) RETURNING id",
+			lock.From, lock.To, lock.ClosedBy, lock.ClosedAt,
+		).Scan(&lock.ID)
+	})
+}
+
+// ReopenPeriod lifts an active lock, recording who did it and why.
+func (r *PostgresRepository) ReopenPeriod(ctx context.Context, id int, reason string, meta domain.AuditMeta) (_ *domain.PeriodLock, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	l, err := scanPeriodLock(r.db.QueryRowContext(ctx,
+		"UPDATE period_locks SET reopened_by=$1, reopened_at=$2, reopen_reason=$3 WHERE id=$4 AND reopened_at IS NULL RETURNING "+periodLockColumns,
+		actorOrSystem(meta), time.Now(), reason, id,
+	))
+	if err != nil {
+		return nil, mapNoRows(err)
+	}
+	return &l, nil
+}
+
+// checkPeriodOpen returns a *LockedError if any of the dates falls into a
+// closed period. Must run inside the writing transaction, before its first
+// write: it takes the lock the write would, so that ClosePeriod cannot slip
+// in between the check and the write. Both tables are locked, in the same
+// order as ClosePeriod, whichever one is written.
+func checkPeriodOpen(ctx context.Context, q queryer, dates ...string) error {
+	if _, err := q.ExecContext(ctx, "LOCK TABLE marketing_data, sales_data IN ROW EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+	for _, date := range dates {
+		// Dates read back from DATE columns come as RFC 3339 timestamps
+		if t, err := dateutil.ParseDate(date); err == nil {
+			date = t.Format(dateutil.ISOLayout)
+		}
+
+		var lockErr LockedError
+		err := q.QueryRowContext(ctx,
+			"SELECT id, to_char(date_from, 'YYYY-MM-DD'), to_char(date_to, 'YYYY-MM-DD') FROM period_locks WHERE reopened_at IS NULL AND $1::date BETWEEN date_from AND date_to LIMIT 1",
+			date,
+		).Scan(&lockErr.LockID, &lockErr.From, &lockErr.To)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		lockErr.Date = date
+		return &lockErr
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"bake_backend/internal/domain"
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -9,222 +10,268 @@ import (
 	"time"
 )
 
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// txOps holds the statements that differ between the SQL backends, for the
+// write paths they share.
+type txOps struct {
+	// forUpdate is appended to reads of rows that are about to be written.
+	forUpdate           string
+	checkPeriodOpen     func(ctx context.Context, q queryer, dates ...string) error
+	upsertMarketingData func(ctx context.Context, q queryer, data *domain.MarketingData, meta domain.AuditMeta) (bool, error)
+	upsertSalesData     func(ctx context.Context, q queryer, data *domain.SalesData, meta domain.AuditMeta) (bool, error)
+	now                 func() time.Time
+}
+
+var postgresOps = txOps{
+	forUpdate:           " FOR UPDATE",
+	checkPeriodOpen:     checkPeriodOpen,
+	upsertMarketingData: upsertMarketingData,
+	upsertSalesData:     upsertSalesData,
+	now:                 time.Now,
+}
+
+// Timeouts bound repository calls, zero means no limit beyond the caller's
+// context.
+type Timeouts struct {
+	// Query bounds every call but the bulk ones.
+	Query time.Duration
+	// Bulk bounds imports and daily batches, which write many rows in one
+	// transaction, and exports, which stream rows to a client.
+	Bulk time.Duration
+}
+
 type PostgresRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts Timeouts
 }
 
-func NewPostgresRepository(db *sql.DB) *PostgresRepository {
-	return &PostgresRepository{db: db}
+func NewPostgresRepository(db *sql.DB, timeouts Timeouts) *PostgresRepository {
+	return &PostgresRepository{db: db, timeouts: timeouts}
 }
 
-func (r *PostgresRepository) GetMarketingSources() ([]domain.MarketingSource, error) {
-	rows, err := r.db.Query("SELECT id, name, created_at, updated_at FROM marketing_sources")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// begin applies the query timeout to ctx. The returned func must be deferred
+// with the call's error result: it releases the timer and reports failures
+// caused by the deadline as ErrTimeout.
+func (r *PostgresRepository) begin(ctx context.Context) (context.Context, func(*error)) {
+	return beginCall(ctx, r.timeouts.Query)
+}
 
-	var sources []domain.MarketingSource
-	for rows.Next() {
-		var s domain.MarketingSource
-		if err := rows.Scan(&s.ID, &s.Name, &s.CreatedAt, &s.UpdatedAt); err != nil {
-			return nil, err
-		}
-		sources = append(sources, s)
-	}
-	return sources, nil
+// beginBulk is begin with the bulk timeout.
+func (r *PostgresRepository) beginBulk(ctx context.Context) (context.Context, func(*error)) {
+	return beginCall(ctx, r.timeouts.Bulk)
 }
 
-func (r *PostgresRepository) GetSalesTeams() ([]domain.SalesTeam, error) {
-	rows, err := r.db.Query("SELECT id, name, created_at, updated_at FROM sales_teams")
-	if err != nil {
-		return nil, err
+func beginCall(ctx context.Context, timeout time.Duration) (context.Context, func(*error)) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 	}
-	defer rows.Close()
-
-	var teams []domain.SalesTeam
-	for rows.Next() {
-		var t domain.SalesTeam
-		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt); err != nil {
-			return nil, err
-		}
-		teams = append(teams, t)
+	return ctx, func(err *error) {
+		*err = mapTimeout(ctx, *err)
+		cancel()
 	}
-	return teams, nil
 }
 
-func (r *PostgresRepository) GetMarketingData(from, to string, sourceIDs []string) ([]domain.MarketingData, error) {
-	baseQuery := "SELECT id, date, source_id, expense, leads, trials_scheduled, trials_conducted, payments, total_amount, is_saved, created_at, updated_at FROM marketing_data"
-	var conditions []string
-	var args []interface{}
-	argIndex := 1
+func (r *PostgresRepository) GetMarketingData(ctx context.Context, filter domain.ReportFilter) (_ []domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
 
-	if from != "" {
-		conditions = append(conditions, fmt.Sprintf("date >= $%d", argIndex))
-		args = append(args, from)
-		argIndex++
-	}
+	conditions, args := dataFilter("", "source_id", filter)
+	return r.queryMarketingData(ctx, append(conditions, "deleted_at IS NULL"), args)
+}
 
-	if to != "" {
-		conditions = append(conditions, fmt.Sprintf("date <= $%d", argIndex))
-		args = append(args, to)
-		argIndex++
+func (r *PostgresRepository) GetMarketingDataByID(ctx context.Context, id int) (_ *domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	d, err := getMarketingRow(ctx, r.db, "id=$1 AND deleted_at IS NULL", id)
+	if err == nil && d == nil {
+		return nil, ErrNotFound
 	}
+	return d, err
+}
 
-	if len(sourceIDs) > 0 {
-		// Convert string IDs to integers and filter out invalid ones
-		var validIDs []interface{}
-		for _, idStr := range sourceIDs {
-			if id, err := strconv.Atoi(strings.TrimSpace(idStr)); err == nil {
-				validIDs = append(validIDs, id)
-			}
-		}
+// GetDeletedMarketingData lists soft-deleted rows, most recently deleted first.
+func (r *PostgresRepository) GetDeletedMarketingData(ctx context.Context, filter domain.ReportFilter) (_ []domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
 
-		if len(validIDs) > 0 {
-			placeholders := make([]string, len(validIDs))
-			for i := range validIDs {
-				placeholders[i] = fmt.Sprintf("$%d", argIndex)
-				args = append(args, validIDs[i])
-				argIndex++
-			}
-			conditions = append(conditions, fmt.Sprintf("source_id IN (%s)", strings.Join(placeholders, ",")))
-		}
-	}
+	conditions, args := dataFilter("", "source_id", filter)
+	return r.queryMarketingData(ctx, append(conditions, "deleted_at IS NOT NULL"), args)
+}
 
-	var query string
-	if len(conditions) > 0 {
-		query = baseQuery + " WHERE " + strings.Join(conditions, " AND ")
-	} else {
-		query = baseQuery
-	}
-	query += " ORDER BY date DESC, source_id"
+// EachMarketingData calls fn with the rows GetMarketingData returns, one at
+// a time as they are read, so that exports need not hold them all. It runs
+// under the bulk timeout.
+func (r *PostgresRepository) EachMarketingData(ctx context.Context, filter domain.ReportFilter, fn func(domain.MarketingData) error) (err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
 
-	rows, err := r.db.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %w (query: %s, args: %v)", err, query, args)
-	}
-	defer rows.Close()
+	conditions, args := dataFilter("", "source_id", filter)
+	return eachMarketingRow(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+marketingOrder, args, fn)
+}
 
-	var data []domain.MarketingData
-	for rows.Next() {
-		var d domain.MarketingData
-		if err := rows.Scan(&d.ID, &d.Date, &d.SourceID, &d.Expense, &d.Leads, &d.TrialsScheduled, &d.TrialsConducted, &d.Payments, &d.TotalAmount, &d.IsSaved, &d.CreatedAt, &d.UpdatedAt); err != nil {
-			return nil, err
-		}
-		data = append(data, d)
-	}
-	return data, nil
+func (r *PostgresRepository) queryMarketingData(ctx context.Context, conditions []string, args []interface{}) ([]domain.MarketingData, error) {
+	return queryMarketingRows(ctx, r.db, strings.Join(conditions, " AND ")+marketingOrder, args...)
 }
 
-func (r *PostgresRepository) GetSalesData(from, to string, teamIDs []string) ([]domain.SalesData, error) {
-	baseQuery := "SELECT id, date, team_id, leads, trials_scheduled, trials_conducted, payments, total_amount, kaspi_refund, is_saved, created_at, updated_at FROM sales_data"
-	var conditions []string
-	var args []interface{}
-	argIndex := 1
+func (r *PostgresRepository) GetSalesData(ctx context.Context, filter domain.ReportFilter) (_ []domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
 
-	if from != "" {
-		conditions = append(conditions, fmt.Sprintf("date >= $%d", argIndex))
-		args = append(args, from)
-		argIndex++
-	}
+	conditions, args := dataFilter("", "team_id", filter)
+	return r.querySalesData(ctx, append(conditions, "deleted_at IS NULL"), args)
+}
 
-	if to != "" {
-		conditions = append(conditions, fmt.Sprintf("date <= $%d", argIndex))
-		args = append(args, to)
-		argIndex++
+func (r *PostgresRepository) GetSalesDataByID(ctx context.Context, id int) (_ *domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	d, err := getSalesRow(ctx, r.db, "id=$1 AND deleted_at IS NULL", id)
+	if err == nil && d == nil {
+		return nil, ErrNotFound
 	}
+	return d, err
+}
 
-	if len(teamIDs) > 0 {
-		// Convert string IDs to integers and filter out invalid ones
-		var validIDs []interface{}
-		for _, idStr := range teamIDs {
-			if id, err := strconv.Atoi(strings.TrimSpace(idStr)); err == nil {
-				validIDs = append(validIDs, id)
-			}
-		}
+func (r *PostgresRepository) GetDeletedSalesData(ctx context.Context, filter domain.ReportFilter) (_ []domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
 
-		if len(validIDs) > 0 {
-			placeholders := make([]string, len(validIDs))
-			for i := range validIDs {
-				placeholders[i] = fmt.Sprintf("$%d", argIndex)
-				args = append(args, validIDs[i])
-				argIndex++
-			}
-			conditions = append(conditions, fmt.Sprintf("team_id IN (%s)", strings.Join(placeholders, ",")))
-		}
-	}
+	conditions, args := dataFilter("", "team_id", filter)
+	return r.querySalesData(ctx, append(conditions, "deleted_at IS NOT NULL"), args)
+}
 
-	var query string
-	if len(conditions) > 0 {
-		query = baseQuery + " WHERE " + strings.Join(conditions, " AND ")
-	} else {
-		query = baseQuery
-	}
-	query += " ORDER BY date DESC, team_id"
+func (r *PostgresRepository) EachSalesData(ctx context.Context, filter domain.ReportFilter, fn func(domain.SalesData) error) (err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
 
-	rows, err := r.db.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %w (query: %s, args: %v)", err, query, args)
-	}
-	defer rows.Close()
+	conditions, args := dataFilter("", "team_id", filter)
+	return eachSalesRow(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+salesOrder, args, fn)
+}
 
-	var data []domain.SalesData
-	for rows.Next() {
-		var d domain.SalesData
-		if err := rows.Scan(&d.ID, &d.Date, &d.TeamID, &d.Leads, &d.TrialsScheduled, &d.TrialsConducted, &d.Payments, &d.TotalAmount, &d.KaspiRefund, &d.IsSaved, &d.CreatedAt, &d.UpdatedAt); err != nil {
-			return nil, err
-		}
-		data = append(data, d)
-	}
-	return data, nil
+func (r *PostgresRepository) querySalesData(ctx context.Context, conditions []string, args []interface{}) ([]domain.SalesData, error) {
+	return querySalesRows(ctx, r.db, strings.Join(conditions, " AND ")+salesOrder, args...)
 }
 
-func (r *PostgresRepository) SaveMarketingData(data *domain.MarketingData) error {
-	if data.ID == 0 {
-		return r.db.QueryRow(
-			"INSERT INTO marketing_data (date, source_id, expense, leads, trials_scheduled, trials_conducted, payments, total_amount, is_saved, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id",
-			data.Date, data.SourceID, data.Expense, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.IsSaved, time.Now(), time.Now(),
-		).Scan(&data.ID)
+// SaveMarketingData upserts on (date, source_id) when data.ID is zero and
+// updates by ID otherwise. It reports whether a new row was created.
+func (r *PostgresRepository) SaveMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (_ bool, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	if data.ID != 0 {
+		return false, r.UpdateMarketingData(ctx, data, meta)
 	}
-	_, err := r.db.Exec(
-		"UPDATE marketing_data SET date=$1, source_id=$2, expense=$3, leads=$4, trials_scheduled=$5, trials_conducted=$6, payments=$7, total_amount=$8, is_saved=$9, updated_at=$10 WHERE id=$11",
-		data.Date, data.SourceID, data.Expense, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.IsSaved, time.Now(), data.ID,
-	)
-	return err
+
+	var created bool
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		created, err = upsertMarketingData(ctx, tx, data, meta)
+		return err
+	})
+	return created, err
 }
 
-func (r *PostgresRepository) SaveSalesData(data *domain.SalesData) error {
-	if data.ID == 0 {
-		return r.db.QueryRow(
-			"INSERT INTO sales_data (date, team_id, leads, trials_scheduled, trials_conducted, payments, total_amount, kaspi_refund, is_saved, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id",
-			data.Date, data.TeamID, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.KaspiRefund, data.IsSaved, time.Now(), time.Now(),
-		).Scan(&data.ID)
+// SaveSalesData upserts on (date, team_id) when data.ID is zero and updates by ID otherwise.
+func (r *PostgresRepository) SaveSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (_ bool, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	if data.ID != 0 {
+		return false, r.UpdateSalesData(ctx, data, meta)
 	}
-	_, err := r.db.Exec(
-		"UPDATE sales_data SET date=$1, team_id=$2, leads=$3, trials_scheduled=$4, trials_conducted=$5, payments=$6, total_amount=$7, kaspi_refund=$8, is_saved=$9, updated_at=$10 WHERE id=$11",
-		data.Date, data.TeamID, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.KaspiRefund, data.IsSaved, time.Now(), data.ID,
-	)
-	return err
+
+	var created bool
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		created, err = upsertSalesData(ctx, tx, data, meta)
+		return err
+	})
+	return created, err
 }
 
-func (r *PostgresRepository) UpdateMarketingData(data *domain.MarketingData) error {
-	_, err := r.db.Exec(
-		"UPDATE marketing_data SET date=$1, source_id=$2, expense=$3, leads=$4, trials_scheduled=$5, trials_conducted=$6, payments=$7, total_amount=$8, is_saved=$9, updated_at=$10 WHERE id=$11",
-		data.Date, data.SourceID, data.Expense, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.IsSaved, time.Now(), data.ID,
-	)
-	return err
+func (r *PostgresRepository) UpdateMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := getMarketingRow(ctx, tx, "id=$1 AND deleted_at IS NULL FOR UPDATE", data.ID)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrNotFound
+		}
+		if err := checkVersion(data.Version, before.Version, before); err != nil {
+			return err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		// Moving a row needs both the old and the new date to be open
+		if err := checkPeriodOpen(ctx, tx, before.Date, data.Date); err != nil {
+			return err
+		}
+
+		// The response shows the row as stored, amounts rounded by the column type
+		stored, err := scanMarketingData(tx.QueryRowContext(ctx,
+			"UPDATE marketing_data SET date=$1, source_id=$2, expense=$3, leads=$4, trials_scheduled=$5, trials_conducted=$6, payments=$7, total_amount=$8, status=$9, updated_at=$10, version=version+1 WHERE id=$11 RETURNING "+marketingColumns,
+			data.Date, data.SourceID, data.Expense, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, domain.StatusDraft, time.Now(), data.ID,
+		))
+		if err != nil {
+			return mapConstraintError(err)
+		}
+		*data = stored
+		return auditMarketingChange(ctx, tx, meta, domain.AuditActionUpdate, data.ID, before)
+	})
 }
 
-func (r *PostgresRepository) UpdateSalesData(data *domain.SalesData) error {
-	_, err := r.db.Exec(
-		"UPDATE sales_data SET date=$1, team_id=$2, leads=$3, trials_scheduled=$4, trials_conducted=$5, payments=$6, total_amount=$7, kaspi_refund=$8, is_saved=$9, updated_at=$10 WHERE id=$11",
-		data.Date, data.TeamID, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.KaspiRefund, data.IsSaved, time.Now(), data.ID,
-	)
-	return err
+func (r *PostgresRepository) UpdateSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := getSalesRow(ctx, tx, "id=$1 AND deleted_at IS NULL FOR UPDATE", data.ID)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrNotFound
+		}
+		if err := checkVersion(data.Version, before.Version, before); err != nil {
+			return err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		if err := checkPeriodOpen(ctx, tx, before.Date, data.Date); err != nil {
+			return err
+		}
+
+		stored, err := scanSalesData(tx.QueryRowContext(ctx,
+			"UPDATE sales_data SET date=$1, team_id=$2, leads=$3, trials_scheduled=$4, trials_conducted=$5, payments=$6, total_amount=$7, kaspi_refund=$8, status=$9, updated_at=$10, version=version+1 WHERE id=$11 RETURNING "+salesColumns,
+			data.Date, data.TeamID, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.KaspiRefund, domain.StatusDraft, time.Now(), data.ID,
+		))
+		if err != nil {
+			return mapConstraintError(err)
+		}
+		*data = stored
+		return auditSalesChange(ctx, tx, meta, domain.AuditActionUpdate, data.ID, before)
+	})
 }
 
-func (r *PostgresRepository) GetAvailableMarketingDates() ([]string, error) {
-	rows, err := r.db.Query("SELECT DISTINCT date FROM marketing_data ORDER BY date DESC")
+func (r *PostgresRepository) GetAvailableMarketingDates(ctx context.Context) (_ []string, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT DISTINCT date FROM marketing_data WHERE deleted_at IS NULL ORDER BY date DESC")
 	if err != nil {
 		return nil, err
 	}
@@ -241,8 +288,11 @@ func (r *PostgresRepository) GetAvailableMarketingDates() ([]string, error) {
 	return dates, nil
 }
 
-func (r *PostgresRepository) GetAvailableSalesDates() ([]string, error) {
-	rows, err := r.db.Query("SELECT DISTINCT date FROM sales_data ORDER BY date DESC")
+func (r *PostgresRepository) GetAvailableSalesDates(ctx context.Context) (_ []string, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT DISTINCT date FROM sales_data WHERE deleted_at IS NULL ORDER BY date DESC")
 	if err != nil {
 		return nil, err
 	}
@@ -259,17 +309,20 @@ func (r *PostgresRepository) GetAvailableSalesDates() ([]string, error) {
 	return dates, nil
 }
 
-func (r *PostgresRepository) GetAvailableDates() ([]string, error) {
+func (r *PostgresRepository) GetAvailableDates(ctx context.Context) (_ []string, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
 	query := `
 		SELECT DISTINCT date FROM (
-			SELECT date FROM marketing_data
+			SELECT date FROM marketing_data WHERE deleted_at IS NULL
 			UNION
-			SELECT date FROM sales_data
+			SELECT date FROM sales_data WHERE deleted_at IS NULL
 		) AS all_dates
 		ORDER BY date DESC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -285,3 +338,218 @@ func (r *PostgresRepository) GetAvailableDates() ([]string, error) {
 	}
 	return dates, nil
 }
+
+const (
+	marketingColumns = "id, date, source_id, expense, leads, trials_scheduled, trials_conducted, payments, total_amount, status, status_comment, status_changed_by, status_changed_at, version, created_at, updated_at, deleted_at"
+	salesColumns     = "id, date, team_id, leads, trials_scheduled, trials_conducted, payments, total_amount, kaspi_refund, status, status_comment, status_changed_by, status_changed_at, version, created_at, updated_at, deleted_at"
+)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMarketingData reads the marketingColumns of a row, followed by extra
+// destinations for whatever the query selects after them.
+func scanMarketingData(s rowScanner, extra ...interface{}) (domain.MarketingData, error) {
+	var d domain.MarketingData
+	err := s.Scan(append([]interface{}{&d.ID, &d.Date, &d.SourceID, &d.Expense, &d.Leads, &d.TrialsScheduled, &d.TrialsConducted, &d.Payments, &d.TotalAmount, &d.Status, &d.StatusComment, &d.StatusChangedBy, &d.StatusChangedAt, &d.Version, &d.CreatedAt, &d.UpdatedAt, &d.DeletedAt}, extra...)...)
+	return d, err
+}
+
+func scanSalesData(s rowScanner, extra ...interface{}) (domain.SalesData, error) {
+	var d domain.SalesData
+	err := s.Scan(append([]interface{}{&d.ID, &d.Date, &d.TeamID, &d.Leads, &d.TrialsScheduled, &d.TrialsConducted, &d.Payments, &d.TotalAmount, &d.KaspiRefund, &d.Status, &d.StatusComment, &d.StatusChangedBy, &d.StatusChangedAt, &d.Version, &d.CreatedAt, &d.UpdatedAt, &d.DeletedAt}, extra...)...)
+	return d, err
+}
+
+// getMarketingRow returns the row matching where, or nil if there is none.
+func getMarketingRow(ctx context.Context, q queryer, where string, args ...interface{}) (*domain.MarketingData, error) {
+	d, err := scanMarketingData(q.QueryRowContext(ctx, "SELECT "+marketingColumns+" FROM marketing_data WHERE "+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func getSalesRow(ctx context.Context, q queryer, where string, args ...interface{}) (*domain.SalesData, error) {
+	d, err := scanSalesData(q.QueryRowContext(ctx, "SELECT "+salesColumns+" FROM sales_data WHERE "+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// withTx runs fn in a transaction that is committed only if fn succeeds.
+func (r *PostgresRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return inTx(ctx, r.db, fn)
+}
+
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsertMarketingData writes data on its natural key, reviving a soft-deleted
+// row, and records the change in the audit log. Must run inside a transaction.
+func upsertMarketingData(ctx context.Context, q queryer, data *domain.MarketingData, meta domain.AuditMeta) (bool, error) {
+	if err := checkPeriodOpen(ctx, q, data.Date); err != nil {
+		return false, err
+	}
+
+	before, err := getMarketingRow(ctx, q, "date=$1 AND source_id=$2 FOR UPDATE", data.Date, data.SourceID)
+	if err != nil {
+		return false, err
+	}
+	// Reviving a deleted row needs no version, nobody can have based an edit on it
+	if before != nil && before.DeletedAt == nil {
+		if err := checkUpsertVersion(data.Version, before.Version, before); err != nil {
+			return false, err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return false, err
+		}
+	}
+
+	var created bool
+	stored, err := scanMarketingData(q.QueryRowContext(ctx,
+		`INSERT INTO marketing_data (date, source_id, expense, leads, trials_scheduled, trials_conducted, payments, total_amount, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (date, source_id) DO UPDATE SET expense=EXCLUDED.expense, leads=EXCLUDED.leads, trials_scheduled=EXCLUDED.trials_scheduled,
+			trials_conducted=EXCLUDED.trials_conducted, payments=EXCLUDED.payments, total_amount=EXCLUDED.total_amount,
+			status=EXCLUDED.status, updated_at=EXCLUDED.updated_at, deleted_at=NULL, version=marketing_data.version+1
+		RETURNING `+marketingColumns+`, (xmax = 0)`,
+		data.Date, data.SourceID, data.Expense, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, domain.StatusDraft, time.Now(), time.Now(),
+	), &created)
+	if err != nil {
+		return false, mapConstraintError(err)
+	}
+	*data = stored
+
+	action := domain.AuditActionUpdate
+	if before == nil || before.DeletedAt != nil {
+		action = domain.AuditActionInsert
+	}
+	return created, auditMarketingChange(ctx, q, meta, action, data.ID, before)
+}
+
+func upsertSalesData(ctx context.Context, q queryer, data *domain.SalesData, meta domain.AuditMeta) (bool, error) {
+	if err := checkPeriodOpen(ctx, q, data.Date); err != nil {
+		return false, err
+	}
+
+	before, err := getSalesRow(ctx, q, "date=$1 AND team_id=$2 FOR UPDATE", data.Date, data.TeamID)
+	if err != nil {
+		return false, err
+	}
+	if before != nil && before.DeletedAt == nil {
+		if err := checkUpsertVersion(data.Version, before.Version, before); err != nil {
+			return false, err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return false, err
+		}
+	}
+
+	var created bool
+	stored, err := scanSalesData(q.QueryRowContext(ctx,
+		`INSERT INTO sales_data (date, team_id, leads, trials_scheduled, trials_conducted, payments, total_amount, kaspi_refund, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (date, team_id) DO UPDATE SET leads=EXCLUDED.leads, trials_scheduled=EXCLUDED.trials_scheduled,
+			trials_conducted=EXCLUDED.trials_conducted, payments=EXCLUDED.payments, total_amount=EXCLUDED.total_amount,
+			kaspi_refund=EXCLUDED.kaspi_refund, status=EXCLUDED.status, updated_at=EXCLUDED.updated_at, deleted_at=NULL, version=sales_data.version+1
+		RETURNING `+salesColumns+`, (xmax = 0)`,
+		data.Date, data.TeamID, data.Leads, data.TrialsScheduled, data.TrialsConducted, data.Payments, data.TotalAmount, data.KaspiRefund, domain.StatusDraft, time.Now(), time.Now(),
+	), &created)
+	if err != nil {
+		return false, mapConstraintError(err)
+	}
+	*data = stored
+
+	action := domain.AuditActionUpdate
+	if before == nil || before.DeletedAt != nil {
+		action = domain.AuditActionInsert
+	}
+	return created, auditSalesChange(ctx, q, meta, action, data.ID, before)
+}
+
+// checkUpdated returns ErrNotFound when an UPDATE/DELETE matched no rows.
+func checkUpdated(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// dataFilter builds the date range, ID and status conditions shared by the report queries.
+// alias qualifies the columns (e.g. "d.") and idColumn is source_id or team_id.
+// Placeholders are numbered from $1.
+func dataFilter(alias, idColumn string, filter domain.ReportFilter) ([]string, []interface{}) {
+	conditions, args := dateFilter(alias, filter.From, filter.To, 1)
+	if cond, idArgs := idFilter(alias+idColumn, filter.IDs, len(args)+1); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, idArgs...)
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("%sstatus = $%d", alias, len(args)))
+	}
+	return conditions, args
+}
+
+func dateFilter(alias, from, to string, argIndex int) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if from != "" {
+		conditions = append(conditions, fmt.Sprintf("%sdate >= $%d", alias, argIndex))
+		args = append(args, from)
+		argIndex++
+	}
+
+	if to != "" {
+		conditions = append(conditions, fmt.Sprintf("%sdate <= $%d", alias, argIndex))
+		args = append(args, to)
+	}
+
+	return conditions, args
+}
+
+// idFilter returns a "column IN (...)" condition, or "" when no valid IDs were given.
+func idFilter(column string, ids []string, argIndex int) (string, []interface{}) {
+	// Convert string IDs to integers and filter out invalid ones
+	var placeholders []string
+	var args []interface{}
+	for _, idStr := range ids {
+		if id, err := strconv.Atoi(strings.TrimSpace(idStr)); err == nil {
+			placeholders = append(placeholders, fmt.Sprintf("$%d", argIndex))
+			args = append(args, id)
+			argIndex++
+		}
+	}
+
+	if len(placeholders) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ",")), args
+}
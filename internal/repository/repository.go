@@ -2,18 +2,50 @@ package repository
 
 import (
 	"bake_backend/internal/domain"
+	"context"
 )
 
 type Repository interface {
-	GetMarketingSources() ([]domain.MarketingSource, error)
-	GetSalesTeams() ([]domain.SalesTeam, error)
-	GetMarketingData(from, to string, sourceIDs []string) ([]domain.MarketingData, error)
-	GetSalesData(from, to string, teamIDs []string) ([]domain.SalesData, error)
-	SaveMarketingData(data *domain.MarketingData) error
-	SaveSalesData(data *domain.SalesData) error
-	UpdateMarketingData(data *domain.MarketingData) error
-	UpdateSalesData(data *domain.SalesData) error
-	GetAvailableDates() ([]string, error)
-	GetAvailableMarketingDates() ([]string, error)
-	GetAvailableSalesDates() ([]string, error)
+	GetMarketingSources(ctx context.Context, includeArchived bool) ([]domain.MarketingSource, error)
+	CreateMarketingSource(ctx context.Context, source *domain.MarketingSource) error
+	RenameMarketingSource(ctx context.Context, id int, name string) error
+	ArchiveMarketingSource(ctx context.Context, id int) error
+	RestoreMarketingSource(ctx context.Context, id int) error
+	ReorderMarketingSources(ctx context.Context, ids []int) error
+	DeleteMarketingSource(ctx context.Context, id int) error
+	GetSalesTeams(ctx context.Context, from, to string) ([]domain.SalesTeam, error)
+	CreateSalesTeam(ctx context.Context, team *domain.SalesTeam) error
+	UpdateSalesTeam(ctx context.Context, team *domain.SalesTeam) error
+	DeleteSalesTeam(ctx context.Context, id int) error
+	GetMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error)
+	GetSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error)
+	EachMarketingData(ctx context.Context, filter domain.ReportFilter, fn func(domain.MarketingData) error) error
+	EachSalesData(ctx context.Context, filter domain.ReportFilter, fn func(domain.SalesData) error) error
+	GetMarketingDataByID(ctx context.Context, id int) (*domain.MarketingData, error)
+	GetSalesDataByID(ctx context.Context, id int) (*domain.SalesData, error)
+	GetMarketingFunnel(ctx context.Context, filter domain.ReportFilter) (*domain.MarketingFunnel, error)
+	GetMarketingSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) ([]domain.MarketingSummary, error)
+	GetSalesSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) ([]domain.SalesSummary, error)
+	SaveMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (bool, error)
+	SaveSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (bool, error)
+	UpdateMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) error
+	UpdateSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) error
+	DeleteMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error
+	DeleteSalesData(ctx context.Context, id int, meta domain.AuditMeta) error
+	RestoreMarketingData(ctx context.Context, id int, meta domain.AuditMeta) error
+	RestoreSalesData(ctx context.Context, id int, meta domain.AuditMeta) error
+	ChangeMarketingStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) ([]domain.MarketingData, error)
+	ChangeSalesStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) ([]domain.SalesData, error)
+	GetDeletedMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error)
+	GetDeletedSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error)
+	ImportMarketingData(ctx context.Context, rows []domain.MarketingData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error)
+	ImportSalesData(ctx context.Context, rows []domain.SalesData, dryRun bool, meta domain.AuditMeta) ([]domain.ImportRowResult, error)
+	SaveDailyBatch(ctx context.Context, batch *domain.DailyBatch, meta domain.AuditMeta) ([]domain.BatchRowError, error)
+	GetAuditLog(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, error)
+	GetPeriodLocks(ctx context.Context, includeReopened bool) ([]domain.PeriodLock, error)
+	ClosePeriod(ctx context.Context, lock *domain.PeriodLock, meta domain.AuditMeta) error
+	ReopenPeriod(ctx context.Context, id int, reason string, meta domain.AuditMeta) (*domain.PeriodLock, error)
+	GetAvailableDates(ctx context.Context) ([]string, error)
+	GetAvailableMarketingDates(ctx context.Context) ([]string, error)
+	GetAvailableSalesDates(ctx context.Context) ([]string, error)
 }
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"time"
+)
+
+// GetMarketingSources lists sources in display order. Archived sources are
+// only included on request, e.g. to resolve names of historical rows.
+func (r *PostgresRepository) GetMarketingSources(ctx context.Context, includeArchived bool) (_ []domain.MarketingSource, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query := "SELECT id, name, sort_order, archived_at, created_at, updated_at FROM marketing_sources"
+	if !includeArchived {
+		query += " WHERE archived_at IS NULL"
+	}
+	query += " ORDER BY sort_order, id"
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []domain.MarketingSource
+	for rows.Next() {
+		var s domain.MarketingSource
+		if err := rows.Scan(&s.ID, &s.Name, &s.SortOrder, &s.ArchivedAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// CreateMarketingSource adds a source at the end of the display order.
+func (r *PostgresRepository) CreateMarketingSource(ctx context.Context, source *domain.MarketingSource) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	now := time.Now()
+	err = r.db.QueryRowContext(ctx,
+		"INSERT INTO marketing_sources (name, sort_order, created_at, updated_at) SELECT $1, COALESCE(MAX(sort_order), 0) + 1, $2, $2 FROM marketing_sources RETURNING id, sort_order",
+		source.Name, now,
+	).Scan(&source.ID, &source.SortOrder)
+	if err != nil {
+		return mapConstraintError(err)
+	}
+	source.CreatedAt, source.UpdatedAt = now, now
+	return nil
+}
+
+func (r *PostgresRepository) RenameMarketingSource(ctx context.Context, id int, name string) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	res, err := r.db.ExecContext(ctx, "UPDATE marketing_sources SET name=$1, updated_at=$2 WHERE id=$3", name, time.Now(), id)
+	return checkUpdated(res, mapConstraintError(err))
+}
+
+func (r *PostgresRepository) ArchiveMarketingSource(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	res, err := r.db.ExecContext(ctx, "UPDATE marketing_sources SET archived_at=COALESCE(archived_at, $1), updated_at=$1 WHERE id=$2", time.Now(), id)
+	return checkUpdated(res, err)
+}
+
+func (r *PostgresRepository) RestoreMarketingSource(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	res, err := r.db.ExecContext(ctx, "UPDATE marketing_sources SET archived_at=NULL, updated_at=$1 WHERE id=$2", time.Now(), id)
+	return checkUpdated(res, err)
+}
+
+// ReorderMarketingSources assigns sort_order following the position of each ID.
+// Sources missing from ids keep their order but move behind the listed ones.
+func (r *PostgresRepository) ReorderMarketingSources(ctx context.Context, ids []int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE marketing_sources SET sort_order = sort_order + $1", len(ids)); err != nil {
+		return err
+	}
+	for i, id := range ids {
+		res, err := tx.ExecContext(ctx, "UPDATE marketing_sources SET sort_order=$1, updated_at=$2 WHERE id=$3", i+1, time.Now(), id)
+		if err := checkUpdated(res, err); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteMarketingSource removes a source that was never used. Sources with
+// marketing data can only be archived.
+func (r *PostgresRepository) DeleteMarketingSource(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var inUse bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM marketing_data WHERE source_id=$1)", id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return &ConflictError{Constraint: "marketing_data_source_id_fkey", Message: "source has marketing data, archive it instead"}
+	}
+
+	res, err := r.db.ExecContext(ctx, "DELETE FROM marketing_sources WHERE id=$1", id)
+	return checkUpdated(res, mapConstraintError(err))
+}
@@ -0,0 +1,467 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// SQLiteRepository stores data in a SQLite file, for deployments on a single
+// machine and for integration tests. It keeps the row format, errors and audit
+// trail of PostgresRepository; its schema lives in migrations/sqlite.
+//
+// The database must be opened with foreign keys enabled, immediate write
+// transactions (which stand in for SELECT ... FOR UPDATE) and the "sqlite"
+// time format, see SQLiteDSN. Timestamps are written in UTC so that they
+// compare correctly as text.
+type SQLiteRepository struct {
+	db       *sql.DB
+	timeouts Timeouts
+}
+
+func NewSQLiteRepository(db *sql.DB, timeouts Timeouts) *SQLiteRepository {
+	return &SQLiteRepository{db: db, timeouts: timeouts}
+}
+
+// SQLiteDSN returns the connection string SQLiteRepository expects for the
+// database file at path.
+func SQLiteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite&_txlock=immediate"
+}
+
+func (r *SQLiteRepository) begin(ctx context.Context) (context.Context, func(*error)) {
+	return beginCall(ctx, r.timeouts.Query)
+}
+
+func (r *SQLiteRepository) beginBulk(ctx context.Context) (context.Context, func(*error)) {
+	return beginCall(ctx, r.timeouts.Bulk)
+}
+
+func (r *SQLiteRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return inTx(ctx, r.db, fn)
+}
+
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+// sqliteOps needs no row locks: write transactions start with BEGIN
+// IMMEDIATE and so hold the database's write lock throughout.
+var sqliteOps = txOps{
+	checkPeriodOpen:     sqliteCheckPeriodOpen,
+	upsertMarketingData: sqliteUpsertMarketingData,
+	upsertSalesData:     sqliteUpsertSalesData,
+	now:                 sqliteNow,
+}
+
+// sqliteConstraint matches the constraint errors of SQLite, e.g.
+// "UNIQUE constraint failed: marketing_data.date, marketing_data.source_id".
+var sqliteConstraint = regexp.MustCompile(`(UNIQUE|FOREIGN KEY|CHECK|NOT NULL) constraint failed(?:: ([^()]*?))?(?: \(\d+\))?$`)
+
+// mapSQLiteError is the SQLite counterpart of mapConstraintError. Unique
+// violations are reported under the constraint names Postgres generates.
+func mapSQLiteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	m := sqliteConstraint.FindStringSubmatch(sqliteErr.Error())
+	if m == nil {
+		return err
+	}
+
+	var table string
+	var columns []string
+	for _, c := range strings.Split(m[2], ", ") {
+		t, column, _ := strings.Cut(c, ".")
+		table, columns = t, append(columns, column)
+	}
+
+	switch m[1] {
+	case "UNIQUE":
+		return uniqueViolation(table+"_"+strings.Join(columns, "_")+"_key", fmt.Sprintf("Key (%s) already exists.", strings.Join(columns, ", ")))
+	case "FOREIGN KEY":
+		// SQLite does not tell which key failed
+		return foreignKeyViolation("foreign key", "")
+	case "CHECK":
+		return checkViolation("", m[2])
+	default:
+		return checkViolation(columns[0], "not null constraint on "+columns[0])
+	}
+}
+
+func (r *SQLiteRepository) GetMarketingData(ctx context.Context, filter domain.ReportFilter) (_ []domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	conditions, args, err := sqliteDataFilter("source_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	return queryMarketingRows(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+marketingOrder, args...)
+}
+
+// EachMarketingData calls fn with the rows GetMarketingData returns, one at
+// a time as they are read. It runs under the bulk timeout.
+func (r *SQLiteRepository) EachMarketingData(ctx context.Context, filter domain.ReportFilter, fn func(domain.MarketingData) error) (err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	conditions, args, err := sqliteDataFilter("source_id", filter)
+	if err != nil {
+		return err
+	}
+	return eachMarketingRow(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+marketingOrder, args, fn)
+}
+
+func (r *SQLiteRepository) GetMarketingDataByID(ctx context.Context, id int) (_ *domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	d, err := getMarketingRow(ctx, r.db, "id=$1 AND deleted_at IS NULL", id)
+	if err == nil && d == nil {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+// GetDeletedMarketingData lists soft-deleted rows, most recently deleted first.
+func (r *SQLiteRepository) GetDeletedMarketingData(ctx context.Context, filter domain.ReportFilter) (_ []domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	conditions, args, err := sqliteDataFilter("source_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	return queryMarketingRows(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NOT NULL"), " AND ")+marketingOrder, args...)
+}
+
+func (r *SQLiteRepository) GetSalesData(ctx context.Context, filter domain.ReportFilter) (_ []domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	conditions, args, err := sqliteDataFilter("team_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	return querySalesRows(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+salesOrder, args...)
+}
+
+func (r *SQLiteRepository) EachSalesData(ctx context.Context, filter domain.ReportFilter, fn func(domain.SalesData) error) (err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	conditions, args, err := sqliteDataFilter("team_id", filter)
+	if err != nil {
+		return err
+	}
+	return eachSalesRow(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+salesOrder, args, fn)
+}
+
+func (r *SQLiteRepository) GetSalesDataByID(ctx context.Context, id int) (_ *domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	d, err := getSalesRow(ctx, r.db, "id=$1 AND deleted_at IS NULL", id)
+	if err == nil && d == nil {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+func (r *SQLiteRepository) GetDeletedSalesData(ctx context.Context, filter domain.ReportFilter) (_ []domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	conditions, args, err := sqliteDataFilter("team_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	return querySalesRows(ctx, r.db, strings.Join(append(conditions, "deleted_at IS NOT NULL"), " AND ")+salesOrder, args...)
+}
+
+const (
+	marketingOrder = " ORDER BY deleted_at DESC NULLS FIRST, date DESC, source_id"
+	salesOrder     = " ORDER BY deleted_at DESC NULLS FIRST, date DESC, team_id"
+)
+
+// sqliteDataFilter is dataFilter with the dates brought into the YYYY-MM-DD
+// form they are stored in, as text comparisons depend on it.
+func sqliteDataFilter(idColumn string, filter domain.ReportFilter) ([]string, []interface{}, error) {
+	var err error
+	if filter.From != "" {
+		if filter.From, err = memDate("date", filter.From); err != nil {
+			return nil, nil, err
+		}
+	}
+	if filter.To != "" {
+		if filter.To, err = memDate("date", filter.To); err != nil {
+			return nil, nil, err
+		}
+	}
+	conditions, args := dataFilter("", idColumn, filter)
+	return conditions, args, nil
+}
+
+// SaveMarketingData upserts on (date, source_id) when data.ID is zero and
+// updates by ID otherwise. It reports whether a new row was created.
+func (r *SQLiteRepository) SaveMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (_ bool, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	if data.ID != 0 {
+		return false, r.UpdateMarketingData(ctx, data, meta)
+	}
+
+	var created bool
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		created, err = sqliteUpsertMarketingData(ctx, tx, data, meta)
+		return err
+	})
+	return created, err
+}
+
+// SaveSalesData upserts on (date, team_id) when data.ID is zero and updates by ID otherwise.
+func (r *SQLiteRepository) SaveSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (_ bool, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	if data.ID != 0 {
+		return false, r.UpdateSalesData(ctx, data, meta)
+	}
+
+	var created bool
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		created, err = sqliteUpsertSalesData(ctx, tx, data, meta)
+		return err
+	})
+	return created, err
+}
+
+func (r *SQLiteRepository) UpdateMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	values, err := normalizeMarketing(data)
+	if err != nil {
+		return err
+	}
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := getMarketingRow(ctx, tx, "id=$1 AND deleted_at IS NULL", data.ID)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrNotFound
+		}
+		if err := checkVersion(data.Version, before.Version, before); err != nil {
+			return err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		// Moving a row needs both the old and the new date to be open
+		if err := sqliteCheckPeriodOpen(ctx, tx, before.Date, values.Date); err != nil {
+			return err
+		}
+
+		stored, err := scanMarketingData(tx.QueryRowContext(ctx,
+			"UPDATE marketing_data SET date=$1, source_id=$2, expense=$3, leads=$4, trials_scheduled=$5, trials_conducted=$6, payments=$7, total_amount=$8, status=$9, updated_at=$10, version=version+1 WHERE id=$11 RETURNING "+marketingColumns,
+			isoDate(values.Date), values.SourceID, values.Expense, values.Leads, values.TrialsScheduled, values.TrialsConducted, values.Payments, values.TotalAmount, domain.StatusDraft, sqliteNow(), data.ID,
+		))
+		if err != nil {
+			return mapSQLiteError(err)
+		}
+		*data = stored
+		return auditMarketingChange(ctx, tx, meta, domain.AuditActionUpdate, data.ID, before)
+	})
+}
+
+func (r *SQLiteRepository) UpdateSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	values, err := normalizeSales(data)
+	if err != nil {
+		return err
+	}
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := getSalesRow(ctx, tx, "id=$1 AND deleted_at IS NULL", data.ID)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrNotFound
+		}
+		if err := checkVersion(data.Version, before.Version, before); err != nil {
+			return err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return err
+		}
+		if err := sqliteCheckPeriodOpen(ctx, tx, before.Date, values.Date); err != nil {
+			return err
+		}
+
+		stored, err := scanSalesData(tx.QueryRowContext(ctx,
+			"UPDATE sales_data SET date=$1, team_id=$2, leads=$3, trials_scheduled=$4, trials_conducted=$5, payments=$6, total_amount=$7, kaspi_refund=$8, status=$9, updated_at=$10, version=version+1 WHERE id=$11 RETURNING "+salesColumns,
+			isoDate(values.Date), values.TeamID, values.Leads, values.TrialsScheduled, values.TrialsConducted, values.Payments, values.TotalAmount, values.KaspiRefund, domain.StatusDraft, sqliteNow(), data.ID,
+		))
+		if err != nil {
+			return mapSQLiteError(err)
+		}
+		*data = stored
+		return auditSalesChange(ctx, tx, meta, domain.AuditActionUpdate, data.ID, before)
+	})
+}
+
+// sqliteUpsertMarketingData is upsertMarketingData for SQLite. Whether the row
+// is new follows from the lookup, the write lock of the transaction keeps
+// anyone else from inserting it in between.
+func sqliteUpsertMarketingData(ctx context.Context, q queryer, data *domain.MarketingData, meta domain.AuditMeta) (bool, error) {
+	values, err := normalizeMarketing(data)
+	if err != nil {
+		return false, err
+	}
+	date := isoDate(values.Date)
+	if err := sqliteCheckPeriodOpen(ctx, q, date); err != nil {
+		return false, err
+	}
+
+	before, err := getMarketingRow(ctx, q, "date=$1 AND source_id=$2", date, values.SourceID)
+	if err != nil {
+		return false, err
+	}
+	if before != nil && before.DeletedAt == nil {
+		if err := checkUpsertVersion(data.Version, before.Version, before); err != nil {
+			return false, err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return false, err
+		}
+	}
+
+	now := sqliteNow()
+	stored, err := scanMarketingData(q.QueryRowContext(ctx,
+		`INSERT INTO marketing_data (date, source_id, expense, leads, trials_scheduled, trials_conducted, payments, total_amount, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (date, source_id) DO UPDATE SET expense=excluded.expense, leads=excluded.leads, trials_scheduled=excluded.trials_scheduled,
+			trials_conducted=excluded.trials_conducted, payments=excluded.payments, total_amount=excluded.total_amount,
+			status=excluded.status, updated_at=excluded.updated_at, deleted_at=NULL, version=marketing_data.version+1
+		RETURNING `+marketingColumns,
+		date, values.SourceID, values.Expense, values.Leads, values.TrialsScheduled, values.TrialsConducted, values.Payments, values.TotalAmount, domain.StatusDraft, now, now,
+	))
+	if err != nil {
+		return false, mapSQLiteError(err)
+	}
+	*data = stored
+
+	action := domain.AuditActionUpdate
+	if before == nil || before.DeletedAt != nil {
+		action = domain.AuditActionInsert
+	}
+	return before == nil, auditMarketingChange(ctx, q, meta, action, data.ID, before)
+}
+
+func sqliteUpsertSalesData(ctx context.Context, q queryer, data *domain.SalesData, meta domain.AuditMeta) (bool, error) {
+	values, err := normalizeSales(data)
+	if err != nil {
+		return false, err
+	}
+	date := isoDate(values.Date)
+	if err := sqliteCheckPeriodOpen(ctx, q, date); err != nil {
+		return false, err
+	}
+
+	before, err := getSalesRow(ctx, q, "date=$1 AND team_id=$2", date, values.TeamID)
+	if err != nil {
+		return false, err
+	}
+	if before != nil && before.DeletedAt == nil {
+		if err := checkUpsertVersion(data.Version, before.Version, before); err != nil {
+			return false, err
+		}
+		if err := checkEditable(before.ID, before.Status); err != nil {
+			return false, err
+		}
+	}
+
+	now := sqliteNow()
+	stored, err := scanSalesData(q.QueryRowContext(ctx,
+		`INSERT INTO sales_data (date, team_id, leads, trials_scheduled, trials_conducted, payments, total_amount, kaspi_refund, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (date, team_id) DO UPDATE SET leads=excluded.leads, trials_scheduled=excluded.trials_scheduled,
+			trials_conducted=excluded.trials_conducted, payments=excluded.payments, total_amount=excluded.total_amount,
+			kaspi_refund=excluded.kaspi_refund, status=excluded.status, updated_at=excluded.updated_at, deleted_at=NULL, version=sales_data.version+1
+		RETURNING `+salesColumns,
+		date, values.TeamID, values.Leads, values.TrialsScheduled, values.TrialsConducted, values.Payments, values.TotalAmount, values.KaspiRefund, domain.StatusDraft, now, now,
+	))
+	if err != nil {
+		return false, mapSQLiteError(err)
+	}
+	*data = stored
+
+	action := domain.AuditActionUpdate
+	if before == nil || before.DeletedAt != nil {
+		action = domain.AuditActionInsert
+	}
+	return before == nil, auditSalesChange(ctx, q, meta, action, data.ID, before)
+}
+
+func (r *SQLiteRepository) GetAvailableMarketingDates(ctx context.Context) (_ []string, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return queryDates(ctx, r.db, "SELECT DISTINCT date FROM marketing_data WHERE deleted_at IS NULL ORDER BY date DESC")
+}
+
+func (r *SQLiteRepository) GetAvailableSalesDates(ctx context.Context) (_ []string, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return queryDates(ctx, r.db, "SELECT DISTINCT date FROM sales_data WHERE deleted_at IS NULL ORDER BY date DESC")
+}
+
+func (r *SQLiteRepository) GetAvailableDates(ctx context.Context) (_ []string, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return queryDates(ctx, r.db, `
+		SELECT date FROM marketing_data WHERE deleted_at IS NULL
+		UNION
+		SELECT date FROM sales_data WHERE deleted_at IS NULL
+		ORDER BY date DESC
+	`)
+}
+
+// queryDates reads a single date column. Dates come back in the RFC 3339
+// form lib/pq uses, whether or not the driver knows the column type.
+func queryDates(ctx context.Context, q queryer, query string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dates []string
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		dates = append(dates, isoDate(date)+memDateSuffix)
+	}
+	return dates, rows.Err()
+}
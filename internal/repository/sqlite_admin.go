@@ -0,0 +1,574 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// This file holds the SQLiteRepository methods that are not about report rows:
+// reference data, period locks, the audit log and users. DATE columns are read
+// with CAST(... AS TEXT), the SQLite counterpart of to_char(..., 'YYYY-MM-DD').
+
+func (r *SQLiteRepository) DeleteMarketingData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return deleteMarketingRow(ctx, tx, sqliteOps, id, meta)
+	})
+}
+
+func (r *SQLiteRepository) RestoreMarketingData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return restoreMarketingRow(ctx, tx, sqliteOps, id, meta)
+	})
+}
+
+func (r *SQLiteRepository) DeleteSalesData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return deleteSalesRow(ctx, tx, sqliteOps, id, meta)
+	})
+}
+
+func (r *SQLiteRepository) RestoreSalesData(ctx context.Context, id int, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return restoreSalesRow(ctx, tx, sqliteOps, id, meta)
+	})
+}
+
+func (r *SQLiteRepository) ChangeMarketingStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) (_ []domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var changed []domain.MarketingData
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		changed, err = changeMarketingStatus(ctx, tx, sqliteOps, change, meta)
+		return err
+	})
+	return changed, err
+}
+
+func (r *SQLiteRepository) ChangeSalesStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) (_ []domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var changed []domain.SalesData
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		changed, err = changeSalesStatus(ctx, tx, sqliteOps, change, meta)
+		return err
+	})
+	return changed, err
+}
+
+func (r *SQLiteRepository) SaveDailyBatch(ctx context.Context, batch *domain.DailyBatch, meta domain.AuditMeta) (_ []domain.BatchRowError, err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	return saveDailyBatch(ctx, r.db, sqliteOps, batch, meta)
+}
+
+func (r *SQLiteRepository) ImportMarketingData(ctx context.Context, rows []domain.MarketingData, dryRun bool, meta domain.AuditMeta) (_ []domain.ImportRowResult, err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	return importMarketingData(ctx, r.db, sqliteOps, rows, dryRun, meta)
+}
+
+func (r *SQLiteRepository) ImportSalesData(ctx context.Context, rows []domain.SalesData, dryRun bool, meta domain.AuditMeta) (_ []domain.ImportRowResult, err error) {
+	ctx, done := r.beginBulk(ctx)
+	defer done(&err)
+
+	return importSalesData(ctx, r.db, sqliteOps, rows, dryRun, meta)
+}
+
+func (r *SQLiteRepository) GetMarketingSources(ctx context.Context, includeArchived bool) (_ []domain.MarketingSource, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query := "SELECT id, name, sort_order, archived_at, created_at, updated_at FROM marketing_sources"
+	if !includeArchived {
+		query += " WHERE archived_at IS NULL"
+	}
+	query += " ORDER BY sort_order, id"
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []domain.MarketingSource
+	for rows.Next() {
+		var s domain.MarketingSource
+		if err := rows.Scan(&s.ID, &s.Name, &s.SortOrder, &s.ArchivedAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, rows.Err()
+}
+
+func (r *SQLiteRepository) CreateMarketingSource(ctx context.Context, source *domain.MarketingSource) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	now := sqliteNow()
+	err = r.db.QueryRowContext(ctx,
+		"INSERT INTO marketing_sources (name, sort_order, created_at, updated_at) SELECT $1, COALESCE(MAX(sort_order), 0) + 1, $2, $2 FROM marketing_sources RETURNING id, sort_order",
+		source.Name, now,
+	).Scan(&source.ID, &source.SortOrder)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	source.CreatedAt, source.UpdatedAt = now, now
+	return nil
+}
+
+func (r *SQLiteRepository) RenameMarketingSource(ctx context.Context, id int, name string) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	res, err := r.db.ExecContext(ctx, "UPDATE marketing_sources SET name=$1, updated_at=$2 WHERE id=$3", name, sqliteNow(), id)
+	return checkUpdated(res, mapSQLiteError(err))
+}
+
+func (r *SQLiteRepository) ArchiveMarketingSource(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	res, err := r.db.ExecContext(ctx, "UPDATE marketing_sources SET archived_at=COALESCE(archived_at, $1), updated_at=$1 WHERE id=$2", sqliteNow(), id)
+	return checkUpdated(res, err)
+}
+
+func (r *SQLiteRepository) RestoreMarketingSource(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	res, err := r.db.ExecContext(ctx, "UPDATE marketing_sources SET archived_at=NULL, updated_at=$1 WHERE id=$2", sqliteNow(), id)
+	return checkUpdated(res, err)
+}
+
+// ReorderMarketingSources assigns sort_order following the position of each ID.
+// Sources missing from ids keep their order but move behind the listed ones.
+func (r *SQLiteRepository) ReorderMarketingSources(ctx context.Context, ids []int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE marketing_sources SET sort_order = sort_order + $1", len(ids)); err != nil {
+			return err
+		}
+		for i, id := range ids {
+			res, err := tx.ExecContext(ctx, "UPDATE marketing_sources SET sort_order=$1, updated_at=$2 WHERE id=$3", i+1, sqliteNow(), id)
+			if err := checkUpdated(res, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteMarketingSource removes a source that was never used. Sources with
+// marketing data can only be archived.
+func (r *SQLiteRepository) DeleteMarketingSource(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var inUse bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM marketing_data WHERE source_id=$1)", id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return &ConflictError{Constraint: "marketing_data_source_id_fkey", Message: "source has marketing data, archive it instead"}
+	}
+
+	res, err := r.db.ExecContext(ctx, "DELETE FROM marketing_sources WHERE id=$1", id)
+	return checkUpdated(res, mapSQLiteError(err))
+}
+
+// GetSalesTeams lists teams whose activity period overlaps [from, to].
+func (r *SQLiteRepository) GetSalesTeams(ctx context.Context, from, to string) (_ []domain.SalesTeam, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query := "SELECT id, name, CAST(active_from AS TEXT), CAST(active_to AS TEXT), created_at, updated_at FROM sales_teams"
+
+	var conditions []string
+	var args []interface{}
+	if to != "" {
+		if to, err = memDate("to", to); err != nil {
+			return nil, err
+		}
+		args = append(args, to)
+		conditions = append(conditions, fmt.Sprintf("(active_from IS NULL OR active_from <= $%d)", len(args)))
+	}
+	if from != "" {
+		if from, err = memDate("from", from); err != nil {
+			return nil, err
+		}
+		args = append(args, from)
+		conditions = append(conditions, fmt.Sprintf("(active_to IS NULL OR active_to >= $%d)", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []domain.SalesTeam
+	for rows.Next() {
+		var t domain.SalesTeam
+		if err := rows.Scan(&t.ID, &t.Name, &t.ActiveFrom, &t.ActiveTo, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+func (r *SQLiteRepository) CreateSalesTeam(ctx context.Context, team *domain.SalesTeam) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	from, to, err := sqliteActivePeriod(team)
+	if err != nil {
+		return err
+	}
+
+	now := sqliteNow()
+	err = r.db.QueryRowContext(ctx,
+		"INSERT INTO sales_teams (name, active_from, active_to, created_at, updated_at) VALUES ($1, $2, $3, $4, $4) RETURNING id",
+		team.Name, from, to, now,
+	).Scan(&team.ID)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	team.CreatedAt, team.UpdatedAt = now, now
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateSalesTeam(ctx context.Context, team *domain.SalesTeam) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	from, to, err := sqliteActivePeriod(team)
+	if err != nil {
+		return err
+	}
+
+	team.UpdatedAt = sqliteNow()
+	err = r.db.QueryRowContext(ctx,
+		"UPDATE sales_teams SET name=$1, active_from=$2, active_to=$3, updated_at=$4 WHERE id=$5 RETURNING created_at",
+		team.Name, from, to, team.UpdatedAt, team.ID,
+	).Scan(&team.CreatedAt)
+	return mapNoRows(mapSQLiteError(err))
+}
+
+// sqliteActivePeriod returns the activity bounds of team as YYYY-MM-DD, so
+// that they compare correctly as text.
+func sqliteActivePeriod(team *domain.SalesTeam) (from, to *string, err error) {
+	if from, err = memOptionalDate("active_from", team.ActiveFrom); err != nil {
+		return nil, nil, err
+	}
+	if to, err = memOptionalDate("active_to", team.ActiveTo); err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
+
+func (r *SQLiteRepository) DeleteSalesTeam(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var inUse bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM sales_data WHERE team_id=$1)", id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return &ConflictError{Constraint: "sales_data_team_id_fkey", Message: "team has sales data, set active_to instead"}
+	}
+
+	res, err := r.db.ExecContext(ctx, "DELETE FROM sales_teams WHERE id=$1", id)
+	return checkUpdated(res, mapSQLiteError(err))
+}
+
+const sqlitePeriodLockColumns = "id, CAST(date_from AS TEXT), CAST(date_to AS TEXT), closed_by, closed_at, reopened_by, reopened_at, reopen_reason"
+
+func (r *SQLiteRepository) GetPeriodLocks(ctx context.Context, includeReopened bool) (_ []domain.PeriodLock, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query := "SELECT " + sqlitePeriodLockColumns + " FROM period_locks"
+	if !includeReopened {
+		query += " WHERE reopened_at IS NULL"
+	}
+	query += " ORDER BY date_from DESC, id DESC"
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locks := []domain.PeriodLock{}
+	for rows.Next() {
+		l, err := scanPeriodLock(rows)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, rows.Err()
+}
+
+// ClosePeriod needs no table lock: its immediate transaction already keeps
+// other writers out until the lock is committed.
+func (r *SQLiteRepository) ClosePeriod(ctx context.Context, lock *domain.PeriodLock, meta domain.AuditMeta) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	from, err := memDate("date_from", lock.From)
+	if err != nil {
+		return err
+	}
+	to, err := memDate("date_to", lock.To)
+	if err != nil {
+		return err
+	}
+
+	lock.ClosedBy = actorOrSystem(meta)
+	lock.ClosedAt = sqliteNow()
+	err = r.db.QueryRowContext(ctx,
+		"INSERT INTO period_locks (date_from, date_to, closed_by, closed_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		from, to, lock.ClosedBy, lock.ClosedAt,
+	).Scan(&lock.ID)
+	return mapSQLiteError(err)
+}
+
+func (r *SQLiteRepository) ReopenPeriod(ctx context.Context, id int, reason string, meta domain.AuditMeta) (_ *domain.PeriodLock, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	l, err := scanPeriodLock(r.db.QueryRowContext(ctx,
+		"UPDATE period_locks SET reopened_by=$1, reopened_at=$2, reopen_reason=$3 WHERE id=$4 AND reopened_at IS NULL RETURNING "+sqlitePeriodLockColumns,
+		actorOrSystem(meta), sqliteNow(), reason, id,
+	))
+	if err != nil {
+		return nil, mapNoRows(err)
+	}
+	return &l, nil
+}
+
+// sqliteCheckPeriodOpen is checkPeriodOpen for SQLite, where DATE columns
+// hold YYYY-MM-DD text.
+func sqliteCheckPeriodOpen(ctx context.Context, q queryer, dates ...string) error {
+	for _, date := range dates {
+		if t, err := dateutil.ParseDate(date); err == nil {
+			date = t.Format(dateutil.ISOLayout)
+		}
+
+		var lockErr LockedError
+		err := q.QueryRowContext(ctx,
+			"SELECT id, CAST(date_from AS TEXT), CAST(date_to AS TEXT) FROM period_locks WHERE reopened_at IS NULL AND $1 BETWEEN date_from AND date_to ORDER BY id LIMIT 1",
+			date,
+		).Scan(&lockErr.LockID, &lockErr.From, &lockErr.To)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		lockErr.Date = date
+		return &lockErr
+	}
+	return nil
+}
+
+// GetAuditLog returns matching entries, newest first. The date bounds are
+// taken in local time, as Postgres does with its session time zone, and
+// compared with the UTC timestamps written by writeAudit.
+func (r *SQLiteRepository) GetAuditLog(ctx context.Context, filter domain.AuditFilter) (_ []domain.AuditEntry, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var conditions []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.Entity != "" {
+		add("entity = $%d", filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		add("entity_id = $%d", filter.EntityID)
+	}
+	if filter.From != "" {
+		from, err := time.ParseInLocation(dateutil.ISOLayout, filter.From, time.Local)
+		if err != nil {
+			return nil, invalidValue("")
+		}
+		add("created_at >= $%d", from.UTC())
+	}
+	if filter.To != "" {
+		to, err := time.ParseInLocation(dateutil.ISOLayout, filter.To, time.Local)
+		if err != nil {
+			return nil, invalidValue("")
+		}
+		add("created_at < $%d", to.AddDate(0, 0, 1).UTC())
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	query := "SELECT id, entity, entity_id, action, actor, COALESCE(request_id, ''), before, after, created_at FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d", limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []domain.AuditEntry{}
+	for rows.Next() {
+		var e domain.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.Entity, &e.EntityID, &e.Action, &e.Actor, &e.RequestID, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *SQLiteRepository) GetUserByUsername(ctx context.Context, username string) (_ *domain.User, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username=$1", username))
+}
+
+func (r *SQLiteRepository) GetUserByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1", id))
+}
+
+func (r *SQLiteRepository) CreateUser(ctx context.Context, user *domain.User) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	now := sqliteNow()
+	err = r.db.QueryRowContext(ctx,
+		"INSERT INTO users (username, password_hash, role, team_id, is_active, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $6) RETURNING id",
+		user.Username, user.PasswordHash, user.Role, user.TeamID, user.IsActive, now,
+	).Scan(&user.ID)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	user.CreatedAt, user.UpdatedAt = now, now
+	return nil
+}
+
+func (r *SQLiteRepository) ListUsers(ctx context.Context) (_ []domain.User, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+func (r *SQLiteRepository) UpdateUser(ctx context.Context, user *domain.User) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	user.UpdatedAt = sqliteNow()
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE users SET password_hash=$1, role=$2, team_id=$3, is_active=$4, updated_at=$5 WHERE id=$6",
+		user.PasswordHash, user.Role, user.TeamID, user.IsActive, user.UpdatedAt, user.ID,
+	)
+	return checkUpdated(res, mapSQLiteError(err))
+}
+
+func (r *SQLiteRepository) CountUsers(ctx context.Context) (_ int, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var count int
+	err = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+func (r *SQLiteRepository) SaveRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4)",
+		userID, tokenHash, expiresAt.UTC(), sqliteNow(),
+	)
+	return mapSQLiteError(err)
+}
+
+// ConsumeRefreshToken revokes the token in the same statement that checks
+// it. Both times are UTC, so expires_at compares correctly as text.
+func (r *SQLiteRepository) ConsumeRefreshToken(ctx context.Context, tokenHash string) (_ int, _ bool, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var userID int
+	err = r.db.QueryRowContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at=$1 WHERE token_hash=$2 AND revoked_at IS NULL AND expires_at > $1 RETURNING user_id",
+		sqliteNow(), tokenHash,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SQLite has neither ROLLUP nor generate_series, so the aggregates below are
+// summed in SQL and finished in Go with the helpers of MemoryRepository.
+
+// GetMarketingFunnel aggregates marketing data per source for the given range.
+func (r *SQLiteRepository) GetMarketingFunnel(ctx context.Context, filter domain.ReportFilter) (_ *domain.MarketingFunnel, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	f, err := newMemFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	joinConditions, args := dateFilter("d.", f.from, f.to, 1)
+	joinConditions = append([]string{"d.source_id = s.id", "d.deleted_at IS NULL"}, joinConditions...)
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		joinConditions = append(joinConditions, fmt.Sprintf("d.status = $%d", len(args)))
+	}
+
+	query := `
+		SELECT s.id, s.name,
+			COALESCE(SUM(d.expense), 0),
+			COALESCE(SUM(d.leads), 0),
+			COALESCE(SUM(d.trials_scheduled), 0),
+			COALESCE(SUM(d.trials_conducted), 0),
+			COALESCE(SUM(d.payments), 0),
+			COALESCE(SUM(d.total_amount), 0)
+		FROM marketing_sources s
+		LEFT JOIN marketing_data d ON ` + strings.Join(joinConditions, " AND ")
+
+	// Archived sources only show up for periods in which they have data
+	query += " WHERE (s.archived_at IS NULL OR d.id IS NOT NULL)"
+	if cond, idArgs := idFilter("s.id", filter.IDs, len(args)+1); cond != "" {
+		query += " AND " + cond
+		args = append(args, idArgs...)
+	}
+	query += " GROUP BY s.id, s.name ORDER BY s.id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	funnel := &domain.MarketingFunnel{From: filter.From, To: filter.To, Sources: []domain.MarketingFunnelMetrics{}}
+	for rows.Next() {
+		var sum, m domain.MarketingFunnelMetrics
+		if err := rows.Scan(&m.SourceID, &m.SourceName, &sum.Expense, &sum.Leads, &sum.TrialsScheduled, &sum.TrialsConducted, &sum.Payments, &sum.TotalAmount); err != nil {
+			return nil, err
+		}
+		// Adding to zero rounds the floating point sums to cents
+		addFunnel(&m, sum)
+		addFunnel(&funnel.Total, m)
+		setFunnelKPIs(&m)
+		funnel.Sources = append(funnel.Sources, m)
+	}
+	setFunnelKPIs(&funnel.Total)
+	return funnel, rows.Err()
+}
+
+func (r *SQLiteRepository) GetMarketingSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) (_ []domain.MarketingSummary, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	if _, ok := bucketIntervals[groupBy]; !ok {
+		return nil, fmt.Errorf("unsupported group_by %q", groupBy)
+	}
+	f, err := newMemFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args := dataFilter("", "source_id", domain.ReportFilter{From: f.from, To: f.to, IDs: filter.IDs, Status: filter.Status})
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT date, source_id, SUM(expense), SUM(leads), SUM(trials_scheduled), SUM(trials_conducted), SUM(payments), SUM(total_amount) FROM marketing_data"+
+			" WHERE "+strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+" GROUP BY date, source_id",
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := map[memKey]*domain.MarketingSummary{}
+	inData := map[int]bool{}
+	var dates []string
+	for rows.Next() {
+		var date string
+		var d domain.MarketingSummary
+		if err := rows.Scan(&date, &d.SourceID, &d.Expense, &d.Leads, &d.TrialsScheduled, &d.TrialsConducted, &d.Payments, &d.TotalAmount); err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+		inData[d.SourceID] = true
+
+		key := memKey{bucketOf(groupBy, date), d.SourceID}
+		sum := sums[key]
+		if sum == nil {
+			sum = &domain.MarketingSummary{}
+			sums[key] = sum
+		}
+		sum.Expense = roundTo(sum.Expense+d.Expense, 2)
+		sum.Leads += d.Leads
+		sum.TrialsScheduled += d.TrialsScheduled
+		sum.TrialsConducted += d.TrialsConducted
+		sum.Payments += d.Payments
+		sum.TotalAmount = roundTo(sum.TotalAmount+d.TotalAmount, 2)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summaries := []domain.MarketingSummary{}
+	lo, hi, ok := memBounds(f, dates, groupBy)
+	if !ok {
+		return summaries, nil
+	}
+
+	sources, err := r.GetMarketingSources(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	var dims []int
+	for _, s := range sources {
+		if (s.ArchivedAt == nil || inData[s.ID]) && (f.ids == nil || f.ids[s.ID]) {
+			dims = append(dims, s.ID)
+		}
+	}
+	// Sources are listed in display order, summaries go by ID
+	slices.Sort(dims)
+
+	for _, period := range memBuckets(groupBy, lo, hi) {
+		for _, id := range dims {
+			row := domain.MarketingSummary{}
+			if sum := sums[memKey{period, id}]; sum != nil {
+				row = *sum
+			}
+			row.Period, row.SourceID = period, id
+			summaries = append(summaries, row)
+		}
+	}
+	return summaries, nil
+}
+
+func (r *SQLiteRepository) GetSalesSummary(ctx context.Context, filter domain.ReportFilter, groupBy string) (_ []domain.SalesSummary, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	if _, ok := bucketIntervals[groupBy]; !ok {
+		return nil, fmt.Errorf("unsupported group_by %q", groupBy)
+	}
+	f, err := newMemFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args := dataFilter("", "team_id", domain.ReportFilter{From: f.from, To: f.to, IDs: filter.IDs, Status: filter.Status})
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT date, team_id, SUM(leads), SUM(trials_scheduled), SUM(trials_conducted), SUM(payments), SUM(total_amount), SUM(kaspi_refund) FROM sales_data"+
+			" WHERE "+strings.Join(append(conditions, "deleted_at IS NULL"), " AND ")+" GROUP BY date, team_id",
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := map[memKey]*domain.SalesSummary{}
+	inData := map[int]bool{}
+	var dates []string
+	for rows.Next() {
+		var date string
+		var d domain.SalesSummary
+		if err := rows.Scan(&date, &d.TeamID, &d.Leads, &d.TrialsScheduled, &d.TrialsConducted, &d.Payments, &d.TotalAmount, &d.KaspiRefund); err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+		inData[d.TeamID] = true
+
+		key := memKey{bucketOf(groupBy, date), d.TeamID}
+		sum := sums[key]
+		if sum == nil {
+			sum = &domain.SalesSummary{}
+			sums[key] = sum
+		}
+		sum.Leads += d.Leads
+		sum.TrialsScheduled += d.TrialsScheduled
+		sum.TrialsConducted += d.TrialsConducted
+		sum.Payments += d.Payments
+		sum.TotalAmount = roundTo(sum.TotalAmount+d.TotalAmount, 2)
+		sum.KaspiRefund = roundTo(sum.KaspiRefund+d.KaspiRefund, 2)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summaries := []domain.SalesSummary{}
+	lo, hi, ok := memBounds(f, dates, groupBy)
+	if !ok {
+		return summaries, nil
+	}
+
+	// Teams active at any point of the range, or with data in it
+	from, to := lo.Format(dateutil.ISOLayout), hi.Format(dateutil.ISOLayout)
+	teams, err := r.GetSalesTeams(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+	var dims []int
+	for _, t := range teams {
+		if (teamActive(t, from, to) || inData[t.ID]) && (f.ids == nil || f.ids[t.ID]) {
+			dims = append(dims, t.ID)
+		}
+	}
+
+	for _, period := range memBuckets(groupBy, lo, hi) {
+		for _, id := range dims {
+			row := domain.SalesSummary{}
+			if sum := sums[memKey{period, id}]; sum != nil {
+				row = *sum
+			}
+			row.Period, row.TeamID = period, id
+			summaries = append(summaries, row)
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ChangeMarketingStatus applies a workflow action to the marketing rows of a
+// date. Either every matching row moves or none does.
+func (r *PostgresRepository) ChangeMarketingStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) (_ []domain.MarketingData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var changed []domain.MarketingData
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		changed, err = changeMarketingStatus(ctx, tx, postgresOps, change, meta)
+		return err
+	})
+	return changed, err
+}
+
+func changeMarketingStatus(ctx context.Context, tx *sql.Tx, ops txOps, change domain.StatusChange, meta domain.AuditMeta) ([]domain.MarketingData, error) {
+	if err := ops.checkPeriodOpen(ctx, tx, change.Date); err != nil {
+		return nil, err
+	}
+
+	where, args := statusRowsFilter("source_id", change)
+	rows, err := queryMarketingRows(ctx, tx, where+" ORDER BY source_id"+ops.forUpdate, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+
+	for i := range rows {
+		before := rows[i]
+		if err := setStatus(ctx, tx, ops, "marketing_data", before.ID, before.Status, change, meta); err != nil {
+			return nil, err
+		}
+		if err := auditMarketingChange(ctx, tx, meta, domain.AuditActionStatus, before.ID, &before); err != nil {
+			return nil, err
+		}
+	}
+
+	return queryMarketingRows(ctx, tx, where+" ORDER BY source_id", args...)
+}
+
+// ChangeSalesStatus is the sales counterpart of ChangeMarketingStatus.
+func (r *PostgresRepository) ChangeSalesStatus(ctx context.Context, change domain.StatusChange, meta domain.AuditMeta) (_ []domain.SalesData, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var changed []domain.SalesData
+	err = r.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		changed, err = changeSalesStatus(ctx, tx, postgresOps, change, meta)
+		return err
+	})
+	return changed, err
+}
+
+func changeSalesStatus(ctx context.Context, tx *sql.Tx, ops txOps, change domain.StatusChange, meta domain.AuditMeta) ([]domain.SalesData, error) {
+	if err := ops.checkPeriodOpen(ctx, tx, change.Date); err != nil {
+		return nil, err
+	}
+
+	where, args := statusRowsFilter("team_id", change)
+	rows, err := querySalesRows(ctx, tx, where+" ORDER BY team_id"+ops.forUpdate, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+
+	for i := range rows {
+		before := rows[i]
+		if err := setStatus(ctx, tx, ops, "sales_data", before.ID, before.Status, change, meta); err != nil {
+			return nil, err
+		}
+		if err := auditSalesChange(ctx, tx, meta, domain.AuditActionStatus, before.ID, &before); err != nil {
+			return nil, err
+		}
+	}
+
+	return querySalesRows(ctx, tx, where+" ORDER BY team_id", args...)
+}
+
+func statusRowsFilter(idColumn string, change domain.StatusChange) (string, []interface{}) {
+	where := "date=$1 AND deleted_at IS NULL"
+	args := []interface{}{change.Date}
+	if len(change.IDs) > 0 {
+		placeholders := make([]string, len(change.IDs))
+		for i, id := range change.IDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		where += " AND " + idColumn + " IN (" + strings.Join(placeholders, ",") + ")"
+	}
+	return where, args
+}
+
+func setStatus(ctx context.Context, q queryer, ops txOps, table string, id int, current string, change domain.StatusChange, meta domain.AuditMeta) error {
+	next, ok := domain.NextStatus(current, change.Action)
+	if !ok {
+		return &StatusError{ID: id, Status: current, Action: change.Action}
+	}
+
+	_, err := q.ExecContext(ctx,
+		"UPDATE "+table+" SET status=$1, status_comment=NULLIF($2, ''), status_changed_by=$3, status_changed_at=$4, version=version+1 WHERE id=$5",
+		next, change.Comment, actorOrSystem(meta), ops.now(), id,
+	)
+	return err
+}
+
+func queryMarketingRows(ctx context.Context, q queryer, where string, args ...interface{}) ([]domain.MarketingData, error) {
+	var data []domain.MarketingData
+	err := eachMarketingRow(ctx, q, where, args, func(d domain.MarketingData) error {
+		data = append(data, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// eachMarketingRow calls fn for every row as it is read. An error from fn
+// stops the query and is returned.
+func eachMarketingRow(ctx context.Context, q queryer, where string, args []interface{}, fn func(domain.MarketingData) error) error {
+	rows, err := q.QueryContext(ctx, "SELECT "+marketingColumns+" FROM marketing_data WHERE "+where, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanMarketingData(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func querySalesRows(ctx context.Context, q queryer, where string, args ...interface{}) ([]domain.SalesData, error) {
+	var data []domain.SalesData
+	err := eachSalesRow(ctx, q, where, args, func(d domain.SalesData) error {
+		data = append(data, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func eachSalesRow(ctx context.Context, q queryer, where string, args []interface{}, fn func(domain.SalesData) error) error {
+	rows, err := q.QueryContext(ctx, "SELECT "+salesColumns+" FROM sales_data WHERE "+where, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanSalesData(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
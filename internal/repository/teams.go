@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GetSalesTeams lists teams whose activity period overlaps [from, to].
+// Empty bounds leave that side of the window open, so no bounds returns all teams.
+func (r *PostgresRepository) GetSalesTeams(ctx context.Context, from, to string) (_ []domain.SalesTeam, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	query := "SELECT id, name, to_char(active_from, 'YYYY-MM-DD'), to_char(active_to, 'YYYY-MM-DD'), created_at, updated_at FROM sales_teams"
+
+	var conditions []string
+	var args []interface{}
+	if to != "" {
+		args = append(args, to)
+		conditions = append(conditions, fmt.Sprintf("(active_from IS NULL OR active_from <= $%d)", len(args)))
+	}
+	if from != "" {
+		args = append(args, from)
+		conditions = append(conditions, fmt.Sprintf("(active_to IS NULL OR active_to >= $%d)", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []domain.SalesTeam
+	for rows.Next() {
+		var t domain.SalesTeam
+		if err := rows.Scan(&t.ID, &t.Name, &t.ActiveFrom, &t.ActiveTo, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, nil
+}
+
+func (r *PostgresRepository) CreateSalesTeam(ctx context.Context, team *domain.SalesTeam) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	now := time.Now()
+	err = r.db.QueryRowContext(ctx,
+		"INSERT INTO sales_teams (name, active_from, active_to, created_at, updated_at) VALUES ($1, $2, $3, $4, $4) RETURNING id",
+		team.Name, team.ActiveFrom, team.ActiveTo, now,
+	).Scan(&team.ID)
+	if err != nil {
+		return mapConstraintError(err)
+	}
+	team.CreatedAt, team.UpdatedAt = now, now
+	return nil
+}
+
+// UpdateSalesTeam renames a team and replaces its activity period.
+func (r *PostgresRepository) UpdateSalesTeam(ctx context.Context, team *domain.SalesTeam) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	team.UpdatedAt = time.Now()
+	err = r.db.QueryRowContext(ctx,
+		"UPDATE sales_teams SET name=$1, active_from=$2, active_to=$3, updated_at=$4 WHERE id=$5 RETURNING created_at",
+		team.Name, team.ActiveFrom, team.ActiveTo, team.UpdatedAt, team.ID,
+	).Scan(&team.CreatedAt)
+	return mapNoRows(mapConstraintError(err))
+}
+
+// DeleteSalesTeam removes a team that was never used. Teams with sales data
+// should be closed by setting active_to instead.
+func (r *PostgresRepository) DeleteSalesTeam(ctx context.Context, id int) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var inUse bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM sales_data WHERE team_id=$1)", id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return &ConflictError{Constraint: "sales_data_team_id_fkey", Message: "team has sales data, set active_to instead"}
+	}
+
+	res, err := r.db.ExecContext(ctx, "DELETE FROM sales_teams WHERE id=$1", id)
+	return checkUpdated(res, mapConstraintError(err))
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"database/sql"
+	"time"
+)
+
+const userColumns = "id, username, password_hash, role, team_id, is_active, created_at, updated_at"
+
+func scanUser(s rowScanner) (*domain.User, error) {
+	var u domain.User
+	err := s.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.TeamID, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUserByUsername returns nil when there is no such user.
+func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (_ *domain.User, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username=$1", username))
+}
+
+func (r *PostgresRepository) GetUserByID(ctx context.Context, id int) (_ *domain.User, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1", id))
+}
+
+func (r *PostgresRepository) CreateUser(ctx context.Context, user *domain.User) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	now := time.Now()
+	err = r.db.QueryRowContext(ctx,
+		"INSERT INTO users (username, password_hash, role, team_id, is_active, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $6) RETURNING id",
+		user.Username, user.PasswordHash, user.Role, user.TeamID, user.IsActive, now,
+	).Scan(&user.ID)
+	if err != nil {
+		return mapConstraintError(err)
+	}
+	user.CreatedAt, user.UpdatedAt = now, now
+	return nil
+}
+
+func (r *PostgresRepository) ListUsers(ctx context.Context) (_ []domain.User, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+// UpdateUser saves role, team, active flag and password hash of an existing user.
+func (r *PostgresRepository) UpdateUser(ctx context.Context, user *domain.User) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	user.UpdatedAt = time.Now()
+	res, err := r.db.ExecContext(ctx,
+		"UPDATE users SET password_hash=$1, role=$2, team_id=$3, is_active=$4, updated_at=$5 WHERE id=$6",
+		user.PasswordHash, user.Role, user.TeamID, user.IsActive, user.UpdatedAt, user.ID,
+	)
+	return checkUpdated(res, mapConstraintError(err))
+}
+
+func (r *PostgresRepository) CountUsers(ctx context.Context) (_ int, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var count int
+	err = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+func (r *PostgresRepository) SaveRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) (err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4)",
+		userID, tokenHash, expiresAt, time.Now(),
+	)
+	return err
+}
+
+// ConsumeRefreshToken revokes the token in the same statement that checks it,
+// so a token can never be used twice.
+func (r *PostgresRepository) ConsumeRefreshToken(ctx context.Context, tokenHash string) (_ int, _ bool, err error) {
+	ctx, done := r.begin(ctx)
+	defer done(&err)
+
+	var userID int
+	err = r.db.QueryRowContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at=$1 WHERE token_hash=$2 AND revoked_at IS NULL AND expires_at > $1 RETURNING user_id",
+		time.Now(), tokenHash,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
@@ -0,0 +1,279 @@
+// Package seed adds the reference data a new database needs and, for demos,
+// sample reports. Seeding is idempotent: whatever already exists, matched by
+// name or by date and source/team, is left untouched, so a profile can be
+// applied to a live database any number of times.
+package seed
+
+import (
+	"bake_backend/internal/domain"
+	dateutil "bake_backend/pkg"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Profiles accepted by Run.
+const (
+	// ProfileProd adds the marketing sources and sales teams.
+	ProfileProd = "prod"
+	// ProfileDemo adds what prod does and DemoDays of draft reports for
+	// every active source and team.
+	ProfileDemo = "demo"
+)
+
+// DemoDays is how many days, up to yesterday, the demo profile fills.
+const DemoDays = 30
+
+var (
+	referenceSources = []string{"Facebook-1", "Facebook-2", "Facebook-3", "Facebook-4", "Facebook-5", "Facebook-6", "Instagram", "TikTok", "Другие источники"}
+	referenceTeams   = []string{"Команда Нұрғиса", "Команда Даниял", "Команда Дамир", "Команда Абылай", "Команда Тоғжан", "Команда Айша Тараз"}
+)
+
+// demoMeta is recorded in the audit log for sample reports.
+var demoMeta = domain.AuditMeta{Actor: "seed"}
+
+// Store is what seeding needs from a repository.
+type Store interface {
+	GetMarketingSources(ctx context.Context, includeArchived bool) ([]domain.MarketingSource, error)
+	CreateMarketingSource(ctx context.Context, source *domain.MarketingSource) error
+	GetSalesTeams(ctx context.Context, from, to string) ([]domain.SalesTeam, error)
+	CreateSalesTeam(ctx context.Context, team *domain.SalesTeam) error
+	GetMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error)
+	GetSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error)
+	GetDeletedMarketingData(ctx context.Context, filter domain.ReportFilter) ([]domain.MarketingData, error)
+	GetDeletedSalesData(ctx context.Context, filter domain.ReportFilter) ([]domain.SalesData, error)
+	SaveMarketingData(ctx context.Context, data *domain.MarketingData, meta domain.AuditMeta) (bool, error)
+	SaveSalesData(ctx context.Context, data *domain.SalesData, meta domain.AuditMeta) (bool, error)
+}
+
+// Result counts the rows a run added.
+type Result struct {
+	Sources   int
+	Teams     int
+	Marketing int
+	Sales     int
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%d sources, %d teams, %d marketing and %d sales reports added", r.Sources, r.Teams, r.Marketing, r.Sales)
+}
+
+func IsValidProfile(profile string) bool {
+	return profile == ProfileProd || profile == ProfileDemo
+}
+
+// Run applies profile to store.
+func Run(ctx context.Context, store Store, profile string) (Result, error) {
+	var res Result
+	if !IsValidProfile(profile) {
+		return res, fmt.Errorf("unknown seed profile %q, expected prod or demo", profile)
+	}
+
+	if err := seedReference(ctx, store, &res); err != nil {
+		return res, err
+	}
+	if profile == ProfileDemo {
+		if err := seedReports(ctx, store, time.Now(), &res); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// seedReference adds the sources and teams missing by name. Archived sources
+// count as present, they were retired on purpose.
+func seedReference(ctx context.Context, store Store, res *Result) error {
+	existingSources, err := store.GetMarketingSources(ctx, true)
+	if err != nil {
+		return err
+	}
+	haveSource := map[string]bool{}
+	for _, s := range existingSources {
+		haveSource[s.Name] = true
+	}
+	for _, name := range referenceSources {
+		if haveSource[name] {
+			continue
+		}
+		if err := store.CreateMarketingSource(ctx, &domain.MarketingSource{Name: name}); err != nil {
+			return fmt.Errorf("source %q: %w", name, err)
+		}
+		res.Sources++
+	}
+
+	existingTeams, err := store.GetSalesTeams(ctx, "", "")
+	if err != nil {
+		return err
+	}
+	haveTeam := map[string]bool{}
+	for _, t := range existingTeams {
+		haveTeam[t.Name] = true
+	}
+	for _, name := range referenceTeams {
+		if haveTeam[name] {
+			continue
+		}
+		if err := store.CreateSalesTeam(ctx, &domain.SalesTeam{Name: name}); err != nil {
+			return fmt.Errorf("team %q: %w", name, err)
+		}
+		res.Teams++
+	}
+	return nil
+}
+
+// reportKey identifies a report by date (YYYY-MM-DD) and source or team.
+type reportKey struct {
+	date string
+	id   int
+}
+
+// seedReports fills the DemoDays before now with draft reports. Days that
+// already have a report for a source or team, deleted ones included, keep it.
+func seedReports(ctx context.Context, store Store, now time.Time, res *Result) error {
+	to := now.AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, 1-DemoDays)
+	filter := domain.ReportFilter{From: from.Format(dateutil.ISOLayout), To: to.Format(dateutil.ISOLayout)}
+
+	haveMarketing, haveSales, err := existingReports(ctx, store, filter)
+	if err != nil {
+		return err
+	}
+	sources, err := store.GetMarketingSources(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateutil.ISOLayout)
+		for _, s := range sources {
+			if haveMarketing[reportKey{date, s.ID}] {
+				continue
+			}
+			row := demoMarketing(date, s.ID)
+			if _, err := store.SaveMarketingData(ctx, &row, demoMeta); err != nil {
+				return fmt.Errorf("marketing report %s/%d: %w", date, s.ID, err)
+			}
+			res.Marketing++
+		}
+
+		teams, err := store.GetSalesTeams(ctx, date, date)
+		if err != nil {
+			return err
+		}
+		for _, t := range teams {
+			if haveSales[reportKey{date, t.ID}] {
+				continue
+			}
+			row := demoSales(date, t.ID)
+			if _, err := store.SaveSalesData(ctx, &row, demoMeta); err != nil {
+				return fmt.Errorf("sales report %s/%d: %w", date, t.ID, err)
+			}
+			res.Sales++
+		}
+	}
+	return nil
+}
+
+func existingReports(ctx context.Context, store Store, filter domain.ReportFilter) (marketing, sales map[reportKey]bool, err error) {
+	marketing, sales = map[reportKey]bool{}, map[reportKey]bool{}
+
+	live, err := store.GetMarketingData(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	deleted, err := store.GetDeletedMarketingData(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range append(live, deleted...) {
+		key, err := keyOf(d.Date, d.SourceID)
+		if err != nil {
+			return nil, nil, err
+		}
+		marketing[key] = true
+	}
+
+	liveSales, err := store.GetSalesData(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	deletedSales, err := store.GetDeletedSalesData(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range append(liveSales, deletedSales...) {
+		key, err := keyOf(d.Date, d.TeamID)
+		if err != nil {
+			return nil, nil, err
+		}
+		sales[key] = true
+	}
+	return marketing, sales, nil
+}
+
+// keyOf normalizes the date, which comes back as a timestamp from some drivers.
+func keyOf(date string, id int) (reportKey, error) {
+	t, err := dateutil.ParseDate(date)
+	if err != nil {
+		return reportKey{}, fmt.Errorf("existing report: %w", err)
+	}
+	return reportKey{t.Format(dateutil.ISOLayout), id}, nil
+}
+
+// demoRand is seeded from the report's key, so every run produces the same
+// figures for it.
+func demoRand(kind, date string, id int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s/%d", kind, date, id)
+	return rand.New(rand.NewPCG(h.Sum64(), 0))
+}
+
+// share returns a fraction between lo and hi percent of n.
+func share(r *rand.Rand, n, lo, hi int) int {
+	return n * (lo + r.IntN(hi-lo+1)) / 100
+}
+
+func demoMarketing(date string, sourceID int) domain.MarketingData {
+	r := demoRand("marketing", date, sourceID)
+	expense := math.Round(20000 + r.Float64()*80000)
+	leads := int(expense) / (800 + r.IntN(700))
+	scheduled := share(r, leads, 40, 70)
+	conducted := share(r, scheduled, 60, 90)
+	payments := share(r, conducted, 20, 50)
+	return domain.MarketingData{
+		Date:            date,
+		SourceID:        sourceID,
+		Expense:         expense,
+		Leads:           leads,
+		TrialsScheduled: scheduled,
+		TrialsConducted: conducted,
+		Payments:        payments,
+		TotalAmount:     float64(payments * (35 + r.IntN(26)) * 1000),
+	}
+}
+
+func demoSales(date string, teamID int) domain.SalesData {
+	r := demoRand("sales", date, teamID)
+	leads := 10 + r.IntN(51)
+	scheduled := share(r, leads, 40, 70)
+	conducted := share(r, scheduled, 60, 90)
+	payments := share(r, conducted, 20, 50)
+	total := float64(payments * (35 + r.IntN(26)) * 1000)
+	var refund float64
+	if r.IntN(5) == 0 {
+		refund = math.Round(total * r.Float64() / 10)
+	}
+	return domain.SalesData{
+		Date:            date,
+		TeamID:          teamID,
+		Leads:           leads,
+		TrialsScheduled: scheduled,
+		TrialsConducted: conducted,
+		Payments:        payments,
+		TotalAmount:     total,
+		KaspiRefund:     refund,
+	}
+}
@@ -0,0 +1,247 @@
+// Package validation checks report rows before they reach the database.
+//
+// Hard problems (malformed dates, negative values, unknown sources or teams)
+// always reject a row. Soft problems (future dates, funnel inversions such as
+// more payments than conducted trials, teams outside their active period) are
+// rejected in strict mode and only reported as warnings in warn mode, for
+// teams whose numbers legitimately carry over between days.
+package validation
+
+import (
+	"bake_backend/internal/domain"
+	"bake_backend/internal/repository"
+	dateutil "bake_backend/pkg"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	ModeStrict = "strict"
+	ModeWarn   = "warn"
+)
+
+func IsValidMode(mode string) bool {
+	return mode == ModeStrict || mode == ModeWarn
+}
+
+// Problem codes reported in domain.FieldError.Code.
+const (
+	CodeRequired        = "required"
+	CodeInvalid         = "invalid"
+	CodeNegative        = "negative"
+	CodeUnknown         = "unknown"
+	CodeFutureDate      = "future_date"
+	CodeFunnelInversion = "funnel_inversion"
+	CodeInactive        = "inactive"
+)
+
+// Summary joins the messages of problems into one line.
+func Summary(problems []domain.FieldError) string {
+	messages := make([]string, len(problems))
+	for i, p := range problems {
+		messages[i] = p.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Result holds the problems found in a row. Only Errors block the write.
+type Result struct {
+	Errors   []domain.FieldError
+	Warnings []domain.FieldError
+}
+
+// Err returns the errors as a *repository.ValidationError, or nil when there
+// are none.
+func (r Result) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return &repository.ValidationError{Fields: r.Errors}
+}
+
+// Lookup resolves the sources and teams rows refer to.
+type Lookup interface {
+	GetMarketingSources(ctx context.Context, includeArchived bool) ([]domain.MarketingSource, error)
+	GetSalesTeams(ctx context.Context, from, to string) ([]domain.SalesTeam, error)
+}
+
+// Validator checks rows against the configured mode. Sources and teams are
+// loaded once per validator, so a single one should be used for a whole
+// batch or import and then dropped.
+type Validator struct {
+	mode   string
+	lookup Lookup
+	loc    *time.Location
+	now    func() time.Time
+
+	sources map[int]domain.MarketingSource
+	teams   map[int]domain.SalesTeam
+}
+
+// New returns a validator for mode. Dates are compared with today in loc,
+// the business time zone, not in the server's.
+func New(mode string, loc *time.Location, lookup Lookup) *Validator {
+	return &Validator{mode: mode, lookup: lookup, loc: loc, now: time.Now}
+}
+
+// Marketing validates d and normalizes its date to YYYY-MM-DD.
+func (v *Validator) Marketing(ctx context.Context, d *domain.MarketingData) (Result, error) {
+	var res Result
+	v.checkDate(&res, &d.Date)
+
+	if d.SourceID <= 0 {
+		res.Errors = append(res.Errors, problem("source_id", CodeRequired, "source_id is required"))
+	} else {
+		if err := v.loadSources(ctx); err != nil {
+			return res, err
+		}
+		if _, ok := v.sources[d.SourceID]; !ok {
+			res.Errors = append(res.Errors, problem("source_id", CodeUnknown, "unknown source_id %d", d.SourceID))
+		}
+	}
+
+	checkAmount(&res, "expense", d.Expense)
+	checkAmount(&res, "total_amount", d.TotalAmount)
+	v.checkFunnel(&res, d.Leads, d.TrialsScheduled, d.TrialsConducted, d.Payments)
+	return res, nil
+}
+
+// Sales validates d and normalizes its date to YYYY-MM-DD.
+func (v *Validator) Sales(ctx context.Context, d *domain.SalesData) (Result, error) {
+	var res Result
+	dateOK := v.checkDate(&res, &d.Date)
+
+	if d.TeamID <= 0 {
+		res.Errors = append(res.Errors, problem("team_id", CodeRequired, "team_id is required"))
+	} else {
+		if err := v.loadTeams(ctx); err != nil {
+			return res, err
+		}
+		team, ok := v.teams[d.TeamID]
+		switch {
+		case !ok:
+			res.Errors = append(res.Errors, problem("team_id", CodeUnknown, "unknown team_id %d", d.TeamID))
+		case dateOK && !teamActive(team, d.Date):
+			v.soft(&res, problem("team_id", CodeInactive, "team %s is not active on %s", team.Name, d.Date))
+		}
+	}
+
+	checkAmount(&res, "total_amount", d.TotalAmount)
+	checkAmount(&res, "kaspi_refund", d.KaspiRefund)
+	v.checkFunnel(&res, d.Leads, d.TrialsScheduled, d.TrialsConducted, d.Payments)
+	return res, nil
+}
+
+// checkDate reports a missing, malformed or future date and reports whether
+// the date could be parsed.
+func (v *Validator) checkDate(res *Result, date *string) bool {
+	if strings.TrimSpace(*date) == "" {
+		res.Errors = append(res.Errors, problem("date", CodeRequired, "date is required"))
+		return false
+	}
+	t, err := dateutil.ParseDate(*date)
+	if err != nil {
+		res.Errors = append(res.Errors, problem("date", CodeInvalid, "invalid date %q, expected YYYY-MM-DD", *date))
+		return false
+	}
+	*date = t.Format(dateutil.ISOLayout)
+
+	if today := v.now().In(v.loc).Format(dateutil.ISOLayout); *date > today {
+		v.soft(res, problem("date", CodeFutureDate, "date %s is in the future", *date))
+	}
+	return true
+}
+
+// checkFunnel rejects negative counts and flags stages exceeding the
+// previous one: leads ≥ trials_scheduled ≥ trials_conducted ≥ payments.
+func (v *Validator) checkFunnel(res *Result, leads, scheduled, conducted, payments int) {
+	stages := []struct {
+		field string
+		value int
+	}{
+		{"leads", leads},
+		{"trials_scheduled", scheduled},
+		{"trials_conducted", conducted},
+		{"payments", payments},
+	}
+
+	for _, s := range stages {
+		if s.value < 0 {
+			res.Errors = append(res.Errors, problem(s.field, CodeNegative, "%s must not be negative", s.field))
+		}
+	}
+	for i := 1; i < len(stages); i++ {
+		prev, cur := stages[i-1], stages[i]
+		if prev.value >= 0 && cur.value > prev.value {
+			v.soft(res, problem(cur.field, CodeFunnelInversion, "%s (%d) exceed %s (%d)", cur.field, cur.value, prev.field, prev.value))
+		}
+	}
+}
+
+// soft records a problem that only blocks the write in strict mode.
+func (v *Validator) soft(res *Result, p domain.FieldError) {
+	if v.mode == ModeWarn {
+		res.Warnings = append(res.Warnings, p)
+		return
+	}
+	res.Errors = append(res.Errors, p)
+}
+
+func (v *Validator) loadSources(ctx context.Context) error {
+	if v.sources != nil {
+		return nil
+	}
+	sources, err := v.lookup.GetMarketingSources(ctx, true)
+	if err != nil {
+		return err
+	}
+	v.sources = make(map[int]domain.MarketingSource, len(sources))
+	for _, s := range sources {
+		v.sources[s.ID] = s
+	}
+	return nil
+}
+
+func (v *Validator) loadTeams(ctx context.Context) error {
+	if v.teams != nil {
+		return nil
+	}
+	teams, err := v.lookup.GetSalesTeams(ctx, "", "")
+	if err != nil {
+		return err
+	}
+	v.teams = make(map[int]domain.SalesTeam, len(teams))
+	for _, t := range teams {
+		v.teams[t.ID] = t
+	}
+	return nil
+}
+
+// teamActive compares YYYY-MM-DD strings, which sort chronologically.
+func teamActive(team domain.SalesTeam, date string) bool {
+	if team.ActiveFrom != nil && date < *team.ActiveFrom {
+		return false
+	}
+	if team.ActiveTo != nil && date > *team.ActiveTo {
+		return false
+	}
+	return true
+}
+
+// checkAmount rejects negative amounts and NaN or infinities, which the
+// database may store but JSON cannot carry back.
+func checkAmount(res *Result, field string, value float64) {
+	switch {
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		res.Errors = append(res.Errors, problem(field, CodeInvalid, "%s must be a finite number", field))
+	case value < 0:
+		res.Errors = append(res.Errors, problem(field, CodeNegative, "%s must not be negative", field))
+	}
+}
+
+func problem(field, code, format string, args ...interface{}) domain.FieldError {
+	return domain.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,176 @@
+package validation
+
+import (
+	"bake_backend/internal/domain"
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+type stubLookup struct{}
+
+func (stubLookup) GetMarketingSources(ctx context.Context, includeArchived bool) ([]domain.MarketingSource, error) {
+	return []domain.MarketingSource{{ID: 1, Name: "Facebook-1"}}, nil
+}
+
+func (stubLookup) GetSalesTeams(ctx context.Context, from, to string) ([]domain.SalesTeam, error) {
+	from1, to1 := "2026-01-01", "2026-01-31"
+	return []domain.SalesTeam{
+		{ID: 1, Name: "Team 1"},
+		{ID: 2, Name: "Team 2", ActiveFrom: &from1, ActiveTo: &to1},
+	}, nil
+}
+
+// newValidator returns a validator whose clock reads now; dates are checked
+// in Asia/Almaty, UTC+5.
+func newValidator(t *testing.T, mode string, now time.Time) *Validator {
+	t.Helper()
+	loc, err := time.LoadLocation("Asia/Almaty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := New(mode, loc, stubLookup{})
+	v.now = func() time.Time { return now }
+	return v
+}
+
+// codes lists the field and code of every problem, in order.
+func codes(problems []domain.FieldError) []string {
+	var out []string
+	for _, p := range problems {
+		out = append(out, p.Field+":"+p.Code)
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMarketing(t *testing.T) {
+	// 20:00 UTC is already the next day in Almaty
+	now := time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+	valid := func() domain.MarketingData {
+		return domain.MarketingData{Date: "2026-03-10", SourceID: 1, Expense: 100, Leads: 10, TrialsScheduled: 5, TrialsConducted: 3, Payments: 1, TotalAmount: 5000}
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		change   func(d *domain.MarketingData)
+		errors   []string
+		warnings []string
+	}{
+		{name: "valid", mode: ModeStrict, change: func(d *domain.MarketingData) {}},
+		{name: "missing date", mode: ModeStrict, change: func(d *domain.MarketingData) { d.Date = "" }, errors: []string{"date:required"}},
+		{name: "malformed date", mode: ModeStrict, change: func(d *domain.MarketingData) { d.Date = "2026-13-40" }, errors: []string{"date:invalid"}},
+		{name: "today in the business time zone", mode: ModeStrict, change: func(d *domain.MarketingData) { d.Date = "2026-03-11" }},
+		{name: "future date", mode: ModeStrict, change: func(d *domain.MarketingData) { d.Date = "2026-03-12" }, errors: []string{"date:future_date"}},
+		{name: "future date in warn mode", mode: ModeWarn, change: func(d *domain.MarketingData) { d.Date = "2026-03-12" }, warnings: []string{"date:future_date"}},
+		{name: "missing source", mode: ModeStrict, change: func(d *domain.MarketingData) { d.SourceID = 0 }, errors: []string{"source_id:required"}},
+		{name: "unknown source", mode: ModeStrict, change: func(d *domain.MarketingData) { d.SourceID = 7 }, errors: []string{"source_id:unknown"}},
+		{name: "negative expense", mode: ModeWarn, change: func(d *domain.MarketingData) { d.Expense = -1 }, errors: []string{"expense:negative"}},
+		{name: "NaN expense", mode: ModeWarn, change: func(d *domain.MarketingData) { d.Expense = math.NaN() }, errors: []string{"expense:invalid"}},
+		{name: "infinite amount", mode: ModeWarn, change: func(d *domain.MarketingData) { d.TotalAmount = math.Inf(1) }, errors: []string{"total_amount:invalid"}},
+		{name: "negative count", mode: ModeWarn, change: func(d *domain.MarketingData) { d.Payments = -1 }, errors: []string{"payments:negative"}},
+		{
+			name:   "funnel inversion",
+			mode:   ModeStrict,
+			change: func(d *domain.MarketingData) { d.TrialsConducted = 6 },
+			errors: []string{"trials_conducted:funnel_inversion"},
+		},
+		{
+			name:     "funnel inversion in warn mode",
+			mode:     ModeWarn,
+			change:   func(d *domain.MarketingData) { d.Leads = 2 },
+			warnings: []string{"trials_scheduled:funnel_inversion"},
+		},
+		{
+			// A negative stage is reported once, not again as an inversion
+			name:   "negative stage",
+			mode:   ModeStrict,
+			change: func(d *domain.MarketingData) { d.TrialsScheduled = -1 },
+			errors: []string{"trials_scheduled:negative"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := valid()
+			tt.change(&d)
+			res, err := newValidator(t, tt.mode, now).Marketing(context.Background(), &d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := codes(res.Errors); !equal(got, tt.errors) {
+				t.Errorf("errors %v, want %v", got, tt.errors)
+			}
+			if got := codes(res.Warnings); !equal(got, tt.warnings) {
+				t.Errorf("warnings %v, want %v", got, tt.warnings)
+			}
+			if (res.Err() == nil) != (len(tt.errors) == 0) {
+				t.Errorf("Err() = %v with errors %v", res.Err(), tt.errors)
+			}
+		})
+	}
+}
+
+func TestSales(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mode     string
+		data     domain.SalesData
+		errors   []string
+		warnings []string
+	}{
+		{name: "valid", mode: ModeStrict, data: domain.SalesData{Date: "2026-03-01", TeamID: 1, Leads: 5, Payments: 0}},
+		{name: "missing team", mode: ModeStrict, data: domain.SalesData{Date: "2026-03-01"}, errors: []string{"team_id:required"}},
+		{name: "unknown team", mode: ModeStrict, data: domain.SalesData{Date: "2026-03-01", TeamID: 9}, errors: []string{"team_id:unknown"}},
+		{name: "inactive team", mode: ModeStrict, data: domain.SalesData{Date: "2026-03-01", TeamID: 2}, errors: []string{"team_id:inactive"}},
+		{name: "inactive team in warn mode", mode: ModeWarn, data: domain.SalesData{Date: "2026-03-01", TeamID: 2}, warnings: []string{"team_id:inactive"}},
+		{name: "active team", mode: ModeStrict, data: domain.SalesData{Date: "2026-01-31", TeamID: 2}},
+		{name: "negative refund", mode: ModeStrict, data: domain.SalesData{Date: "2026-03-01", TeamID: 1, KaspiRefund: -3}, errors: []string{"kaspi_refund:negative"}},
+		{name: "infinite refund", mode: ModeStrict, data: domain.SalesData{Date: "2026-03-01", TeamID: 1, KaspiRefund: math.Inf(-1)}, errors: []string{"kaspi_refund:invalid"}},
+		{
+			name:     "payments carried over",
+			mode:     ModeWarn,
+			data:     domain.SalesData{Date: "2026-03-01", TeamID: 1, Leads: 2, TrialsScheduled: 2, TrialsConducted: 1, Payments: 3},
+			warnings: []string{"payments:funnel_inversion"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.data
+			res, err := newValidator(t, tt.mode, now).Sales(context.Background(), &d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := codes(res.Errors); !equal(got, tt.errors) {
+				t.Errorf("errors %v, want %v", got, tt.errors)
+			}
+			if got := codes(res.Warnings); !equal(got, tt.warnings) {
+				t.Errorf("warnings %v, want %v", got, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestDateIsNormalized(t *testing.T) {
+	d := domain.MarketingData{Date: "05.03.2026", SourceID: 1}
+	res, err := newValidator(t, ModeStrict, time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)).Marketing(context.Background(), &d)
+	if err != nil || res.Err() != nil {
+		t.Fatalf("%v %v", err, res.Err())
+	}
+	if d.Date != "2026-03-05" {
+		t.Errorf("date %q, want 2026-03-05", d.Date)
+	}
+}
@@ -1,9 +1,5 @@
 -- +goose Up
--- Drop existing tables to recreate with new structure
-DROP TABLE IF EXISTS sales_data;
-DROP TABLE IF EXISTS marketing_data;
-DROP TABLE IF EXISTS report_dates;
-
+-- Sources and teams are reference data, "api seed" adds them
 CREATE TABLE marketing_sources (
                                    id SERIAL PRIMARY KEY,
                                    name VARCHAR(50) NOT NULL UNIQUE,
@@ -50,14 +46,6 @@ CREATE TABLE sales_data (
                             UNIQUE (date, team_id)
 );
 
--- Initial data for sources and teams
-INSERT INTO marketing_sources (name) VALUES
-                                         ('Facebook-1'), ('Facebook-2'), ('Facebook-3'), ('Facebook-4'), ('Facebook-5'), ('Facebook-6'),
-                                         ('Instagram'), ('TikTok'), ('Другие источники');
-
-INSERT INTO sales_teams (name) VALUES
-                                   ('Команда Нұрғиса'), ('Команда Даниял'), ('Команда Дамир'), ('Команда Абылай'), ('Команда Тоғжан'), ('Команда Айша Тараз');
-
 -- +goose Down
 DROP TABLE IF EXISTS sales_data;
 DROP TABLE IF EXISTS marketing_data;
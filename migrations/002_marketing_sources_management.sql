@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE marketing_sources ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE marketing_sources ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE marketing_sources SET sort_order = id;
+
+-- +goose Down
+ALTER TABLE marketing_sources DROP COLUMN archived_at;
+ALTER TABLE marketing_sources DROP COLUMN sort_order;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE sales_teams ADD COLUMN active_from DATE;
+ALTER TABLE sales_teams ADD COLUMN active_to DATE;
+ALTER TABLE sales_teams ADD CONSTRAINT sales_teams_active_period_check
+    CHECK (active_from IS NULL OR active_to IS NULL OR active_from <= active_to);
+
+-- +goose Down
+ALTER TABLE sales_teams DROP CONSTRAINT sales_teams_active_period_check;
+ALTER TABLE sales_teams DROP COLUMN active_to;
+ALTER TABLE sales_teams DROP COLUMN active_from;
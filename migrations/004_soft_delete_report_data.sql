@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE marketing_data ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE sales_data ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE sales_data DROP COLUMN deleted_at;
+ALTER TABLE marketing_data DROP COLUMN deleted_at;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE audit_log (
+                           id BIGSERIAL PRIMARY KEY,
+                           entity VARCHAR(50) NOT NULL,
+                           entity_id INTEGER NOT NULL,
+                           action VARCHAR(20) NOT NULL,
+                           actor VARCHAR(100) NOT NULL,
+                           request_id VARCHAR(64),
+                           before JSONB,
+                           after JSONB,
+                           created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity, entity_id, created_at);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE users (
+                       id SERIAL PRIMARY KEY,
+                       username VARCHAR(100) NOT NULL UNIQUE,
+                       password_hash TEXT NOT NULL,
+                       is_active BOOLEAN NOT NULL DEFAULT TRUE,
+                       created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE refresh_tokens (
+                                id SERIAL PRIMARY KEY,
+                                user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                token_hash CHAR(64) NOT NULL UNIQUE,
+                                expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                revoked_at TIMESTAMP WITH TIME ZONE,
+                                created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
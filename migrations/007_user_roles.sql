@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'viewer'
+    CHECK (role IN ('admin', 'marketer', 'sales_lead', 'viewer'));
+ALTER TABLE users ADD COLUMN team_id INTEGER REFERENCES sales_teams(id);
+
+-- Accounts created before roles existed had full access
+UPDATE users SET role = 'admin';
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN team_id;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE period_locks (
+                              id SERIAL PRIMARY KEY,
+                              date_from DATE NOT NULL,
+                              date_to DATE NOT NULL,
+                              closed_by VARCHAR(100) NOT NULL,
+                              closed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                              reopened_by VARCHAR(100),
+                              reopened_at TIMESTAMP WITH TIME ZONE,
+                              reopen_reason TEXT,
+                              CHECK (date_from <= date_to),
+                              CHECK (reopened_at IS NULL OR reopen_reason IS NOT NULL)
+);
+
+CREATE INDEX period_locks_active_idx ON period_locks (date_from, date_to) WHERE reopened_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS period_locks;
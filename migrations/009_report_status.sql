@@ -0,0 +1,40 @@
+-- +goose Up
+ALTER TABLE marketing_data ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'draft'
+    CHECK (status IN ('draft', 'submitted', 'approved', 'rejected'));
+ALTER TABLE marketing_data ADD COLUMN status_comment TEXT;
+ALTER TABLE marketing_data ADD COLUMN status_changed_by VARCHAR(100);
+ALTER TABLE marketing_data ADD COLUMN status_changed_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE sales_data ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'draft'
+    CHECK (status IN ('draft', 'submitted', 'approved', 'rejected'));
+ALTER TABLE sales_data ADD COLUMN status_comment TEXT;
+ALTER TABLE sales_data ADD COLUMN status_changed_by VARCHAR(100);
+ALTER TABLE sales_data ADD COLUMN status_changed_at TIMESTAMP WITH TIME ZONE;
+
+-- Rows marked as saved were handed in by their authors
+UPDATE marketing_data SET status = 'submitted' WHERE is_saved;
+UPDATE sales_data SET status = 'submitted' WHERE is_saved;
+
+ALTER TABLE marketing_data DROP COLUMN is_saved;
+ALTER TABLE sales_data DROP COLUMN is_saved;
+
+CREATE INDEX marketing_data_status_idx ON marketing_data (status, date);
+CREATE INDEX sales_data_status_idx ON sales_data (status, date);
+
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('admin', 'marketer', 'sales_lead', 'sales_head', 'viewer'));
+
+-- +goose Down
+UPDATE users SET role = 'viewer' WHERE role = 'sales_head';
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check
+    CHECK (role IN ('admin', 'marketer', 'sales_lead', 'viewer'));
+
+ALTER TABLE marketing_data ADD COLUMN is_saved BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE sales_data ADD COLUMN is_saved BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE marketing_data SET is_saved = status <> 'draft';
+UPDATE sales_data SET is_saved = status <> 'draft';
+
+ALTER TABLE marketing_data DROP COLUMN status, DROP COLUMN status_comment, DROP COLUMN status_changed_by, DROP COLUMN status_changed_at;
+ALTER TABLE sales_data DROP COLUMN status, DROP COLUMN status_comment, DROP COLUMN status_changed_by, DROP COLUMN status_changed_at;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE marketing_data ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE sales_data ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE marketing_data DROP COLUMN version;
+ALTER TABLE sales_data DROP COLUMN version;
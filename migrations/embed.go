@@ -0,0 +1,15 @@
+// Package migrations embeds the goose migrations, so that the binary can
+// apply them without the source tree.
+package migrations
+
+import "embed"
+
+// Postgres holds the migrations of the Postgres backend.
+//
+//go:embed *.sql
+var Postgres embed.FS
+
+// SQLite holds the migrations of the SQLite backend under sqlite/.
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
@@ -0,0 +1,140 @@
+-- +goose Up
+-- The schema of migrations 001-010 for SQLite. Constraints carry the names
+-- Postgres gives them, so that errors read the same on both backends.
+-- Sources and teams are reference data, "api seed" adds them
+CREATE TABLE marketing_sources (
+                                   id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                   name VARCHAR(50) NOT NULL,
+                                   sort_order INTEGER NOT NULL DEFAULT 0,
+                                   archived_at TIMESTAMP,
+                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                   CONSTRAINT marketing_sources_name_key UNIQUE (name)
+);
+
+CREATE TABLE sales_teams (
+                             id INTEGER PRIMARY KEY AUTOINCREMENT,
+                             name VARCHAR(50) NOT NULL,
+                             active_from DATE,
+                             active_to DATE,
+                             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                             CONSTRAINT sales_teams_name_key UNIQUE (name),
+                             CONSTRAINT sales_teams_active_period_check
+                                 CHECK (active_from IS NULL OR active_to IS NULL OR active_from <= active_to)
+);
+
+CREATE TABLE marketing_data (
+                                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                date DATE NOT NULL,
+                                source_id INTEGER NOT NULL REFERENCES marketing_sources(id),
+                                expense DECIMAL(15,2) NOT NULL DEFAULT 0,
+                                leads INTEGER NOT NULL DEFAULT 0,
+                                trials_scheduled INTEGER NOT NULL DEFAULT 0,
+                                trials_conducted INTEGER NOT NULL DEFAULT 0,
+                                payments INTEGER NOT NULL DEFAULT 0,
+                                total_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+                                status VARCHAR(20) NOT NULL DEFAULT 'draft',
+                                status_comment TEXT,
+                                status_changed_by VARCHAR(100),
+                                status_changed_at TIMESTAMP,
+                                version INTEGER NOT NULL DEFAULT 1,
+                                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                deleted_at TIMESTAMP,
+                                CONSTRAINT marketing_data_date_source_id_key UNIQUE (date, source_id),
+                                CONSTRAINT marketing_data_status_check
+                                    CHECK (status IN ('draft', 'submitted', 'approved', 'rejected'))
+);
+
+CREATE TABLE sales_data (
+                            id INTEGER PRIMARY KEY AUTOINCREMENT,
+                            date DATE NOT NULL,
+                            team_id INTEGER NOT NULL REFERENCES sales_teams(id),
+                            leads INTEGER NOT NULL DEFAULT 0,
+                            trials_scheduled INTEGER NOT NULL DEFAULT 0,
+                            trials_conducted INTEGER NOT NULL DEFAULT 0,
+                            payments INTEGER NOT NULL DEFAULT 0,
+                            total_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+                            kaspi_refund DECIMAL(15,2) NOT NULL DEFAULT 0,
+                            status VARCHAR(20) NOT NULL DEFAULT 'draft',
+                            status_comment TEXT,
+                            status_changed_by VARCHAR(100),
+                            status_changed_at TIMESTAMP,
+                            version INTEGER NOT NULL DEFAULT 1,
+                            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                            deleted_at TIMESTAMP,
+                            CONSTRAINT sales_data_date_team_id_key UNIQUE (date, team_id),
+                            CONSTRAINT sales_data_status_check
+                                CHECK (status IN ('draft', 'submitted', 'approved', 'rejected'))
+);
+
+CREATE INDEX marketing_data_status_idx ON marketing_data (status, date);
+CREATE INDEX sales_data_status_idx ON sales_data (status, date);
+
+CREATE TABLE audit_log (
+                           id INTEGER PRIMARY KEY AUTOINCREMENT,
+                           entity VARCHAR(50) NOT NULL,
+                           entity_id INTEGER NOT NULL,
+                           action VARCHAR(20) NOT NULL,
+                           actor VARCHAR(100) NOT NULL,
+                           request_id VARCHAR(64),
+                           before TEXT,
+                           after TEXT,
+                           created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity, entity_id, created_at);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+CREATE TABLE users (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       username VARCHAR(100) NOT NULL,
+                       password_hash TEXT NOT NULL,
+                       role VARCHAR(20) NOT NULL DEFAULT 'viewer',
+                       team_id INTEGER REFERENCES sales_teams(id),
+                       is_active BOOLEAN NOT NULL DEFAULT TRUE,
+                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                       updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                       CONSTRAINT users_username_key UNIQUE (username),
+                       CONSTRAINT users_role_check
+                           CHECK (role IN ('admin', 'marketer', 'sales_lead', 'sales_head', 'viewer'))
+);
+
+CREATE TABLE refresh_tokens (
+                                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                token_hash CHAR(64) NOT NULL,
+                                expires_at TIMESTAMP NOT NULL,
+                                revoked_at TIMESTAMP,
+                                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                CONSTRAINT refresh_tokens_token_hash_key UNIQUE (token_hash)
+);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+CREATE TABLE period_locks (
+                              id INTEGER PRIMARY KEY AUTOINCREMENT,
+                              date_from DATE NOT NULL,
+                              date_to DATE NOT NULL,
+                              closed_by VARCHAR(100) NOT NULL,
+                              closed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                              reopened_by VARCHAR(100),
+                              reopened_at TIMESTAMP,
+                              reopen_reason TEXT,
+                              CONSTRAINT period_locks_check CHECK (date_from <= date_to),
+                              CONSTRAINT period_locks_check1 CHECK (reopened_at IS NULL OR reopen_reason IS NOT NULL)
+);
+
+CREATE INDEX period_locks_active_idx ON period_locks (date_from, date_to) WHERE reopened_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS period_locks;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS sales_data;
+DROP TABLE IF EXISTS marketing_data;
+DROP TABLE IF EXISTS sales_teams;
+DROP TABLE IF EXISTS marketing_sources;
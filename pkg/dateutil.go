@@ -1,7 +1,27 @@
 package dateutil
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const ISOLayout = "2006-01-02"
+
+var parseLayouts = []string{ISOLayout, time.RFC3339, "02.01.2006"}
 
 func FormatDate(t time.Time) string {
 	return t.Format("02.01.2006")
 }
+
+// ParseDate accepts ISO dates, RFC 3339 timestamps (as DATE columns come back
+// from the driver) and the dd.mm.yyyy format used in our spreadsheets.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range parseLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}